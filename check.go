@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"github.com/go-git/go-git/v5/utils/diff"
+	"github.com/sergi/go-diff/diffmatchpatch"
+	"strings"
+)
+
+// maxGoldenDiffLines is the maximum number of differing lines that -check-against prints.
+const maxGoldenDiffLines = 50
+
+// goldenDiff returns the lines that differ between a golden file and the generated output, with their line numbers:
+// "-" lines are only in the golden file, "+" lines only in the output. At most maxLines lines are listed.
+// The result is empty if the two are equal.
+func goldenDiff(golden, generated string, maxLines int) string {
+	var out strings.Builder
+	goldenLine, generatedLine, listed, omitted := 1, 1, 0, 0
+	for _, d := range diff.Do(golden, generated) {
+		lines := strings.SplitAfter(d.Text, "\n")
+		if lines[len(lines)-1] == "" {
+			lines = lines[:len(lines)-1]
+		}
+		for _, l := range lines {
+			l = strings.TrimSuffix(l, "\n")
+			switch d.Type {
+			case diffmatchpatch.DiffEqual:
+				goldenLine++
+				generatedLine++
+				continue
+			case diffmatchpatch.DiffDelete:
+				if listed < maxLines {
+					fmt.Fprintf(&out, "-%d: %s\n", goldenLine, l)
+				}
+				goldenLine++
+			case diffmatchpatch.DiffInsert:
+				if listed < maxLines {
+					fmt.Fprintf(&out, "+%d: %s\n", generatedLine, l)
+				}
+				generatedLine++
+			}
+			if listed < maxLines {
+				listed++
+			} else {
+				omitted++
+			}
+		}
+	}
+	if omitted > 0 {
+		fmt.Fprintf(&out, "... and %d more differing lines\n", omitted)
+	}
+	return out.String()
+}
@@ -0,0 +1,45 @@
+package forkdiff
+
+import (
+	"github.com/go-git/go-git/v5/plumbing/format/diff"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"strings"
+)
+
+// lastAuthors returns the e-mail address of the author of the last of the commits that changed each path,
+// with the commits oldest first, like forkCommits. Merge commits are skipped,
+// since their changes are those of the merged commits, which are walked themselves.
+// Both the old and the new path of a renamed file are attributed to the author of the rename.
+func lastAuthors(commits []*object.Commit) (map[string]string, error) {
+	out := make(map[string]string)
+	for _, c := range commits {
+		if c.NumParents() > 1 {
+			continue
+		}
+		changes, err := commitChanges(c)
+		if err != nil {
+			return nil, err
+		}
+		for _, ch := range changes {
+			if ch.From.Name != "" {
+				out[ch.From.Name] = c.Author.Email
+			}
+			if ch.To.Name != "" {
+				out[ch.To.Name] = c.Author.Email
+			}
+		}
+	}
+	return out, nil
+}
+
+// filterAuthor returns the file patches of the paths that were last changed by the author, see Options.Author.
+// The e-mail addresses are compared case-insensitively.
+func filterAuthor(patchByName map[string]diff.FilePatch, authors map[string]string, author string) map[string]diff.FilePatch {
+	out := make(map[string]diff.FilePatch, len(patchByName))
+	for k, fp := range patchByName {
+		if strings.EqualFold(authors[k], author) {
+			out[k] = fp
+		}
+	}
+	return out
+}
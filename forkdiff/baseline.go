@@ -0,0 +1,101 @@
+package forkdiff
+
+import (
+	"github.com/go-git/go-git/v5/plumbing/format/diff"
+	"sort"
+	"strings"
+)
+
+// unclaimedSection is the section name of files that are not claimed by any section.
+const unclaimedSection = "(unclaimed)"
+
+// StructureChanges describes how the categorization of the changes differs from that of a baseline definition.
+type StructureChanges struct {
+	Moved           []FileMove
+	AddedSections   []string
+	RemovedSections []string
+}
+
+// FileMove is a file that is assigned to a different section than in the baseline definition.
+type FileMove struct {
+	Path string
+	From string
+	To   string
+}
+
+// Empty returns true if there are no structure changes.
+func (sc *StructureChanges) Empty() bool {
+	return len(sc.Moved) == 0 && len(sc.AddedSections) == 0 && len(sc.RemovedSections) == 0
+}
+
+// compareStructure expands the baseline definition against the same patches as the current definition,
+// and reports the files that changed section, and the sections that were added or removed.
+// The current definition must already be hydrated, the baseline definition is hydrated by this function.
+func compareStructure(current, baseline *ForkDefinition, patchByName map[string]diff.FilePatch, allowMultiple, foldCase bool) (*StructureChanges, error) {
+	claims, _, err := baseline.assignFiles(patchByName, allowMultiple, foldCase)
+	if err != nil {
+		return nil, err
+	}
+	baseline.hydrateClaims(patchByName, claims)
+	currentSections := make(map[string]struct{})
+	currentAssignments := make(map[string]string)
+	current.sectionAssignments("", currentSections, currentAssignments)
+	baselineSections := make(map[string]struct{})
+	baselineAssignments := make(map[string]string)
+	baseline.sectionAssignments("", baselineSections, baselineAssignments)
+
+	var out StructureChanges
+	for name := range patchByName {
+		from, ok := baselineAssignments[name]
+		if !ok {
+			from = unclaimedSection
+		}
+		to, ok := currentAssignments[name]
+		if !ok {
+			to = unclaimedSection
+		}
+		if from != to {
+			out.Moved = append(out.Moved, FileMove{Path: name, From: from, To: to})
+		}
+	}
+	sort.Slice(out.Moved, func(i, j int) bool {
+		return out.Moved[i].Path < out.Moved[j].Path
+	})
+	for k := range currentSections {
+		if _, ok := baselineSections[k]; !ok {
+			out.AddedSections = append(out.AddedSections, k)
+		}
+	}
+	for k := range baselineSections {
+		if _, ok := currentSections[k]; !ok {
+			out.RemovedSections = append(out.RemovedSections, k)
+		}
+	}
+	sort.Strings(out.AddedSections)
+	sort.Strings(out.RemovedSections)
+	return &out, nil
+}
+
+// sectionAssignments collects the title path of every section, and the section title path of every file.
+// Files in multiple sections get the title paths of all of them, in order.
+func (fd *ForkDefinition) sectionAssignments(parentPath string, sections map[string]struct{}, files map[string]string) {
+	title := fd.Title
+	if title == "" {
+		title = "(untitled)"
+	}
+	sectionPath := title
+	if parentPath != "" {
+		sectionPath = strings.Join([]string{parentPath, title}, " / ")
+	}
+	sections[sectionPath] = struct{}{}
+	for _, f := range fd.Files {
+		if prev, ok := files[f.Path]; ok {
+			files[f.Path] = prev + ", " + sectionPath
+		} else {
+			files[f.Path] = sectionPath
+		}
+	}
+	for _, sub := range fd.Sub {
+		sub.sectionAssignments(sectionPath, sections, files)
+	}
+}
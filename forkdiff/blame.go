@@ -0,0 +1,75 @@
+package forkdiff
+
+import (
+	"fmt"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// blameCache caches the blame results of files in the fork, since blaming is expensive.
+type blameCache struct {
+	repo    *git.Repository
+	commit  *object.Commit
+	files   map[string]*git.BlameResult
+	errs    map[string]error
+	commits map[plumbing.Hash]*object.Commit
+}
+
+func newBlameCache(repo *git.Repository, commit *object.Commit) *blameCache {
+	return &blameCache{
+		repo:    repo,
+		commit:  commit,
+		files:   make(map[string]*git.BlameResult),
+		errs:    make(map[string]error),
+		commits: make(map[plumbing.Hash]*object.Commit),
+	}
+}
+
+func (b *blameCache) blame(path string) (*git.BlameResult, error) {
+	if res, ok := b.files[path]; ok {
+		return res, nil
+	}
+	if err, ok := b.errs[path]; ok {
+		return nil, err
+	}
+	res, err := git.Blame(b.commit, path)
+	if err != nil {
+		err = fmt.Errorf("failed to blame %q: %w", path, err)
+		b.errs[path] = err
+		return nil, err
+	}
+	b.files[path] = res
+	return res, nil
+}
+
+// introducedBy returns the commits that introduced the given lines (1-based) of the fork file,
+// in order of first appearance.
+func (b *blameCache) introducedBy(path string, lines []int) ([]*object.Commit, error) {
+	res, err := b.blame(path)
+	if err != nil {
+		return nil, err
+	}
+	var out []*object.Commit
+	seen := make(map[plumbing.Hash]struct{})
+	for _, n := range lines {
+		if n < 1 || n > len(res.Lines) {
+			continue
+		}
+		h := res.Lines[n-1].Hash
+		if _, ok := seen[h]; ok {
+			continue
+		}
+		seen[h] = struct{}{}
+		c, ok := b.commits[h]
+		if !ok {
+			c, err = b.repo.CommitObject(h)
+			if err != nil {
+				return nil, fmt.Errorf("failed to open commit %s: %w", h, err)
+			}
+			b.commits[h] = c
+		}
+		out = append(out, c)
+	}
+	return out, nil
+}
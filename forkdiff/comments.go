@@ -0,0 +1,180 @@
+package forkdiff
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// LineComment is a markdown comment on a line or line range of a changed file,
+// rendered within its diff after the last line of the range, like a code review comment.
+type LineComment struct {
+	Path string `yaml:"path"`
+	// Lines is the 1-based line, like "12", or the inclusive line range, like "12-15", of the file in the fork.
+	Lines string `yaml:"lines"`
+	// Base is true if the Lines are those of the file in the base, to comment on removed lines.
+	Base    bool   `yaml:"base,omitempty"`
+	Comment string `yaml:"comment"`
+
+	// from and to are the parsed Lines.
+	from, to int
+}
+
+// checkComments returns an error if any of the comments has no path or comment, or invalid lines,
+// and parses the lines of the others.
+func (p *Page) checkComments() error {
+	for i := range p.Comments {
+		c := &p.Comments[i]
+		if c.Path == "" {
+			return fmt.Errorf("comment %d has no path", i)
+		}
+		if strings.TrimSpace(c.Comment) == "" {
+			return fmt.Errorf("comment %d on %q is empty", i, c.Path)
+		}
+		from, to, err := parseLineRange(c.Lines)
+		if err != nil {
+			return fmt.Errorf("invalid lines of comment %d on %q: %w", i, c.Path, err)
+		}
+		c.from, c.to = from, to
+	}
+	return nil
+}
+
+// parseLineRange parses a 1-based line, or an inclusive line range of two lines separated by a dash.
+func parseLineRange(s string) (from, to int, err error) {
+	first, last, isRange := strings.Cut(strings.TrimSpace(s), "-")
+	from, err = strconv.Atoi(strings.TrimSpace(first))
+	if err != nil || from < 1 {
+		return 0, 0, fmt.Errorf("%q is not a line number or range", s)
+	}
+	if !isRange {
+		return from, from, nil
+	}
+	to, err = strconv.Atoi(strings.TrimSpace(last))
+	if err != nil || to < 1 {
+		return 0, 0, fmt.Errorf("%q is not a line number or range", s)
+	}
+	if to < from {
+		return 0, 0, errors.New("the range ends before it starts")
+	}
+	return from, to, nil
+}
+
+// fileComments returns the comments on the file at the path.
+func (p *Page) fileComments(path string) []*LineComment {
+	var out []*LineComment
+	for i := range p.Comments {
+		if p.Comments[i].Path == path {
+			out = append(out, &p.Comments[i])
+		}
+	}
+	return out
+}
+
+// placeComments finds the position of each comment in the hunks: after the last line of its range that is in the diff,
+// by hunk index and line index within the hunk text, where the header is line 0. A range that spans multiple hunks,
+// with unchanged lines between them that are not in the diff, is placed after its last line in the last of these.
+// The comments of which no line is in the diff are returned as outside.
+func placeComments(hunks []*diffHunk, comments []*LineComment) (placed map[int]map[int][]*LineComment, outside []*LineComment) {
+	hunkLines := make([][]string, len(hunks))
+	for i, h := range hunks {
+		hunkLines[i] = strings.Split(h.Text, "\n")
+	}
+	for _, c := range comments {
+		hunk, line := -1, -1
+		for i, h := range hunks {
+			baseLine, forkLine := h.BaseStart, h.ForkStart
+			for j := 1; j < len(hunkLines[i]); j++ {
+				plain := ansiEscapeRegexp.ReplaceAllString(hunkLines[i][j], "")
+				if plain == "" {
+					continue
+				}
+				n := 0
+				switch plain[0] {
+				case '+':
+					if !c.Base {
+						n = forkLine
+					}
+					forkLine++
+				case '-':
+					if c.Base {
+						n = baseLine
+					}
+					baseLine++
+				case ' ':
+					n = forkLine
+					if c.Base {
+						n = baseLine
+					}
+					baseLine++
+					forkLine++
+				}
+				if n >= c.from && n <= c.to {
+					hunk, line = i, j
+				}
+			}
+		}
+		if hunk < 0 {
+			outside = append(outside, c)
+			continue
+		}
+		// after the "\ No newline at end of file" marker of the line, if any
+		lines := hunkLines[hunk]
+		for line+1 < len(lines) && strings.HasPrefix(ansiEscapeRegexp.ReplaceAllString(lines[line+1], ""), `\`) {
+			line++
+		}
+		if placed == nil {
+			placed = make(map[int]map[int][]*LineComment)
+		}
+		if placed[hunk] == nil {
+			placed[hunk] = make(map[int][]*LineComment)
+		}
+		placed[hunk][line] = append(placed[hunk][line], c)
+	}
+	return placed, outside
+}
+
+// commentSegment is a part of a hunk, followed by the comments on its last lines.
+type commentSegment struct {
+	Text     string
+	Comments []*LineComment
+}
+
+// splitAtComments splits the text of a hunk after the lines that are commented on, by line index, see placeComments.
+func splitAtComments(text string, comments map[int][]*LineComment) []commentSegment {
+	if len(comments) == 0 {
+		return []commentSegment{{Text: text}}
+	}
+	var out []commentSegment
+	var current []string
+	for i, line := range strings.Split(text, "\n") {
+		current = append(current, line)
+		if c, ok := comments[i]; ok {
+			out = append(out, commentSegment{Text: strings.Join(current, "\n"), Comments: c})
+			current = nil
+		}
+	}
+	if len(current) > 0 {
+		out = append(out, commentSegment{Text: strings.Join(current, "\n")})
+	}
+	return out
+}
+
+// renderLineComment renders a comment as a block within the diff, with the lines it is on.
+// If outside is true, none of its lines are in the diff, and it is rendered after the diff.
+func (r *Result) renderLineComment(c *LineComment, outside bool) string {
+	lines := fmt.Sprintf("line %d", c.from)
+	if c.to != c.from {
+		lines = fmt.Sprintf("lines %d-%d", c.from, c.to)
+	}
+	if c.Base {
+		lines += " of the base"
+	}
+	if outside {
+		lines += ", not in the diff"
+	}
+	return `<div class="line-comment" role="note"><div class="line-comment-lines">` + template.HTMLEscapeString(lines) +
+		`</div><div class="markdown">` + r.renderCachedMarkdown(c.Comment) + "</div></div>"
+}
@@ -0,0 +1,214 @@
+package forkdiff
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"io"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// CommitChanges are the changes of a single fork commit, when grouping by commit.
+type CommitChanges struct {
+	Commit *object.Commit
+	// Def lists the files changed by the commit, with the totals. Its title is the commit subject.
+	Def *ForkDefinition
+	// Message is the commit message without the subject line.
+	Message string
+	// Merge is true if the commit is a merge commit, diffed against its first parent.
+	Merge bool
+	// Trailers are the trailers at the end of the commit message, with Options.ShowTrailers.
+	// The Message does not include them then.
+	Trailers []Trailer
+	// Note is the git note of the commit, with Options.ShowNotes. Empty if the commit has none.
+	Note string
+}
+
+// forkCommits returns the commits that are reachable from the fork commit, but not from the base commit,
+// oldest first by committer time.
+func forkCommits(base, fork *object.Commit) ([]*object.Commit, error) {
+	inBase, err := ancestors(base)
+	if err != nil {
+		return nil, fmt.Errorf("failed to walk base history: %w", err)
+	}
+	var out []*object.Commit
+	iter := object.NewCommitIterCTime(fork, inBase, nil)
+	defer iter.Close()
+	for {
+		c, err := iter.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to walk fork history: %w", err)
+		}
+		out = append(out, c)
+	}
+	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+		out[i], out[j] = out[j], out[i]
+	}
+	return out, nil
+}
+
+// ancestors returns the hashes of the commit and all the commits that are reachable from it.
+func ancestors(c *object.Commit) (map[plumbing.Hash]bool, error) {
+	out := make(map[plumbing.Hash]bool)
+	err := object.NewCommitPreorderIter(c, nil, nil).ForEach(func(c *object.Commit) error {
+		out[c.Hash] = true
+		return nil
+	})
+	return out, err
+}
+
+// Divergence is the position of the fork relative to the base in the commit graph, see Options.Divergence.
+type Divergence struct {
+	// Ahead is the number of fork commits that are not in the base history.
+	Ahead int
+	// Behind is the number of base commits that are not in the fork history.
+	Behind int
+	// MergeBase is the best common ancestor of the base and fork, nil if they have no common history.
+	// If there are multiple best common ancestors, like after criss-cross merges, it is the first one.
+	MergeBase *object.Commit
+}
+
+// computeDivergence counts the commits of the fork and base that the other does not have.
+func computeDivergence(base, fork *object.Commit) (*Divergence, error) {
+	inBase, err := ancestors(base)
+	if err != nil {
+		return nil, fmt.Errorf("failed to walk base history: %w", err)
+	}
+	inFork, err := ancestors(fork)
+	if err != nil {
+		return nil, fmt.Errorf("failed to walk fork history: %w", err)
+	}
+	out := &Divergence{}
+	for h := range inFork {
+		if !inBase[h] {
+			out.Ahead++
+		}
+	}
+	for h := range inBase {
+		if !inFork[h] {
+			out.Behind++
+		}
+	}
+	// the histories are disjoint if every commit of either side is unique to it
+	if out.Ahead < len(inFork) {
+		bases, err := fork.MergeBase(base)
+		if err != nil {
+			return nil, fmt.Errorf("failed to find merge base: %w", err)
+		}
+		if len(bases) > 0 {
+			out.MergeBase = bases[0]
+		}
+	}
+	return out, nil
+}
+
+// groupByCommit computes the changes of each fork commit against its first parent.
+// Merge commits are skipped, unless merges is "first-parent".
+// Only the commits of the Author are listed, if set.
+// The Extensions, ChangeKinds, ignore globs and SkipGenerated apply to the files of each commit like to the whole diff,
+// except that the ignored and generated files of the commits are left out.
+func (r *Result) groupByCommit(merges string) ([]CommitChanges, error) {
+	commits, err := forkCommits(r.BaseCommit, r.ForkCommit)
+	if err != nil {
+		return nil, err
+	}
+	opts := r.Options
+	marker, err := opts.generatedMarker()
+	if err != nil {
+		return nil, err
+	}
+	usedIDs := make(map[string]struct{})
+	var out []CommitChanges
+	for _, c := range commits {
+		merge := c.NumParents() > 1
+		if merge && merges == "skip" {
+			continue
+		}
+		if opts.Author != "" && !strings.EqualFold(c.Author.Email, opts.Author) {
+			continue
+		}
+		parentTree, tree, err := commitTrees(c)
+		if err != nil {
+			return nil, err
+		}
+		patches, err := ComputePatches(context.Background(), parentTree, tree, opts.MaxFileSize, opts.RenameThreshold)
+		if err != nil {
+			return nil, fmt.Errorf("failed to diff commit %s: %w", c.Hash, err)
+		}
+		if r.textconv != nil {
+			if err := r.textconv.convert(context.Background(), patches.ByName); err != nil {
+				return nil, fmt.Errorf("failed to convert files of commit %s: %w", c.Hash, err)
+			}
+		}
+		if len(opts.Extensions) > 0 {
+			patches.ByName = filterExtensions(patches.ByName, opts.Extensions)
+		}
+		if len(opts.ChangeKinds) > 0 {
+			patches.ByName, err = filterChangeKinds(patches.ByName, opts.ChangeKinds)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if opts.SkipGenerated {
+			patches.ByName, _, err = splitGenerated(opts.Repo, patches.ByName, marker)
+			if err != nil {
+				return nil, fmt.Errorf("failed to find generated files of commit %s: %w", c.Hash, err)
+			}
+		}
+		subject, message, _ := strings.Cut(c.Message, "\n")
+		def := &ForkDefinition{Title: subject, Level: 3, commitSubject: true}
+		paths := make(map[string]struct{}, len(patches.ByName))
+		for k := range patches.ByName {
+			ignored, err := r.Page.isIgnored(k)
+			if err != nil {
+				return nil, err
+			}
+			if !ignored {
+				paths[k] = struct{}{}
+			}
+		}
+		for _, k := range sortedKeys(paths) {
+			def.hydratePatch(k, patches.ByName[k])
+		}
+		def.sortFiles(func(a, b *FilePatchStats) bool {
+			return r.lessPath(a.Path, b.Path)
+		})
+		def.assignIDs("/commit-"+c.Hash.String(), usedIDs)
+		var trailers []Trailer
+		if opts.ShowTrailers {
+			message, trailers = parseTrailers(message)
+		}
+		var note string
+		if r.notes != nil {
+			note, err = r.notes.note(c.Hash)
+			if err != nil {
+				return nil, err
+			}
+		}
+		out = append(out, CommitChanges{
+			Commit:   c,
+			Def:      def,
+			Message:  strings.TrimSpace(message),
+			Merge:    merge,
+			Trailers: trailers,
+			Note:     note,
+		})
+	}
+	return out, nil
+}
+
+// renderCommitTime renders a commit time as its date, with the absolute time in the title, and the ISO 8601 time
+// in UTC in the datetime and data-timestamp attributes. The script of the page shows it relative to the time
+// it is viewed, like "3 days ago", so the page itself does not depend on when it was generated.
+func renderCommitTime(t time.Time) string {
+	iso := template.HTMLEscapeString(t.UTC().Format(time.RFC3339))
+	return fmt.Sprintf(`<time class="commit-time" datetime="%s" data-timestamp="%s" title="%s">%s</time>`, iso, iso,
+		template.HTMLEscapeString(t.Format("2006-01-02 15:04:05 -0700")), template.HTMLEscapeString(t.Format("2006-01-02")))
+}
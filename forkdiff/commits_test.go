@@ -0,0 +1,47 @@
+package forkdiff
+
+import (
+	"bytes"
+	"github.com/go-git/go-git/v5/plumbing"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRenderCommitTime(t *testing.T) {
+	when := time.Date(2023, 4, 5, 6, 7, 8, 0, time.FixedZone("", 2*60*60))
+	want := `<time class="commit-time" datetime="2023-04-05T04:07:08Z" data-timestamp="2023-04-05T04:07:08Z" title="2023-04-05 06:07:08 +0200">2023-04-05</time>`
+	if got := renderCommitTime(when); got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+func TestGroupByCommitEscapes(t *testing.T) {
+	repo, _, _ := testTrees(t, testFiles(map[string]string{"a.go": "a\n"}), testFiles(map[string]string{"a.go": "b\n"}))
+	commit := commitTestFiles(t, repo, "fork", "make <b>a</b> bold\n\nthe body <script>alert(1)</script>\n", testFiles(map[string]string{"a.go": "c\n"}))
+	commit.Author.Name = "Dev <i>"
+	commit.Committer = commit.Author
+	h := writeTestObject(t, repo, commit)
+	if err := repo.Storer.SetReference(plumbing.NewHashReference(plumbing.NewBranchReferenceName("fork"), h)); err != nil {
+		t.Fatal(err)
+	}
+	res := analyzeTest(t, repo, &ForkDefinition{Title: "root"}, Options{GroupBy: "commit"})
+	var buf bytes.Buffer
+	if err := res.Render(&buf, res.Page); err != nil {
+		t.Fatal(err)
+	}
+	page := buf.String()
+	for _, raw := range []string{"<b>", "<script>alert", "Dev <i>"} {
+		if strings.Contains(page, raw) {
+			t.Errorf("the page contains the unescaped %q", raw)
+		}
+	}
+	for _, escaped := range []string{"make &lt;b&gt;a&lt;/b&gt; bold</h3>", "the body &lt;script&gt;alert(1)&lt;/script&gt;", "Dev &lt;i&gt;"} {
+		if !strings.Contains(page, escaped) {
+			t.Errorf("the page does not contain %q", escaped)
+		}
+	}
+	if res.Page.Commits[len(res.Page.Commits)-1].Def.Title != "make <b>a</b> bold" {
+		t.Error("the title of the commit section is escaped, instead of only on the page")
+	}
+}
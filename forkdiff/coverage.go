@@ -0,0 +1,139 @@
+package forkdiff
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Coverage reports which files of the whole fork tree, changed or not, the sections of the page definition would claim,
+// to audit the categorization of the fork before changes accumulate.
+type Coverage struct {
+	// Total is the number of files in the fork tree.
+	Total int `json:"total"`
+	// Sections are the sections of the definition, depth-first, with the number of files that each claims.
+	Sections []SectionCoverage `json:"sections"`
+	// Ignored is the number of files that match an ignore glob of the page.
+	Ignored int `json:"ignored"`
+	// Multiple are the files that are claimed by more than one section, with the titles of those sections.
+	// These are conflicts, unless Options.MultipleSections is set.
+	Multiple map[string][]string `json:"multiple,omitempty"`
+	// Unclaimed are the files that are not ignored and not claimed by any section.
+	Unclaimed []string `json:"unclaimed"`
+}
+
+// SectionCoverage is the number of files of the fork tree that a section claims itself, excluding its sub-sections.
+type SectionCoverage struct {
+	Title string `json:"title"`
+	// Level is the nesting level of the section, the root definition being level 1.
+	Level int `json:"level"`
+	Files int `json:"files"`
+}
+
+// Coverage matches the globs and dirs of all sections of the page definition against all the files of the fork tree.
+// The section of the changes that no section claims is not part of the definition, and not listed.
+func (r *Result) Coverage() (*Coverage, error) {
+	var paths []string
+	out := &Coverage{Unclaimed: []string{}}
+	if err := r.ForkTree.Files().ForEach(func(f *object.File) error {
+		out.Total++
+		ignored, err := r.Page.isIgnored(f.Name)
+		if err != nil {
+			return &ConfigError{Err: err}
+		}
+		if ignored {
+			out.Ignored++
+		} else {
+			paths = append(paths, f.Name)
+		}
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("failed to list the files of the fork tree: %w", err)
+	}
+	sort.Strings(paths)
+	// conflicts are reported, instead of failing the report on the first one
+	claims := make(map[string][]*ForkDefinition)
+	if err := r.Page.Def.claimFiles(paths, claims, true, r.Page.GlobCaseInsensitive); err != nil {
+		return nil, &ConfigError{Err: err}
+	}
+	counts := make(map[*ForkDefinition]int)
+	for _, name := range paths {
+		owners := claims[name]
+		for _, owner := range owners {
+			counts[owner]++
+		}
+		switch {
+		case len(owners) == 0:
+			out.Unclaimed = append(out.Unclaimed, name)
+		case len(owners) > 1:
+			if out.Multiple == nil {
+				out.Multiple = make(map[string][]string)
+			}
+			for _, owner := range owners {
+				out.Multiple[name] = append(out.Multiple[name], owner.Title)
+			}
+		}
+	}
+	var walk func(fd *ForkDefinition, level int)
+	walk = func(fd *ForkDefinition, level int) {
+		if fd == r.remainingDef || fd.Auto {
+			return
+		}
+		out.Sections = append(out.Sections, SectionCoverage{Title: fd.Title, Level: level, Files: counts[fd]})
+		for _, sub := range fd.Sub {
+			walk(sub, level+1)
+		}
+	}
+	walk(r.Page.Def, 1)
+	return out, nil
+}
+
+// WriteText writes the coverage report as plain text, with the share of the fork tree of every count.
+func (c *Coverage) WriteText(w io.Writer) error {
+	share := func(n int) string {
+		if c.Total == 0 {
+			return "0.0%"
+		}
+		return fmt.Sprintf("%.1f%%", float64(n)*100/float64(c.Total))
+	}
+	var out strings.Builder
+	fmt.Fprintf(&out, "Coverage of the %d file%s of the fork tree:\n", c.Total, plural(c.Total))
+	for _, s := range c.Sections {
+		title := s.Title
+		if title == "" {
+			title = "(untitled)"
+		}
+		fmt.Fprintf(&out, "%s%s: %d file%s (%s)\n", strings.Repeat("  ", s.Level-1), title, s.Files, plural(s.Files), share(s.Files))
+	}
+	fmt.Fprintf(&out, "Ignored: %d file%s (%s)\n", c.Ignored, plural(c.Ignored), share(c.Ignored))
+	if len(c.Multiple) > 0 {
+		fmt.Fprintf(&out, "Claimed by multiple sections: %d file%s\n", len(c.Multiple), plural(len(c.Multiple)))
+		names := make([]string, 0, len(c.Multiple))
+		for k := range c.Multiple {
+			names = append(names, k)
+		}
+		sort.Strings(names)
+		for _, k := range names {
+			fmt.Fprintf(&out, "  - %s (%s)\n", k, strings.Join(c.Multiple[k], ", "))
+		}
+	}
+	fmt.Fprintf(&out, "Unclaimed: %d file%s (%s)\n", len(c.Unclaimed), plural(len(c.Unclaimed)), share(len(c.Unclaimed)))
+	for _, k := range c.Unclaimed {
+		fmt.Fprintf(&out, "  - %s\n", k)
+	}
+	_, err := io.WriteString(w, out.String())
+	return err
+}
+
+// WriteJSON writes the coverage report as indented JSON.
+func (c *Coverage) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(c); err != nil {
+		return fmt.Errorf("failed to encode coverage: %w", err)
+	}
+	return nil
+}
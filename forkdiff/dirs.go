@@ -0,0 +1,253 @@
+package forkdiff
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/storage/memory"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// DirBaseRef is the ref of the base commit in a repository created with DirRepo.
+	DirBaseRef = "refs/heads/base"
+	// DirForkRef is the ref of the fork commit in a repository created with DirRepo.
+	DirForkRef = "refs/heads/fork"
+)
+
+// dirIgnoreFile lists glob patterns of paths to leave out when reading a directory with DirRepo, one per line.
+const dirIgnoreFile = ".forkdiffignore"
+
+// DirRepo creates an in-memory git repository, with a commit of the base directory at DirBaseRef,
+// and a commit of the fork directory at DirForkRef. This diffs two directories that are not git trees,
+// like an extracted upstream release and a modified copy of it, with the same pipeline.
+// The ".git" directories, and the paths matching the .forkdiffignore file at the root of a directory, are left out.
+func DirRepo(baseDir, forkDir string) (*git.Repository, error) {
+	repo, err := git.Init(memory.NewStorage(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create in-memory repository: %w", err)
+	}
+	for _, side := range []struct{ dir, ref string }{{baseDir, DirBaseRef}, {forkDir, DirForkRef}} {
+		if err := commitDir(repo, side.dir, plumbing.ReferenceName(side.ref)); err != nil {
+			return nil, fmt.Errorf("failed to read directory %q: %w", side.dir, err)
+		}
+	}
+	return repo, nil
+}
+
+func commitDir(repo *git.Repository, dir string, ref plumbing.ReferenceName) error {
+	ignore, err := readDirIgnore(filepath.Join(dir, dirIgnoreFile))
+	if err != nil {
+		return err
+	}
+	d := &dirTreeWriter{repo: repo, root: dir, ignore: ignore}
+	treeHash, err := d.writeTree("")
+	if err != nil {
+		return err
+	}
+	return commitTree(repo, treeHash, fmt.Sprintf("directory %s\n", filepath.Base(dir)), ref)
+}
+
+// commitTree writes a commit of the tree, and points the ref to it.
+// A zero tree hash, of an empty directory or archive, commits the empty tree, which is written for it.
+func commitTree(repo *git.Repository, treeHash plumbing.Hash, message string, ref plumbing.ReferenceName) error {
+	if treeHash.IsZero() {
+		var err error
+		if treeHash, err = writeTreeObject(repo, &object.Tree{}, ""); err != nil {
+			return err
+		}
+	}
+	// a fixed signature and time, so the same tree always results in the same commit
+	sig := object.Signature{Name: "forkdiff", When: time.Unix(0, 0).UTC()}
+	commit := &object.Commit{
+		Author:    sig,
+		Committer: sig,
+		Message:   message,
+		TreeHash:  treeHash,
+	}
+	obj := repo.Storer.NewEncodedObject()
+	if err := commit.Encode(obj); err != nil {
+		return fmt.Errorf("failed to encode commit: %w", err)
+	}
+	h, err := repo.Storer.SetEncodedObject(obj)
+	if err != nil {
+		return fmt.Errorf("failed to store commit: %w", err)
+	}
+	return repo.Storer.SetReference(plumbing.NewHashReference(ref, h))
+}
+
+// readDirIgnore reads the glob patterns of an ignore file, skipping empty lines and comments.
+// A missing ignore file is not an error.
+func readDirIgnore(name string) ([]string, error) {
+	f, err := os.Open(name)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open ignore file: %w", err)
+	}
+	defer f.Close()
+	return parseDirIgnore(f, name)
+}
+
+// parseDirIgnore parses the glob patterns of an ignore file, named name in errors.
+func parseDirIgnore(r io.Reader, name string) ([]string, error) {
+	var out []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if _, err := path.Match(line, ""); err != nil {
+			return nil, fmt.Errorf("invalid glob pattern %q in %s: %w", line, name, err)
+		}
+		out = append(out, strings.TrimSuffix(line, "/"))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read ignore file: %w", err)
+	}
+	return out, nil
+}
+
+// dirTreeWriter writes the files of a directory as git objects.
+type dirTreeWriter struct {
+	repo   *git.Repository
+	root   string
+	ignore []string
+}
+
+// ignored returns true if the path, relative to the root, matches an ignore pattern, see ignoredPath.
+func (d *dirTreeWriter) ignored(p string) bool {
+	return ignoredPath(d.ignore, p)
+}
+
+// ignoredPath returns true if the path matches one of the ignore patterns.
+// Patterns without a slash also match the name of a file or directory at any depth.
+func ignoredPath(patterns []string, p string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, p); ok {
+			return true
+		}
+		if !strings.Contains(pattern, "/") {
+			if ok, _ := path.Match(pattern, path.Base(p)); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// writeTree writes the tree of the directory at the given slash-separated path, relative to the root.
+// Empty directories are left out, like in git. The hash is zero if the tree is empty.
+func (d *dirTreeWriter) writeTree(rel string) (plumbing.Hash, error) {
+	entries, err := os.ReadDir(filepath.Join(d.root, filepath.FromSlash(rel)))
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+	tree := &object.Tree{}
+	for _, e := range entries {
+		p := path.Join(rel, e.Name())
+		if e.Name() == ".git" || d.ignored(p) {
+			continue
+		}
+		full := filepath.Join(d.root, filepath.FromSlash(p))
+		var entry object.TreeEntry
+		switch {
+		case e.IsDir():
+			h, err := d.writeTree(p)
+			if err != nil {
+				return plumbing.ZeroHash, err
+			}
+			if h.IsZero() {
+				continue
+			}
+			entry = object.TreeEntry{Name: e.Name(), Mode: filemode.Dir, Hash: h}
+		case e.Type()&os.ModeSymlink != 0:
+			target, err := os.Readlink(full)
+			if err != nil {
+				return plumbing.ZeroHash, err
+			}
+			h, err := d.writeBlob([]byte(filepath.ToSlash(target)))
+			if err != nil {
+				return plumbing.ZeroHash, err
+			}
+			entry = object.TreeEntry{Name: e.Name(), Mode: filemode.Symlink, Hash: h}
+		case e.Type().IsRegular():
+			info, err := e.Info()
+			if err != nil {
+				return plumbing.ZeroHash, err
+			}
+			content, err := os.ReadFile(full)
+			if err != nil {
+				return plumbing.ZeroHash, err
+			}
+			h, err := d.writeBlob(content)
+			if err != nil {
+				return plumbing.ZeroHash, err
+			}
+			mode := filemode.Regular
+			if info.Mode()&0o111 != 0 {
+				mode = filemode.Executable
+			}
+			entry = object.TreeEntry{Name: e.Name(), Mode: mode, Hash: h}
+		default:
+			// sockets, devices and the like have no git equivalent
+			continue
+		}
+		tree.Entries = append(tree.Entries, entry)
+	}
+	if len(tree.Entries) == 0 {
+		return plumbing.ZeroHash, nil
+	}
+	return writeTreeObject(d.repo, tree, rel)
+}
+
+// writeTreeObject writes a tree with entries, in the order of git. rel is the path of the tree in errors.
+func writeTreeObject(repo *git.Repository, tree *object.Tree, rel string) (plumbing.Hash, error) {
+	// git orders the entries by name, with directories compared as if their name ends with a slash
+	sortKey := func(e object.TreeEntry) string {
+		if e.Mode == filemode.Dir {
+			return e.Name + "/"
+		}
+		return e.Name
+	}
+	sort.Slice(tree.Entries, func(i, j int) bool {
+		return sortKey(tree.Entries[i]) < sortKey(tree.Entries[j])
+	})
+	obj := repo.Storer.NewEncodedObject()
+	if err := tree.Encode(obj); err != nil {
+		return plumbing.ZeroHash, fmt.Errorf("failed to encode tree %q: %w", rel, err)
+	}
+	return repo.Storer.SetEncodedObject(obj)
+}
+
+func (d *dirTreeWriter) writeBlob(content []byte) (plumbing.Hash, error) {
+	return writeBlob(d.repo, content)
+}
+
+func writeBlob(repo *git.Repository, content []byte) (plumbing.Hash, error) {
+	obj := repo.Storer.NewEncodedObject()
+	obj.SetType(plumbing.BlobObject)
+	w, err := obj.Writer()
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+	if _, err := w.Write(content); err != nil {
+		return plumbing.ZeroHash, err
+	}
+	if err := w.Close(); err != nil {
+		return plumbing.ZeroHash, err
+	}
+	return repo.Storer.SetEncodedObject(obj)
+}
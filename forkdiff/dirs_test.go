@@ -0,0 +1,172 @@
+package forkdiff
+
+import (
+	"archive/tar"
+	"context"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// refTree returns the tree of the commit of the ref.
+func refTree(t *testing.T, repo *git.Repository, ref string) *object.Tree {
+	t.Helper()
+	r, err := repo.Reference(plumbing.ReferenceName(ref), true)
+	if err != nil {
+		t.Fatalf("failed to resolve %s: %v", ref, err)
+	}
+	c, err := repo.CommitObject(r.Hash())
+	if err != nil {
+		t.Fatalf("failed to open commit of %s: %v", ref, err)
+	}
+	tree, err := c.Tree()
+	if err != nil {
+		t.Fatalf("failed to open tree of %s: %v", ref, err)
+	}
+	return tree
+}
+
+func writeTestFile(t *testing.T, name, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(name, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDirRepoEmptyBase(t *testing.T) {
+	base, fork := t.TempDir(), t.TempDir()
+	// a directory with only ignored files is empty too
+	writeTestFile(t, filepath.Join(base, dirIgnoreFile), "build\n")
+	writeTestFile(t, filepath.Join(base, "build", "out.o"), "binary")
+	writeTestFile(t, filepath.Join(fork, "main.go"), "package main\n")
+	repo, err := DirRepo(base, fork)
+	if err != nil {
+		t.Fatal(err)
+	}
+	baseTree := refTree(t, repo, DirBaseRef)
+	if len(baseTree.Entries) != 1 || baseTree.Entries[0].Name != dirIgnoreFile {
+		t.Errorf("got base entries %v, want only the ignore file", baseTree.Entries)
+	}
+	empty, err := DirRepo(t.TempDir(), fork)
+	if err != nil {
+		t.Fatal(err)
+	}
+	emptyTree := refTree(t, empty, DirBaseRef)
+	if len(emptyTree.Entries) != 0 {
+		t.Errorf("got %d entries of an empty directory", len(emptyTree.Entries))
+	}
+	patches, err := ComputePatches(context.Background(), emptyTree, refTree(t, empty, DirForkRef), 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fp, ok := patches.ByName["main.go"]; !ok || changeKind(fp) != "add" {
+		t.Errorf("got patches %v, want main.go added", patches.ByName)
+	}
+}
+
+func TestTarRepoEmptyArchive(t *testing.T) {
+	empty := filepath.Join(t.TempDir(), "empty.tar")
+	f, err := os.Create(empty)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tar.NewWriter(f).Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	repo, err := TarRepo(empty, empty)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tree := refTree(t, repo, DirForkRef); len(tree.Entries) != 0 {
+		t.Errorf("got %d entries of an empty archive", len(tree.Entries))
+	}
+}
+
+// writeTestTar writes a tar archive of the regular files, by path, and returns its path.
+func writeTestTar(t *testing.T, name string, files map[string]string) string {
+	t.Helper()
+	p := filepath.Join(t.TempDir(), name)
+	f, err := os.Create(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := make([]string, 0, len(files))
+	for k := range files {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	w := tar.NewWriter(f)
+	for _, k := range names {
+		if err := w.WriteHeader(&tar.Header{Name: k, Mode: 0o644, Size: int64(len(files[k])), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(files[k])); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestTarRepoTopDir(t *testing.T) {
+	tests := []struct {
+		name    string
+		base    map[string]string
+		fork    map[string]string
+		changes map[string]string
+	}{
+		{
+			"versioned top-level directories",
+			map[string]string{"project-1.2/main.go": "a\n", "project-1.2/lib/util.go": "u\n"},
+			map[string]string{"project-1.3/main.go": "b\n", "project-1.3/lib/util.go": "u\n"},
+			map[string]string{"main.go": "modify"},
+		},
+		{
+			"a file outside of the top-level directory of the fork",
+			map[string]string{"src/main.go": "a\n", "src/util.go": "u\n"},
+			map[string]string{"src/main.go": "b\n", "src/util.go": "u\n", "README": "r\n"},
+			map[string]string{"src/main.go": "modify", "README": "add"},
+		},
+		{
+			"a file outside of the top-level directory of the base",
+			map[string]string{"src/main.go": "a\n", "LICENSE": "l\n"},
+			map[string]string{"src/main.go": "a\n"},
+			map[string]string{"LICENSE": "delete"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo, err := TarRepo(writeTestTar(t, "base.tar", tt.base), writeTestTar(t, "fork.tar", tt.fork))
+			if err != nil {
+				t.Fatal(err)
+			}
+			patches, err := ComputePatches(context.Background(), refTree(t, repo, DirBaseRef), refTree(t, repo, DirForkRef), 0, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := make(map[string]string, len(patches.ByName))
+			for k, fp := range patches.ByName {
+				got[k] = changeKind(fp)
+			}
+			if !reflect.DeepEqual(got, tt.changes) {
+				t.Errorf("got changes %v, want %v", got, tt.changes)
+			}
+		})
+	}
+}
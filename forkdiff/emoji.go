@@ -0,0 +1,117 @@
+package forkdiff
+
+import (
+	"github.com/gomarkdown/markdown/ast"
+	"regexp"
+)
+
+// emojiShortcodeRegexp matches a shortcode like ":rocket:".
+var emojiShortcodeRegexp = regexp.MustCompile(`:[a-z0-9_+-]+:`)
+
+// emojiShortcodes are the emoji of the most common GitHub shortcodes, by shortcode without the colons.
+var emojiShortcodes = map[string]string{
+	"+1":                         "\U0001F44D",
+	"-1":                         "\U0001F44E",
+	"100":                        "\U0001F4AF",
+	"alarm_clock":                "⏰",
+	"arrow_down":                 "⬇️",
+	"arrow_left":                 "⬅️",
+	"arrow_right":                "➡️",
+	"arrow_up":                   "⬆️",
+	"art":                        "\U0001F3A8",
+	"bangbang":                   "‼️",
+	"bell":                       "\U0001F514",
+	"bomb":                       "\U0001F4A3",
+	"book":                       "\U0001F4D6",
+	"bookmark":                   "\U0001F516",
+	"books":                      "\U0001F4DA",
+	"boom":                       "\U0001F4A5",
+	"bug":                        "\U0001F41B",
+	"bulb":                       "\U0001F4A1",
+	"calendar":                   "\U0001F4C6",
+	"chart_with_upwards_trend":   "\U0001F4C8",
+	"chart_with_downwards_trend": "\U0001F4C9",
+	"clipboard":                  "\U0001F4CB",
+	"closed_lock_with_key":       "\U0001F510",
+	"cloud":                      "☁️",
+	"construction":               "\U0001F6A7",
+	"construction_worker":        "\U0001F477",
+	"exclamation":                "❗",
+	"eyes":                       "\U0001F440",
+	"fire":                       "\U0001F525",
+	"gear":                       "⚙️",
+	"gift":                       "\U0001F381",
+	"globe_with_meridians":       "\U0001F310",
+	"hammer":                     "\U0001F528",
+	"hammer_and_wrench":          "\U0001F6E0️",
+	"heart":                      "❤️",
+	"heavy_check_mark":           "✔️",
+	"heavy_minus_sign":           "➖",
+	"heavy_plus_sign":            "➕",
+	"hourglass":                  "⌛",
+	"information_source":         "ℹ️",
+	"key":                        "\U0001F511",
+	"label":                      "\U0001F3F7️",
+	"link":                       "\U0001F517",
+	"lipstick":                   "\U0001F484",
+	"lock":                       "\U0001F512",
+	"loud_sound":                 "\U0001F50A",
+	"mag":                        "\U0001F50D",
+	"memo":                       "\U0001F4DD",
+	"microscope":                 "\U0001F52C",
+	"mute":                       "\U0001F507",
+	"no_entry":                   "⛔",
+	"no_entry_sign":              "\U0001F6AB",
+	"ok":                         "\U0001F197",
+	"package":                    "\U0001F4E6",
+	"paperclip":                  "\U0001F4CE",
+	"pencil":                     "\U0001F4DD",
+	"pushpin":                    "\U0001F4CC",
+	"question":                   "❓",
+	"recycle":                    "♻️",
+	"rewind":                     "⏪",
+	"rocket":                     "\U0001F680",
+	"rotating_light":             "\U0001F6A8",
+	"scroll":                     "\U0001F4DC",
+	"see_no_evil":                "\U0001F648",
+	"shield":                     "\U0001F6E1️",
+	"shipit":                     "\U0001F43F️",
+	"skull":                      "\U0001F480",
+	"smile":                      "\U0001F604",
+	"sparkles":                   "✨",
+	"speech_balloon":             "\U0001F4AC",
+	"star":                       "⭐",
+	"stop_sign":                  "\U0001F6D1",
+	"tada":                       "\U0001F389",
+	"test_tube":                  "\U0001F9EA",
+	"thinking":                   "\U0001F914",
+	"thumbsdown":                 "\U0001F44E",
+	"thumbsup":                   "\U0001F44D",
+	"truck":                      "\U0001F69A",
+	"twisted_rightwards_arrows":  "\U0001F500",
+	"unlock":                     "\U0001F513",
+	"warning":                    "⚠️",
+	"wastebasket":                "\U0001F5D1️",
+	"white_check_mark":           "✅",
+	"wrench":                     "\U0001F527",
+	"x":                          "❌",
+	"zap":                        "⚡",
+}
+
+// expandEmojiShortcodes replaces the known emoji shortcodes in the text of the markdown document with their emoji.
+// Code spans and blocks are other nodes than text, so shortcodes in code are left as they are, like unknown shortcodes.
+func expandEmojiShortcodes(doc ast.Node) {
+	ast.WalkFunc(doc, func(node ast.Node, entering bool) ast.WalkStatus {
+		text, ok := node.(*ast.Text)
+		if !ok || !entering {
+			return ast.GoToNext
+		}
+		text.Literal = emojiShortcodeRegexp.ReplaceAllFunc(text.Literal, func(code []byte) []byte {
+			if emoji, ok := emojiShortcodes[string(code[1:len(code)-1])]; ok {
+				return []byte(emoji)
+			}
+			return code
+		})
+		return ast.GoToNext
+	})
+}
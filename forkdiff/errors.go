@@ -0,0 +1,15 @@
+package forkdiff
+
+// ConfigError is an error in the options or in the fork page definition, as opposed to an error
+// while reading the repository, diffing or rendering. The CLI exits with a distinct code for these.
+type ConfigError struct {
+	Err error
+}
+
+func (e *ConfigError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ConfigError) Unwrap() error {
+	return e.Err
+}
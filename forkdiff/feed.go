@@ -0,0 +1,124 @@
+package forkdiff
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// maxFeedEntries is the maximum number of commits in the feed, the most recent ones are kept.
+const maxFeedEntries = 50
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title   string      `xml:"title"`
+	ID      string      `xml:"id"`
+	Updated string      `xml:"updated"`
+	Links   []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+}
+
+type atomEntry struct {
+	Title     string     `xml:"title"`
+	ID        string     `xml:"id"`
+	Updated   string     `xml:"updated"`
+	Published string     `xml:"published"`
+	Author    atomAuthor `xml:"author"`
+	Links     []atomLink `xml:"link"`
+	Summary   *atomText  `xml:"summary,omitempty"`
+}
+
+type atomAuthor struct {
+	Name  string `xml:"name"`
+	Email string `xml:"email,omitempty"`
+}
+
+type atomText struct {
+	Type string `xml:"type,attr"`
+	Body string `xml:",chardata"`
+}
+
+// WriteFeed writes an Atom feed of the most recent fork commits to w, newest first, for subscribers to follow the fork.
+// The entries link to the page at pageLink, which may be relative to the feed.
+// When grouping by commit, the entries link to the changes of the commit on the page,
+// and only the commits on the page are listed.
+func (r *Result) WriteFeed(w io.Writer, pageLink string) error {
+	type feedCommit struct {
+		CommitChanges
+		anchor string
+	}
+	var commits []feedCommit
+	if r.Options.GroupBy == "commit" {
+		for _, c := range r.Page.Commits {
+			commits = append(commits, feedCommit{CommitChanges: c, anchor: c.Def.ID})
+		}
+	} else {
+		all, err := forkCommits(r.BaseCommit, r.ForkCommit)
+		if err != nil {
+			return err
+		}
+		for _, c := range all {
+			_, message, _ := strings.Cut(c.Message, "\n")
+			commits = append(commits, feedCommit{CommitChanges: CommitChanges{
+				Commit:  c,
+				Message: strings.TrimSpace(message),
+			}})
+		}
+	}
+	if len(commits) > maxFeedEntries {
+		commits = commits[len(commits)-maxFeedEntries:]
+	}
+
+	forkURL := r.Page.Fork.URL
+	feed := atomFeed{
+		Title:   r.Page.Title,
+		ID:      forkURL,
+		Updated: r.ForkCommit.Committer.When.UTC().Format(time.RFC3339),
+		Links:   []atomLink{{Href: pageLink}},
+	}
+	if feed.ID == "" {
+		feed.ID = "urn:forkdiff:" + url.PathEscape(r.Page.Fork.Name)
+	}
+	// newest first
+	for i := len(commits) - 1; i >= 0; i-- {
+		c := commits[i]
+		subject, _, _ := strings.Cut(c.Commit.Message, "\n")
+		entry := atomEntry{
+			Title:     subject,
+			ID:        "urn:sha1:" + c.Commit.Hash.String(),
+			Updated:   c.Commit.Committer.When.UTC().Format(time.RFC3339),
+			Published: c.Commit.Author.When.UTC().Format(time.RFC3339),
+			Author:    atomAuthor{Name: c.Commit.Author.Name, Email: c.Commit.Author.Email},
+		}
+		link := pageLink
+		if c.anchor != "" {
+			link += "#" + c.anchor
+		}
+		entry.Links = append(entry.Links, atomLink{Href: link})
+		if forkURL != "" {
+			entry.Links = append(entry.Links, atomLink{Href: forkURL + "/commit/" + c.Commit.Hash.String(), Rel: "related"})
+		}
+		if c.Message != "" {
+			entry.Summary = &atomText{Type: "text", Body: c.Message}
+		}
+		feed.Entries = append(feed.Entries, entry)
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(feed); err != nil {
+		return fmt.Errorf("failed to encode feed: %w", err)
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
@@ -0,0 +1,94 @@
+package forkdiff
+
+import (
+	"errors"
+	"fmt"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"strings"
+)
+
+// fetchBase fetches the base ref from the Options.FetchRemote, so the diff is against the current upstream.
+// The ref must be a remote-tracking branch of that remote, or a tag. It may be a pattern with a single "*".
+func fetchBase(opts *Options, rr *RefRepo) error {
+	if rr.Ref == "" {
+		return errors.New("only a base ref can be fetched, not a hash")
+	}
+	spec, err := fetchRefSpec(opts.FetchRemote, rr.Ref)
+	if err != nil {
+		return err
+	}
+	if opts.FetchAuth != nil {
+		if err := checkFetchAuthURL(opts.Repo, opts.FetchRemote); err != nil {
+			return err
+		}
+	}
+	var before plumbing.Hash
+	if !isRefPattern(rr.Ref) {
+		if ref, err := opts.Repo.Reference(plumbing.ReferenceName(rr.Ref), true); err == nil {
+			before = ref.Hash()
+		}
+	}
+	err = opts.Repo.Fetch(&git.FetchOptions{
+		RemoteName: opts.FetchRemote,
+		RefSpecs:   []config.RefSpec{spec},
+		Auth:       opts.FetchAuth,
+		Tags:       git.NoTags,
+	})
+	if errors.Is(err, git.NoErrAlreadyUpToDate) {
+		opts.logf("base ref %q is up to date with remote %q\n", rr.Ref, opts.FetchRemote)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to fetch %q from remote %q: %w", spec, opts.FetchRemote, err)
+	}
+	if isRefPattern(rr.Ref) {
+		opts.logf("fetched %q from remote %q\n", spec, opts.FetchRemote)
+		return nil
+	}
+	ref, err := opts.Repo.Reference(plumbing.ReferenceName(rr.Ref), true)
+	if err != nil {
+		return fmt.Errorf("failed to find fetched git ref %q: %w", rr.Ref, err)
+	}
+	if before.IsZero() {
+		opts.logf("fetched base ref %q from remote %q: %s\n", rr.Ref, opts.FetchRemote, ref.Hash())
+	} else {
+		opts.logf("fetched base ref %q from remote %q: %s -> %s\n", rr.Ref, opts.FetchRemote, before, ref.Hash())
+	}
+	return nil
+}
+
+// checkFetchAuthURL returns an error if the remote has a URL over which credentials would be sent unencrypted.
+func checkFetchAuthURL(repo *git.Repository, remoteName string) error {
+	remote, err := repo.Remote(remoteName)
+	if err != nil {
+		return fmt.Errorf("failed to find remote %q: %w", remoteName, err)
+	}
+	for _, u := range remote.Config().URLs {
+		lower := strings.ToLower(u)
+		if strings.HasPrefix(lower, "http://") || strings.HasPrefix(lower, "git://") {
+			return fmt.Errorf("refusing to send the fetch credentials to remote %q over the unencrypted URL %q", remoteName, u)
+		}
+	}
+	return nil
+}
+
+// fetchRefSpec returns the refspec to update the given local ref from the remote.
+// Local branches are not fetched into, since they may be checked out.
+func fetchRefSpec(remote string, ref string) (config.RefSpec, error) {
+	var spec config.RefSpec
+	trackingPrefix := "refs/remotes/" + remote + "/"
+	switch {
+	case strings.HasPrefix(ref, trackingPrefix):
+		spec = config.RefSpec("+refs/heads/" + strings.TrimPrefix(ref, trackingPrefix) + ":" + ref)
+	case strings.HasPrefix(ref, "refs/tags/"):
+		spec = config.RefSpec("+" + ref + ":" + ref)
+	default:
+		return "", fmt.Errorf("cannot fetch %q: only refs under %q, and tags, can be fetched", ref, trackingPrefix)
+	}
+	if err := spec.Validate(); err != nil {
+		return "", fmt.Errorf("cannot fetch %q: %w", ref, err)
+	}
+	return spec, nil
+}
@@ -0,0 +1,32 @@
+package forkdiff
+
+import (
+	"github.com/go-git/go-git/v5/config"
+	"testing"
+)
+
+func TestCheckFetchAuthURL(t *testing.T) {
+	repo := newTestRepo(t)
+	remotes := map[string]string{
+		"https":  "https://github.com/example/greeter.git",
+		"ssh":    "git@github.com:example/greeter.git",
+		"http":   "http://example.com/greeter.git",
+		"git":    "git://example.com/greeter.git",
+		"upper":  "HTTP://example.com/greeter.git",
+		"local":  "/srv/git/greeter.git",
+		"scheme": "ssh://git@example.com/greeter.git",
+	}
+	for name, u := range remotes {
+		if _, err := repo.CreateRemote(&config.RemoteConfig{Name: name, URLs: []string{u}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for name, wantErr := range map[string]bool{"https": false, "ssh": false, "local": false, "scheme": false, "http": true, "git": true, "upper": true} {
+		if err := checkFetchAuthURL(repo, name); (err != nil) != wantErr {
+			t.Errorf("remote %q (%s): got error %v, want error: %v", name, remotes[name], err, wantErr)
+		}
+	}
+	if err := checkFetchAuthURL(repo, "missing"); err == nil {
+		t.Error("expected an error for a missing remote")
+	}
+}
@@ -0,0 +1,85 @@
+package forkdiff
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// FileDiff renders the diff of a single file between the base and fork, without a page definition.
+// The diff is rendered as HTML, or as plain unified diff if plain is true.
+// Only the repository, MaxFileSize, RenameThreshold, Context, Blame, Prefix, TabWidth, ExpandTabs and ShowWhitespace
+// of the options are used.
+func FileDiff(opts *Options, base, fork RefRepo, path string, plain bool) (string, error) {
+	if opts.Repo == nil {
+		return "", &ConfigError{Err: errors.New("no git repository")}
+	}
+	switch opts.Prefix {
+	case "", "name", "a/b", "none":
+	default:
+		return "", &ConfigError{Err: fmt.Errorf("unknown diff prefix %q", opts.Prefix)}
+	}
+	if opts.RenameThreshold < 0 || opts.RenameThreshold > 100 {
+		return "", &ConfigError{Err: fmt.Errorf("invalid rename threshold %d, must be a percentage", opts.RenameThreshold)}
+	}
+	if opts.Context < 0 {
+		return "", &ConfigError{Err: fmt.Errorf("invalid context %d", opts.Context)}
+	}
+	if opts.Context == 0 {
+		opts.Context = DefaultContext
+	}
+	if base.Name == "" {
+		base.Name = "a"
+	}
+	if fork.Name == "" {
+		fork.Name = "b"
+	}
+	r := &Result{Options: opts, Page: &Page{Base: base, Fork: fork}}
+	var err error
+	r.BaseCommit, err = findCommit(opts, &base)
+	if err != nil {
+		return "", fmt.Errorf("failed to find base commit: %w", err)
+	}
+	r.BaseTree, err = r.BaseCommit.Tree()
+	if err != nil {
+		return "", fmt.Errorf("failed to open base git tree: %w", err)
+	}
+	r.ForkCommit, err = findCommit(opts, &fork)
+	if err != nil {
+		return "", fmt.Errorf("failed to find fork commit: %w", err)
+	}
+	r.ForkTree, err = r.ForkCommit.Tree()
+	if err != nil {
+		return "", fmt.Errorf("failed to open fork git tree: %w", err)
+	}
+	patches, err := ComputePatches(context.Background(), r.BaseTree, r.ForkTree, opts.MaxFileSize, opts.RenameThreshold)
+	if err != nil {
+		return "", err
+	}
+	r.baseFiles = patches.BaseFiles
+	r.forkFiles = patches.ForkFiles
+
+	name := path
+	fp, ok := patches.ByName[path]
+	if !ok {
+		// patches of renamed files are keyed by their fork path
+		// in sorted order, so a file that was copied to multiple paths always resolves to the same one
+		for _, k := range sortedPatchNames(patches.ByName) {
+			if from, _ := patches.ByName[k].Files(); from != nil && from.Path() == path {
+				name, fp, ok = k, patches.ByName[k], true
+				break
+			}
+		}
+	}
+	if !ok {
+		return "", fmt.Errorf("file %q is not changed between base %s and fork %s", path, r.BaseCommit.Hash, r.ForkCommit.Hash)
+	}
+	fps := &FilePatchStats{Path: name, Patch: fp}
+	if plain {
+		return r.encodePatch(fps, false)
+	}
+	if opts.Blame {
+		r.blames = newBlameCache(opts.Repo, r.ForkCommit)
+	}
+	return r.renderPatch(fps)
+}
@@ -0,0 +1,146 @@
+package forkdiff
+
+import (
+	"sort"
+	"strings"
+)
+
+// FileTreeNode is a directory or file in the tree of changed files.
+type FileTreeNode struct {
+	Name string
+	Path string
+	// Status is "added", "removed" or "modified" for files, and empty for directories.
+	Status string
+	// ID is the anchor of the file diff, empty for directories.
+	ID string
+	// Heat is the step of the color scale of the file with Options.Heatmap, from 1 to heatLevels,
+	// or 0 if it is not tinted, and HeatTitle describes the intensity of the changes.
+	Heat      int
+	HeatTitle string
+	Children  []*FileTreeNode
+}
+
+// buildFileTree builds a tree of directories from the changed file paths.
+// Only directories that contain changed files are part of the tree. Names are ordered with less.
+// The anchors of the files start with idPrefix, see Options.AnchorPrefix.
+func buildFileTree(paths []string, baseFiles, forkFiles map[string]struct{}, less func(a, b string) bool, idPrefix string) *FileTreeNode {
+	root := &FileTreeNode{}
+	for _, p := range paths {
+		node := root
+		parts := strings.Split(p, "/")
+		for i, part := range parts[:len(parts)-1] {
+			var dir *FileTreeNode
+			for _, c := range node.Children {
+				if c.Status == "" && c.Name == part {
+					dir = c
+					break
+				}
+			}
+			if dir == nil {
+				dir = &FileTreeNode{Name: part, Path: strings.Join(parts[:i+1], "/")}
+				node.Children = append(node.Children, dir)
+			}
+			node = dir
+		}
+		status := "modified"
+		if _, ok := baseFiles[p]; !ok {
+			status = "added"
+		} else if _, ok := forkFiles[p]; !ok {
+			status = "removed"
+		}
+		node.Children = append(node.Children, &FileTreeNode{
+			Name:   parts[len(parts)-1],
+			Path:   p,
+			Status: status,
+			ID:     idPrefix + anchorID("file", p),
+		})
+	}
+	root.sort(less)
+	return root
+}
+
+// sort orders the children of the node, directories first, and then by name.
+func (n *FileTreeNode) sort(less func(a, b string) bool) {
+	sort.Slice(n.Children, func(i, j int) bool {
+		a, b := n.Children[i], n.Children[j]
+		if (a.Status == "") != (b.Status == "") {
+			return a.Status == ""
+		}
+		return less(a.Name, b.Name)
+	})
+	for _, c := range n.Children {
+		c.sort(less)
+	}
+}
+
+// DirTree is a directory of the files that a section claims with ForkDefinition.Dirs.
+type DirTree struct {
+	// Name is the path of the directory relative to the parent directory,
+	// or the full path for the top directory of a Dirs entry.
+	Name string
+	Path string
+	// Dirs are the sub-directories with files, in the order of their first file.
+	Dirs []*DirTree
+	// Files are the files directly in the directory, in the order of the section.
+	Files []*FilePatchStats
+	// FileCount, LinesAdded and LinesDeleted are the totals of the directory, including all sub-directories.
+	FileCount    int
+	LinesAdded   int
+	LinesDeleted int
+}
+
+// add adds a file to the tree, at the path of parts relative to the directory.
+func (t *DirTree) add(fps *FilePatchStats, parts []string) {
+	t.FileCount++
+	t.LinesAdded += fps.LinesAdded
+	t.LinesDeleted += fps.LinesDeleted
+	if len(parts) == 1 {
+		t.Files = append(t.Files, fps)
+		return
+	}
+	for _, d := range t.Dirs {
+		if d.Name == parts[0] {
+			d.add(fps, parts[1:])
+			return
+		}
+	}
+	d := &DirTree{Name: parts[0], Path: t.Path + "/" + parts[0]}
+	t.Dirs = append(t.Dirs, d)
+	d.add(fps, parts[1:])
+}
+
+// buildDirTrees sets the DirTrees and LooseFiles of this definition and its sub-definitions, from their files.
+// The files must be sorted already. A file is placed in the tree of the first of the Dirs that it is under.
+// If foldCase, the directories match regardless of case, and are named like the path of their first file.
+func (fd *ForkDefinition) buildDirTrees(foldCase bool) {
+	fd.DirTrees, fd.LooseFiles = nil, nil
+	if len(fd.Dirs) > 0 {
+		trees := make([]*DirTree, len(fd.Dirs))
+	files:
+		for i := range fd.Files {
+			fps := &fd.Files[i]
+			for j, dir := range fd.Dirs {
+				// the dirs were checked when the files were claimed
+				prefix, err := dirPrefix(dir)
+				if err != nil || !matchDir(prefix, fps.Path, foldCase) {
+					continue
+				}
+				if trees[j] == nil {
+					name := fps.Path[:len(prefix)-1]
+					trees[j] = &DirTree{Name: name, Path: name}
+				}
+				trees[j].add(fps, strings.Split(fps.Path[len(prefix):], "/"))
+				continue files
+			}
+			fd.LooseFiles = append(fd.LooseFiles, fps)
+		}
+		for _, t := range trees {
+			if t != nil {
+				fd.DirTrees = append(fd.DirTrees, t)
+			}
+		}
+	}
+	for _, sub := range fd.Sub {
+		sub.buildDirTrees(foldCase)
+	}
+}
@@ -0,0 +1,83 @@
+package forkdiff
+
+import (
+	"fmt"
+	"strings"
+)
+
+// lineIndent returns the width of the leading whitespace of the content of a diff line, after the diff marker,
+// with tabs up to the next tab stop of tabWidth. It is -1 for a line of only whitespace.
+func lineIndent(content string, tabWidth int) int {
+	width := 0
+	for _, c := range content {
+		switch c {
+		case ' ':
+			width++
+		case '\t':
+			width += tabWidth - width%tabWidth
+		case '\r':
+		default:
+			return width
+		}
+	}
+	return -1
+}
+
+// foldIndentLines adds fold controls to the lines of a rendered diff, see Options.FoldIndent: every line is wrapped
+// in a "fold-line" span with its indentation, and the lines that are followed by deeper indented lines within
+// the same hunk get a control that hides those lines. Blank lines take the indentation of the next line,
+// so they fold with the block they are in. The hunk headers and other lines outside the hunks have no indentation,
+// they bound the folds. The rendered lines correspond to the lines of the encoded diff, like in labelDiffLines.
+// If they do not, the rendered diff is returned as-is.
+func foldIndentLines(encoded string, rendered []byte, inHunk bool, tabWidth int) []byte {
+	if tabWidth <= 0 {
+		tabWidth = 8
+	}
+	lines := strings.Split(strings.TrimSuffix(encoded, "\n"), "\n")
+	trimmed := strings.TrimSuffix(string(rendered), "\n")
+	renderedLines := strings.Split(trimmed, "\n")
+	if len(lines) != len(renderedLines) {
+		return rendered
+	}
+	// -2 marks the lines that bound the folds
+	indents := make([]int, len(lines))
+	for i, line := range lines {
+		plain := ansiEscapeRegexp.ReplaceAllString(line, "")
+		if class := diffLineClass(plain, &inHunk); class == "diff-hunk" || class == "diff-meta" || plain == "" {
+			indents[i] = -2
+			continue
+		}
+		indents[i] = lineIndent(plain[1:], tabWidth)
+	}
+	next := -2
+	for i := len(indents) - 1; i >= 0; i-- {
+		switch indents[i] {
+		case -2:
+			next = -2
+		case -1:
+			indents[i] = next
+		default:
+			next = indents[i]
+		}
+	}
+	var out strings.Builder
+	for i, line := range renderedLines {
+		indent := indents[i]
+		if indent == -2 {
+			out.WriteString(`<span class="fold-line" data-indent="-1">`)
+		} else {
+			out.WriteString(fmt.Sprintf(`<span class="fold-line" data-indent="%d">`, indent))
+		}
+		if indent >= 0 && i+1 < len(indents) && indents[i+1] > indent {
+			out.WriteString(`<span class="fold-toggle" role="button" tabindex="0" aria-expanded="true" title="fold the lines that are indented deeper">▾</span>`)
+		} else {
+			out.WriteString(`<span class="fold-gutter"></span>`)
+		}
+		out.WriteString(line)
+		if i < len(renderedLines)-1 || len(trimmed) < len(rendered) {
+			out.WriteString("\n")
+		}
+		out.WriteString("</span>")
+	}
+	return []byte(out.String())
+}
@@ -0,0 +1,1368 @@
+// Package forkdiff diffs a git fork against its base, structures the diff into sections
+// as described by a fork page definition, and renders it as HTML page.
+package forkdiff
+
+import (
+	"bytes"
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	t2html "github.com/buildkite/terminal-to-html/v3"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/format/diff"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/storage/memory"
+	"io"
+	"math"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+)
+
+//go:embed page.gohtml
+var page embed.FS
+
+// Options configures the analysis and rendering of a fork diff.
+type Options struct {
+	// Repo is the git repository that contains the base and fork commits.
+	Repo *git.Repository
+	// Page is the fork page definition. It is hydrated with the analysis results.
+	Page *Page
+	// BaseRef overrides the base ref of the page definition, if not empty.
+	// This may be a glob pattern, to select the highest matching ref, or EmptyBaseRef to diff against an empty tree.
+	BaseRef string
+	// Range is a git revision range of the base and fork, instead of the refs of the page definition, if not empty:
+	// "A..B" diffs B against A, and "A...B" diffs B against the merge base of A and B.
+	Range string
+	// FetchRemote is the name of a remote to fetch the base ref from before diffing, if not empty.
+	FetchRemote string
+	// FetchAuth is the authentication for fetching, it may be nil. It is only sent to remotes with an https URL,
+	// or another transport with its own encryption like ssh, not to plain http or git:// remotes.
+	FetchAuth transport.AuthMethod
+	// Baseline is an optional previous page definition, to compare the categorization of the changes with.
+	Baseline *Page
+	// MaxFileSize is the size limit of files to diff, 0 to disable.
+	MaxFileSize int64
+	// RenameThreshold is the similarity, in percent, that a deleted and an added file need to be diffed as a rename,
+	// like the -M option of git. 0 uses the DefaultRenameThreshold, 100 only pairs identical files.
+	RenameThreshold int
+	// NaturalSort orders the file paths naturally, comparing numbers by value, so "file2" comes before "file10".
+	NaturalSort bool
+	// Extensions restricts the diff to the files with these extensions (with or without leading dot), if not empty.
+	// The files with other extensions are dropped before they are assigned to sections.
+	Extensions []string
+	// MaxDepth is the maximum nesting depth of the fork definitions, DefaultMaxDepth if 0.
+	MaxDepth int
+	// GlobCaseInsensitive matches the globs of the page definition regardless of case,
+	// like setting Page.GlobCaseInsensitive.
+	GlobCaseInsensitive bool
+	// MultipleSections allows a file to be claimed by multiple sections, instead of failing.
+	// The file is listed in every section that claims it, but only counted once in the totals.
+	MultipleSections bool
+	// ChangeKinds restricts the diff to the files with these kinds of change: "add", "modify" and/or "delete",
+	// if not empty. Like Extensions, this is applied before the files are assigned to sections.
+	ChangeKinds []string
+	// Author restricts the diff to the files that were last changed by the fork commits of the author
+	// with this e-mail address, case-insensitively, if not empty. Like Extensions, this is applied before
+	// the files are assigned to sections. When grouping by commit, only the commits of the author are listed.
+	Author string
+	// SkipGenerated moves the files that are generated in the fork, see GeneratedMarker, out of the sections,
+	// to the "Generated files" part of the ignored changes. Like Extensions, this is applied before the files are assigned.
+	SkipGenerated bool
+	// GeneratedMarker is the regular expression of the line that marks a generated file, in the start of the file.
+	// DefaultGeneratedMarker is used if it is empty.
+	GeneratedMarker string
+	// Textconv applies the textconv filters of the page definition, which run external commands.
+	// Without it, the filters are not applied, since the definition may not be trusted, and a note is logged.
+	Textconv bool
+	// Sort is the order of the files within a section: "path" (default), "last-modified",
+	// or "first-added", by the first fork commit that changed the file, oldest first, see firstFileCommits.
+	Sort string
+	// Mode is "full" (default) to render the diffs, or "summary" to only list the changed files.
+	Mode string
+	// GroupBy is "file" (default) to list the changes by section, or "commit" to list the changes
+	// of each fork commit instead, oldest first, like a patch series.
+	GroupBy string
+	// Merges is "skip" (default) to leave out merge commits when grouping by commit,
+	// or "first-parent" to show their changes against the first parent.
+	Merges string
+	// NoRemaining drops the changes that are not claimed by any section from the page.
+	NoRemaining bool
+	// AutoSection groups the changes that are not claimed by any section into generated sections,
+	// by the first AutoSection directories of their paths, after the sections of the definition.
+	// The files outside of any directory remain in a single section. 0 (default) keeps all of them in that section.
+	AutoSection int
+	// MarkdownUnsafe passes raw HTML in the markdown descriptions and footer through as-is.
+	// By default raw HTML is escaped, and links are restricted to safe protocols.
+	MarkdownUnsafe bool
+	// Blame annotates the hunks of the diffs with the fork commits that introduced the added lines.
+	// This is expensive, the blame of each file is computed once.
+	Blame bool
+	// ShowNotes renders the git notes (refs/notes/commits) of the commits that the hunks are annotated with,
+	// or of the commits that the changes are grouped by. It requires Blame or grouping by commit.
+	ShowNotes bool
+	// Format is "html" (default) to render an HTML page, "text" for a plain-text report,
+	// "github-suggestions" for the changed lines as GitHub review suggestions, see renderSuggestions,
+	// "tree-diff" for only the directories that were added, removed and renamed, see renderTreeDiff,
+	// or "json" for the sections, files and line counts as JSON, see Report.
+	Format string
+	// Color renders the diffs of the plain-text report with ANSI colors.
+	Color bool
+	// Since is a previous fork commit (hash or ref). The files and hunks that changed since that commit are marked,
+	// to show what is new on a page that is regenerated regularly. Disabled if empty.
+	Since string
+	// Upstream is a newer upstream commit (hash or ref). The changes between the base and upstream are listed
+	// by section, marking the files that the fork changed too, which may conflict when merging upstream. Disabled if empty.
+	Upstream string
+	// Divergence counts how many commits the fork is ahead of and behind the base, from their merge base,
+	// and renders that near the top of the page. This walks the full history of both commits.
+	Divergence bool
+	// Contributors lists the authors of the fork commits near the top of the page, with the co-authors
+	// of their "Co-authored-by" trailers, each person once. This walks the full history of the fork, like Divergence.
+	Contributors bool
+	// ShowTrailers shows the trailers of the commit messages, like "Signed-off-by", as a list under each commit,
+	// instead of as part of the message. It requires grouping by commit.
+	ShowTrailers bool
+	// MaxLineLength truncates the lines of the diffs in the HTML page that are longer than MaxLineLength characters,
+	// with a marker that shows the rest of the line when clicked, 0 to disable. The file header lines are not truncated.
+	MaxLineLength int
+	// MaxHunks collapses the hunks of a file beyond the first MaxHunks behind a control to show them, 0 to disable.
+	// The collapsed hunks are still part of the page.
+	MaxHunks int
+	// Top renders the diffs of only the Top files with the most changed lines, 0 to render all.
+	// The other files are listed, with their stats, but without diff.
+	Top int
+	// Context is the number of unchanged lines around the changes in the diffs, DefaultContext if 0.
+	// Sections of the page definition may override it, see ForkDefinition.Context.
+	Context int
+	// CollapseContext collapses the runs of more than CollapseContext unchanged lines within a hunk
+	// behind a control to show them, 0 to disable. The collapsed lines are still part of the page.
+	CollapseContext int
+	// Prefix is the prefix of the paths in the diff headers: "name" (default) for the names of the base and fork,
+	// "a/b" for the git default "a/" and "b/", or "none" for no prefix.
+	Prefix string
+	// TabWidth is the width of a tab in the diffs of the HTML page, in spaces. 0 leaves it to the browser (8).
+	TabWidth int
+	// ExpandTabs replaces the tabs in the diffs with spaces, up to the next tab stop of TabWidth,
+	// for a precise alignment of mixed tab and space indentation. Tab stops are every 8 columns if TabWidth is 0.
+	ExpandTabs bool
+	// ShowWhitespace makes the spaces, tabs and other whitespace of the added and removed lines of the HTML diffs visible,
+	// and marks their trailing whitespace, see markWhitespace.
+	ShowWhitespace bool
+	// NoColor renders the diffs of the HTML page without colors, as plain markup with a CSS class per kind of line,
+	// so a stylesheet has full control over the coloring. See renderPlainDiff for the classes.
+	NoColor bool
+	// DiffColors pins the colors of kinds of diff lines on the HTML page, by role: "add", "delete", "hunk" (header)
+	// and "meta" (file header), to hex colors like "#7ee787" or color names, so they match the theme of the page.
+	// They apply to both the colored and the NoColor diffs.
+	DiffColors map[string]string
+	// MaxTotalSize is the maximum size of a rendered page in bytes, 0 to disable.
+	// Once a diff would not fit anymore, it and all diffs after it are omitted, the page is still complete otherwise.
+	MaxTotalSize int64
+	// Fragment renders only the page content, without the HTML document, styling and scripts around it,
+	// to embed it in another page. The host page then has to provide the styling.
+	Fragment bool
+	// Minify minifies the HTML page, see minifyHTML, to reduce the transfer size of hosted pages.
+	// The whitespace of the diffs and other preformatted content is kept. Other formats are not minified.
+	Minify bool
+	// Favicon overrides the Page.Favicon, as a data URI or URL, see LoadFavicon, if not empty.
+	Favicon string
+	// MetaDescription overrides the Page.MetaDescription, if not empty.
+	MetaDescription string
+	// LastChanged shows the latest commit of the fork history that changed each file, in the header of the file,
+	// linked if the fork has a URL. This walks the fork history once for all files, until each is found.
+	LastChanged bool
+	// FoldIndent adds controls to the lines of the diffs that are followed by deeper indented lines,
+	// to fold those lines, like the body of a function, see foldIndentLines. This is experimental:
+	// it only relies on the indentation of the lines, so it does not need to know the language.
+	FoldIndent bool
+	// DataAttrs adds data attributes with the path, the added and deleted lines, and the status
+	// ("added", "modified" or "removed") to the element of each file, for client scripts to sort and filter by.
+	DataAttrs bool
+	// NoEmoji renders emoji shortcodes like ":rocket:" in the markdown as they are, instead of as their emoji.
+	NoEmoji bool
+	// MarkdownWorkers is the number of markdown descriptions, footers and comments that are rendered concurrently
+	// before the HTML page is built. 0 uses GOMAXPROCS, 1 renders them one by one while building the page.
+	MarkdownWorkers int
+	// Previews embeds a preview of the first hunk of every file in the tree of changed files,
+	// that scripts show while hovering over or focusing the file.
+	Previews bool
+	// Heatmap tints the files in the tree of changed files by the intensity of their changes, see changeIntensity,
+	// on a scale of a single hue, from light to dark, to be readable with any color vision.
+	Heatmap bool
+	// EmbedDefinition shows the YAML of the fork page definition, as ReadPage read it, in a collapsed block
+	// at the bottom of the HTML page, to document how the page was configured.
+	EmbedDefinition bool
+	// ShowGlobs shows the globs and dirs that claim the files of each section under its heading,
+	// and the ignore globs of the page under that of the ignored changes, to audit why a file is in a section.
+	ShowGlobs bool
+	// AnchorPrefix is prepended to the HTML anchors of the sections and files,
+	// to keep them unique when multiple pages are combined in one document, like with RenderTargets.
+	AnchorPrefix string
+	// Strict makes Generate fail if there are changes that are not claimed by any section,
+	// or references of the page definition that match nothing, see CheckStrict.
+	Strict bool
+	// Log receives informational messages, it may be nil.
+	Log io.Writer
+}
+
+func (opts *Options) logf(format string, args ...any) {
+	if opts.Log != nil {
+		_, _ = fmt.Fprintf(opts.Log, format, args...)
+	}
+}
+
+// Result is an analyzed fork diff, ready to be rendered.
+type Result struct {
+	Options    *Options
+	Page       *Page
+	BaseCommit *object.Commit
+	ForkCommit *object.Commit
+	BaseTree   *object.Tree
+	ForkTree   *object.Tree
+
+	patchByName map[string]diff.FilePatch
+	baseFiles   map[string]struct{}
+	forkFiles   map[string]struct{}
+	remaining   map[string]struct{}
+	// remainingDef is the section of the changes that are not claimed by any section, if it is on the page.
+	remainingDef *ForkDefinition
+	// textconv converts the files of the textconv filters, nil if they are not applied.
+	textconv *textconv
+	blames   *blameCache
+	notes    *notesReader
+	since    *SinceChanges
+	// templateData is the data of the templates in the titles, descriptions and footer.
+	templateData *TemplateData
+	// markdownHTML is the rendered markdown by source, see prerenderMarkdown.
+	markdownHTML map[string]string
+	// truncated is set once a rendered page reached the MaxTotalSize.
+	truncated bool
+	// stale are the problems of the path references of the page definition that match nothing, with Options.Strict.
+	stale []string
+}
+
+// Generate analyzes the fork diff and renders the HTML page.
+func Generate(opts Options) ([]byte, error) {
+	res, err := Analyze(&opts)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Strict {
+		if err := res.CheckStrict(); err != nil {
+			return nil, err
+		}
+	}
+	var out bytes.Buffer
+	if err := res.Render(&out, res.Page); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// check validates the options and the page definition, and sets the defaults.
+func (opts *Options) check() error {
+	if opts.Repo == nil {
+		return errors.New("no git repository")
+	}
+	if opts.Page == nil || opts.Page.Def == nil {
+		return errors.New("no root fork definition defined")
+	}
+	if opts.MaxDepth == 0 {
+		opts.MaxDepth = DefaultMaxDepth
+	}
+	if err := opts.Page.Def.checkNesting(opts.MaxDepth, nil); err != nil {
+		return fmt.Errorf("invalid fork definition: %w", err)
+	}
+	if err := opts.Page.Def.checkContext(); err != nil {
+		return fmt.Errorf("invalid fork definition: %w", err)
+	}
+	if opts.Context < 0 {
+		return fmt.Errorf("invalid context %d", opts.Context)
+	}
+	if opts.Context == 0 {
+		opts.Context = DefaultContext
+	}
+	if err := opts.Page.checkSubmodules(); err != nil {
+		return fmt.Errorf("invalid submodules: %w", err)
+	}
+	if err := opts.Page.checkLanguages(); err != nil {
+		return fmt.Errorf("invalid language overrides: %w", err)
+	}
+	if err := opts.Page.checkComments(); err != nil {
+		return fmt.Errorf("invalid comments: %w", err)
+	}
+	if err := opts.Page.checkTextconv(); err != nil {
+		return fmt.Errorf("invalid textconv filters: %w", err)
+	}
+	if err := opts.checkDiffColors(); err != nil {
+		return err
+	}
+	switch opts.Sort {
+	case "":
+		opts.Sort = "path"
+	case "path", "last-modified", "first-added":
+	default:
+		return fmt.Errorf("unknown sort order %q", opts.Sort)
+	}
+	if opts.Format == "" {
+		opts.Format = "html"
+	} else if !IsFormat(opts.Format) {
+		return fmt.Errorf("unknown format %q", opts.Format)
+	}
+	switch opts.Mode {
+	case "":
+		opts.Mode = "full"
+	case "full", "summary":
+	default:
+		return fmt.Errorf("unknown mode %q", opts.Mode)
+	}
+	switch opts.GroupBy {
+	case "":
+		opts.GroupBy = "file"
+	case "file", "commit":
+	default:
+		return fmt.Errorf("unknown grouping %q", opts.GroupBy)
+	}
+	switch opts.Merges {
+	case "":
+		opts.Merges = "skip"
+	case "skip", "first-parent":
+	default:
+		return fmt.Errorf("unknown merge handling %q", opts.Merges)
+	}
+	switch opts.Prefix {
+	case "":
+		opts.Prefix = "name"
+	case "name", "a/b", "none":
+	default:
+		return fmt.Errorf("unknown diff prefix %q", opts.Prefix)
+	}
+	if opts.RenameThreshold < 0 || opts.RenameThreshold > 100 {
+		return fmt.Errorf("invalid rename threshold %d, must be a percentage", opts.RenameThreshold)
+	}
+	if opts.AutoSection < 0 {
+		return fmt.Errorf("invalid auto-section depth %d", opts.AutoSection)
+	}
+	if opts.AutoSection > 0 && opts.NoRemaining {
+		return errors.New("auto-sections cannot be generated when the unclaimed changes are not rendered")
+	}
+	if opts.MarkdownWorkers < 0 {
+		return fmt.Errorf("invalid number of markdown workers %d", opts.MarkdownWorkers)
+	}
+	if opts.TabWidth < 0 {
+		return fmt.Errorf("invalid tab width %d", opts.TabWidth)
+	}
+	if opts.MaxLineLength < 0 {
+		return fmt.Errorf("invalid maximum line length %d", opts.MaxLineLength)
+	}
+	if opts.MaxHunks < 0 {
+		return fmt.Errorf("invalid maximum number of hunks %d", opts.MaxHunks)
+	}
+	if opts.Top < 0 {
+		return fmt.Errorf("invalid number of top files %d", opts.Top)
+	}
+	if opts.Top > 0 && opts.GroupBy == "commit" {
+		return errors.New("top files are not supported when grouping by commit")
+	}
+	if opts.CollapseContext < 0 {
+		return fmt.Errorf("invalid number of unchanged lines to collapse %d", opts.CollapseContext)
+	}
+	if _, err := opts.generatedMarker(); err != nil {
+		return err
+	}
+	if opts.Range != "" {
+		if _, _, _, err := parseRange(opts.Range); err != nil {
+			return err
+		}
+		if opts.BaseRef != "" || opts.FetchRemote != "" {
+			return errors.New("a revision range cannot be used with a base ref or fetching the base")
+		}
+	}
+	if opts.FetchRemote != "" && (opts.BaseRef == EmptyBaseRef || opts.BaseRef == "" && opts.Page.Base.Ref == EmptyBaseRef) {
+		return errors.New("the empty base cannot be fetched")
+	}
+	if opts.GroupBy == "commit" && opts.Blame {
+		return errors.New("blame is not supported when grouping by commit")
+	}
+	if opts.ShowTrailers && opts.GroupBy != "commit" {
+		return errors.New("showing trailers requires grouping by commit, the trailers are shown with the commits")
+	}
+	if opts.ShowNotes && !opts.Blame && opts.GroupBy != "commit" {
+		return errors.New("showing notes requires blame or grouping by commit, the notes are shown with the commits")
+	}
+	return nil
+}
+
+// Analyze computes the diff between the base and fork, and assigns the changes to the sections of the page.
+func Analyze(opts *Options) (*Result, error) {
+	if err := opts.check(); err != nil {
+		return nil, &ConfigError{Err: err}
+	}
+	pageDefinition := opts.Page
+	if opts.GlobCaseInsensitive {
+		pageDefinition.GlobCaseInsensitive = true
+	}
+	if opts.Favicon != "" {
+		pageDefinition.Favicon = opts.Favicon
+	}
+	if opts.MetaDescription != "" {
+		pageDefinition.MetaDescription = opts.MetaDescription
+	}
+	if opts.BaseRef != "" {
+		pageDefinition.Base.Ref = opts.BaseRef
+		pageDefinition.Base.Hash = ""
+	}
+	if opts.Range != "" {
+		base, fork, err := resolveRange(opts, opts.Range)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve range %q: %w", opts.Range, err)
+		}
+		pageDefinition.Base.Ref, pageDefinition.Base.Hash = "", base.String()
+		pageDefinition.Fork.Ref, pageDefinition.Fork.Hash = "", fork.String()
+	}
+	res := &Result{Options: opts, Page: pageDefinition}
+
+	if opts.FetchRemote != "" {
+		if err := fetchBase(opts, &pageDefinition.Base); err != nil {
+			return nil, fmt.Errorf("failed to fetch base: %w", err)
+		}
+	}
+	var err error
+	res.BaseCommit, err = findCommit(opts, &pageDefinition.Base)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find base commit: %w", err)
+	}
+	res.BaseTree, err = res.BaseCommit.Tree()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open base git tree: %w", err)
+	}
+	res.ForkCommit, err = findCommit(opts, &pageDefinition.Fork)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find fork commit: %w", err)
+	}
+	res.ForkTree, err = res.ForkCommit.Tree()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open fork git tree: %w", err)
+	}
+
+	target := ShortRefName(pageDefinition.Fork.Ref)
+	if target == "" {
+		target = res.ForkCommit.Hash.String()[:7]
+	}
+	res.templateData = &TemplateData{
+		Base:   newTemplateRef(&pageDefinition.Base, res.BaseCommit),
+		Fork:   newTemplateRef(&pageDefinition.Fork, res.ForkCommit),
+		Target: target,
+		Date:   res.ForkCommit.Committer.When.Format("2006-01-02"),
+	}
+	// titles are expanded before the sections are matched and compared with the baseline, since both refer to titles
+	pageDefinition.Title, err = res.expandTemplate(pageDefinition.Title)
+	if err != nil {
+		return nil, &ConfigError{Err: fmt.Errorf("failed to expand page title: %w", err)}
+	}
+	if pageDefinition.Template {
+		if err := pageDefinition.Def.expandTitles(res.markdownFuncs(), res.templateData); err != nil {
+			return nil, &ConfigError{Err: err}
+		}
+	}
+	if err := res.checkTemplates(); err != nil {
+		return nil, err
+	}
+	if opts.Baseline != nil && opts.Baseline.Def != nil && opts.Baseline.Template {
+		if err := opts.Baseline.Def.expandTitles(res.markdownFuncs(), res.templateData); err != nil {
+			return nil, &ConfigError{Err: fmt.Errorf("invalid baseline fork definition: %w", err)}
+		}
+	}
+
+	patches, err := ComputePatches(context.Background(), res.BaseTree, res.ForkTree, opts.MaxFileSize, opts.RenameThreshold)
+	if err != nil {
+		return nil, err
+	}
+	res.baseFiles = patches.BaseFiles
+	res.forkFiles = patches.ForkFiles
+	res.textconv = newTextconv(opts)
+	if res.textconv != nil {
+		if err := res.textconv.convert(context.Background(), patches.ByName); err != nil {
+			return nil, err
+		}
+	}
+	if len(opts.Extensions) > 0 {
+		patches.ByName = filterExtensions(patches.ByName, opts.Extensions)
+	}
+	if len(opts.ChangeKinds) > 0 {
+		patches.ByName, err = filterChangeKinds(patches.ByName, opts.ChangeKinds)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if opts.Author != "" {
+		commits, err := forkCommits(res.BaseCommit, res.ForkCommit)
+		if err != nil {
+			return nil, err
+		}
+		authors, err := lastAuthors(commits)
+		if err != nil {
+			return nil, fmt.Errorf("failed to find the last authors of the files: %w", err)
+		}
+		patches.ByName = filterAuthor(patches.ByName, authors, opts.Author)
+	}
+	var generated map[string]diff.FilePatch
+	if opts.SkipGenerated {
+		marker, _ := opts.generatedMarker()
+		patches.ByName, generated, err = splitGenerated(opts.Repo, patches.ByName, marker)
+		if err != nil {
+			return nil, err
+		}
+	}
+	assignment, err := AssignSections(pageDefinition, patches.ByName, opts.MultipleSections)
+	if err != nil {
+		return nil, err
+	}
+	patchByName := assignment.Patches
+	pageDefinition.Def.hydrateClaims(patchByName, assignment.Claims)
+	ignored := assignment.Ignored
+	remaining := assignment.Remaining
+	if opts.Baseline != nil {
+		if opts.Baseline.Def == nil {
+			return nil, &ConfigError{Err: errors.New("no baseline root fork definition defined")}
+		}
+		if err := opts.Baseline.Def.checkNesting(opts.MaxDepth, nil); err != nil {
+			return nil, &ConfigError{Err: fmt.Errorf("invalid baseline fork definition: %w", err)}
+		}
+		structure, err := compareStructure(pageDefinition.Def, opts.Baseline.Def, patchByName, opts.MultipleSections, pageDefinition.GlobCaseInsensitive)
+		if err != nil {
+			return nil, &ConfigError{Err: fmt.Errorf("failed to compare with baseline page definition: %w", err)}
+		}
+		pageDefinition.StructureChanges = structure
+	}
+	if opts.NoRemaining {
+		// the unclaimed files are dropped from the page, but remain tracked for the strict check
+		for k := range remaining {
+			delete(patchByName, k)
+		}
+	} else if len(remaining) > 0 {
+		remainingDef := &ForkDefinition{
+			Title: "Other changes",
+			Level: 2,
+		}
+		autoDefs := make(map[string]*ForkDefinition)
+		var autoDirs []string
+		for _, k := range sortedKeys(remaining) {
+			dir := autoSectionDir(k, opts.AutoSection)
+			if dir == "" {
+				remainingDef.hydratePatch(k, patchByName[k])
+				continue
+			}
+			autoDef, ok := autoDefs[dir]
+			if !ok {
+				autoDef = &ForkDefinition{Title: dir + "/", Level: 2, Auto: true}
+				autoDefs[dir] = autoDef
+				autoDirs = append(autoDirs, dir)
+			}
+			autoDef.hydratePatch(k, patchByName[k])
+		}
+		sort.Strings(autoDirs)
+		for _, dir := range autoDirs {
+			autoDef := autoDefs[dir]
+			pageDefinition.Def.Sub = append(pageDefinition.Def.Sub, autoDef)
+			pageDefinition.Def.LinesAdded += autoDef.LinesAdded
+			pageDefinition.Def.LinesDeleted += autoDef.LinesDeleted
+			pageDefinition.Def.FileCount += autoDef.FileCount
+		}
+		if len(remainingDef.Files) > 0 {
+			pageDefinition.Def.Sub = append(pageDefinition.Def.Sub, remainingDef)
+			res.remainingDef = remainingDef
+			pageDefinition.Def.LinesAdded += remainingDef.LinesAdded
+			pageDefinition.Def.LinesDeleted += remainingDef.LinesDeleted
+			pageDefinition.Def.FileCount += remainingDef.FileCount
+		}
+	}
+	usedIDs := make(map[string]struct{})
+	pageDefinition.Def.assignIDs("", usedIDs)
+	if len(ignored) > 0 || len(generated) > 0 {
+		ignoredPaths := sortedPatchNames(ignored)
+		ignoredDef := &ForkDefinition{
+			Title: "Ignored changes",
+			Level: 4,
+		}
+		for _, k := range ignoredPaths {
+			ignoredDef.hydratePatch(k, ignored[k])
+		}
+		if len(generated) > 0 {
+			generatedDef := &ForkDefinition{
+				Title: "Generated files",
+				Level: 5,
+			}
+			for _, k := range sortedPatchNames(generated) {
+				generatedDef.hydratePatch(k, generated[k])
+			}
+			ignoredDef.Sub = append(ignoredDef.Sub, generatedDef)
+			ignoredDef.LinesAdded += generatedDef.LinesAdded
+			ignoredDef.LinesDeleted += generatedDef.LinesDeleted
+			ignoredDef.FileCount += generatedDef.FileCount
+		}
+		ignoredDef.assignIDs("", usedIDs)
+		pageDefinition.Ignored = ignoredDef
+	}
+	if opts.Strict {
+		paths, err := treePaths(res.BaseTree, res.ForkTree)
+		if err != nil {
+			return nil, err
+		}
+		if err := pageDefinition.Def.staleReferences(paths, pageDefinition.GlobCaseInsensitive, &res.stale); err != nil {
+			return nil, &ConfigError{Err: err}
+		}
+	}
+	for i, c := range pageDefinition.Comments {
+		_, onPage := patchByName[c.Path]
+		_, isIgnored := ignored[c.Path]
+		_, isGenerated := generated[c.Path]
+		if !onPage && !isIgnored && !isGenerated {
+			opts.logf("comment on %q is not rendered: the file is not on the page\n", c.Path)
+			if opts.Strict {
+				res.stale = append(res.stale, fmt.Sprintf("comment %d on %q: the file is not on the page", i, c.Path))
+			}
+		}
+	}
+
+	lessFiles := func(a, b *FilePatchStats) bool {
+		return res.lessPath(a.Path, b.Path)
+	}
+	paths := make(map[string]struct{}, len(patchByName)+len(ignored))
+	for k := range patchByName {
+		paths[k] = struct{}{}
+	}
+	for k := range ignored {
+		paths[k] = struct{}{}
+	}
+	var latest map[string]*object.Commit
+	if opts.Sort == "last-modified" || opts.LastChanged {
+		latest, err = latestFileCommits(res.ForkCommit, paths)
+		if err != nil {
+			return nil, fmt.Errorf("failed to find the latest commits of changed files: %w", err)
+		}
+	}
+	if opts.Sort == "last-modified" {
+		lessFiles = func(a, b *FilePatchStats) bool {
+			var ta, tb time.Time
+			if c, ok := latest[a.Path]; ok {
+				ta = c.Committer.When
+			}
+			if c, ok := latest[b.Path]; ok {
+				tb = c.Committer.When
+			}
+			if !ta.Equal(tb) {
+				return ta.After(tb)
+			}
+			return res.lessPath(a.Path, b.Path)
+		}
+	}
+	if opts.Sort == "first-added" {
+		commits, err := forkCommits(res.BaseCommit, res.ForkCommit)
+		if err != nil {
+			return nil, err
+		}
+		first, err := firstFileCommits(commits, paths)
+		if err != nil {
+			return nil, fmt.Errorf("failed to find the first commits of changed files: %w", err)
+		}
+		lessFiles = func(a, b *FilePatchStats) bool {
+			// files that no fork commit touched, like changes of the base after the fork, are last
+			ia, oka := first[a.Path]
+			ib, okb := first[b.Path]
+			if oka != okb {
+				return oka
+			}
+			if ia != ib {
+				return ia < ib
+			}
+			return res.lessPath(a.Path, b.Path)
+		}
+	}
+	pageDefinition.Def.sortFiles(lessFiles)
+	if pageDefinition.Ignored != nil {
+		pageDefinition.Ignored.sortFiles(lessFiles)
+	}
+	if opts.LastChanged {
+		setLastCommit := func(fps *FilePatchStats) {
+			fps.LastCommit = latest[fps.Path]
+		}
+		pageDefinition.Def.collectFiles(setLastCommit)
+		if pageDefinition.Ignored != nil {
+			pageDefinition.Ignored.collectFiles(setLastCommit)
+		}
+	}
+	pageDefinition.Def.buildDirTrees(pageDefinition.GlobCaseInsensitive)
+
+	res.patchByName = patchByName
+	res.remaining = remaining
+	if opts.Top > 0 {
+		pageDefinition.markTop(patchByName, opts.Top)
+	}
+	if opts.Blame {
+		res.blames = newBlameCache(opts.Repo, res.ForkCommit)
+	}
+	if opts.Since != "" {
+		res.since, err = res.compareSince(opts.Since)
+		if err != nil {
+			return nil, fmt.Errorf("failed to compare with the fork since %q: %w", opts.Since, err)
+		}
+		res.since.markPage(pageDefinition)
+		pageDefinition.Since = res.since
+	}
+	if opts.Divergence {
+		pageDefinition.Divergence, err = computeDivergence(res.BaseCommit, res.ForkCommit)
+		if err != nil {
+			return nil, fmt.Errorf("failed to compute divergence of fork and base: %w", err)
+		}
+	}
+	if opts.Contributors {
+		commits, err := forkCommits(res.BaseCommit, res.ForkCommit)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list contributors of the fork: %w", err)
+		}
+		pageDefinition.Contributors = contributors(commits)
+	}
+	if opts.ShowNotes {
+		notes, err := newNotesReader(opts.Repo)
+		if err != nil {
+			return nil, err
+		}
+		res.notes = notes
+	}
+	if opts.GroupBy == "commit" {
+		// after reading the notes, which are shown with the commits
+		pageDefinition.Commits, err = res.groupByCommit(opts.Merges)
+		if err != nil {
+			return nil, fmt.Errorf("failed to group changes by commit: %w", err)
+		}
+	}
+	if opts.AnchorPrefix != "" {
+		pageDefinition.Def.prefixIDs(opts.AnchorPrefix)
+		if pageDefinition.Ignored != nil {
+			pageDefinition.Ignored.prefixIDs(opts.AnchorPrefix)
+		}
+		for _, c := range pageDefinition.Commits {
+			c.Def.prefixIDs(opts.AnchorPrefix)
+		}
+	}
+	if opts.Upstream != "" {
+		// after the anchor prefix, since the upstream changes link to the sections
+		pageDefinition.Upstream, err = res.compareUpstream(opts.Upstream)
+		if err != nil {
+			return nil, fmt.Errorf("failed to compare the base with upstream %q: %w", opts.Upstream, err)
+		}
+	}
+	return res, nil
+}
+
+// findCommit resolves the commit of a base or fork. The EmptyBaseRef ref resolves to the commit of emptyCommit.
+func findCommit(opts *Options, rr *RefRepo) (*object.Commit, error) {
+	repo := opts.Repo
+	if rr.Ref != "" && rr.Hash != "" {
+		return nil, errors.New("cannot use both hash and reference")
+	}
+	if rr.Ref == "" && rr.Hash == "" {
+		return nil, errors.New("need either hash or reference")
+	}
+	if rr.Ref == EmptyBaseRef {
+		return emptyCommit()
+	}
+	if rr.Ref != "" {
+		refName := plumbing.ReferenceName(rr.Ref)
+		if isRefPattern(rr.Ref) {
+			var err error
+			refName, err = resolveRefPattern(repo, rr.Ref)
+			if err != nil {
+				return nil, fmt.Errorf("failed to resolve git ref pattern %q: %w", rr.Ref, err)
+			}
+			opts.logf("resolved ref pattern %q to %q\n", rr.Ref, refName)
+		}
+		ref, err := resolveRef(repo, refName)
+		if err != nil {
+			return nil, fmt.Errorf("failed to find git ref %q: %w", refName, err)
+		}
+
+		hash := ref.Hash()
+		// annotated tags point to a tag object, not to the commit directly
+		if tag, err := repo.TagObject(hash); err == nil {
+			hash = tag.Target
+		}
+		commit, err := repo.CommitObject(hash)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open commit %s: %w", hash, err)
+		}
+		return commit, nil
+	}
+	commit, err := repo.CommitObject(plumbing.NewHash(rr.Hash))
+	if err != nil {
+		return nil, fmt.Errorf("failed to find commit hash %s: %w", rr.Hash, err)
+	}
+	return commit, nil
+}
+
+// EmptyBaseRef is the base ref that diffs the fork against an empty tree, so every file of the fork is an addition,
+// to present the complete fork, or a project that was not forked from anything, organized by the sections.
+const EmptyBaseRef = "empty"
+
+// emptyCommit returns a commit of the empty tree, without parents, author or date.
+// It is stored in memory, not in the repository, and its hash is always the same.
+func emptyCommit() (*object.Commit, error) {
+	storage := memory.NewStorage()
+	treeObj := storage.NewEncodedObject()
+	if err := (&object.Tree{}).Encode(treeObj); err != nil {
+		return nil, fmt.Errorf("failed to encode empty tree: %w", err)
+	}
+	treeHash, err := storage.SetEncodedObject(treeObj)
+	if err != nil {
+		return nil, fmt.Errorf("failed to store empty tree: %w", err)
+	}
+	commitObj := storage.NewEncodedObject()
+	if err := (&object.Commit{Message: "empty base\n", TreeHash: treeHash}).Encode(commitObj); err != nil {
+		return nil, fmt.Errorf("failed to encode empty base commit: %w", err)
+	}
+	commitHash, err := storage.SetEncodedObject(commitObj)
+	if err != nil {
+		return nil, fmt.Errorf("failed to store empty base commit: %w", err)
+	}
+	return object.GetCommit(storage, commitHash)
+}
+
+// maxSymbolicRefDepth is the maximum number of symbolic refs to follow, like go-git and git itself.
+const maxSymbolicRefDepth = 5
+
+// resolveRef resolves a ref to a hash reference, following symbolic refs like HEAD.
+// A detached HEAD is a hash reference already. A symbolic ref to a branch without commits,
+// like the HEAD of a new repository, gets a clear error.
+func resolveRef(repo *git.Repository, name plumbing.ReferenceName) (*plumbing.Reference, error) {
+	ref, err := repo.Reference(name, false)
+	if err != nil {
+		return nil, err
+	}
+	for i := 0; ref.Type() == plumbing.SymbolicReference; i++ {
+		if i == maxSymbolicRefDepth {
+			return nil, fmt.Errorf("more than %d symbolic refs from %q", maxSymbolicRefDepth, name)
+		}
+		target, err := repo.Reference(ref.Target(), false)
+		if errors.Is(err, plumbing.ErrReferenceNotFound) {
+			return nil, fmt.Errorf("%q points to %q, which has no commits yet", ref.Name(), ref.Target())
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve %q: %w", ref.Name(), err)
+		}
+		ref = target
+	}
+	return ref, nil
+}
+
+// Unclaimed returns the sorted paths of the changed files that are not claimed by any section.
+func (r *Result) Unclaimed() []string {
+	out := sortedKeys(r.remaining)
+	sort.SliceStable(out, func(i, j int) bool {
+		return r.lessPath(out[i], out[j])
+	})
+	return out
+}
+
+// lessPath orders paths, naturally if Options.NaturalSort is set, otherwise lexically.
+func (r *Result) lessPath(a, b string) bool {
+	if r.Options.NaturalSort {
+		return naturalLess(a, b)
+	}
+	return a < b
+}
+
+// CheckStrict returns an error if there are changed files that are not claimed by any section,
+// or, if the analysis was strict, section globs and dirs that match no file of the base or fork,
+// or comments on files that are not on the page. All problems are reported in the error.
+// The error is a ConfigError, since the page definition does not cover the fork.
+func (r *Result) CheckStrict() error {
+	var problems []string
+	if len(r.remaining) > 0 {
+		problems = append(problems, fmt.Sprintf("%d changed files are not claimed by any section", len(r.remaining)))
+	}
+	problems = append(problems, r.stale...)
+	switch len(problems) {
+	case 0:
+		return nil
+	case 1:
+		return &ConfigError{Err: errors.New(problems[0])}
+	}
+	return &ConfigError{Err: fmt.Errorf("%d problems:\n  %s", len(problems), strings.Join(problems, "\n  "))}
+}
+
+// IsEmpty returns true if there are no changed files, neither on the page nor ignored.
+func (r *Result) IsEmpty() bool {
+	return len(r.patchByName) == 0 && r.Page.Ignored == nil
+}
+
+// Incomplete returns true if diffs were left out of the rendered pages: of the files that are larger than
+// Options.MaxFileSize, or because a page reached Options.MaxTotalSize. The latter is only known after rendering.
+func (r *Result) Incomplete() bool {
+	if r.truncated {
+		return true
+	}
+	incomplete := false
+	r.Page.Def.collectFiles(func(fps *FilePatchStats) {
+		incomplete = incomplete || fps.TooLarge
+	})
+	return incomplete
+}
+
+// PrintDryRun writes the sections with the files they claim, and the files that are not rendered, to w.
+func (r *Result) PrintDryRun(w io.Writer) {
+	PrintDefinition(w, r.Page.Def, 0)
+	if r.Page.Ignored != nil {
+		PrintDefinition(w, r.Page.Ignored, 0)
+	}
+	if r.Options.NoRemaining && len(r.remaining) > 0 {
+		_, _ = fmt.Fprintf(w, "Not rendered (-no-remaining): %d files\n", len(r.remaining))
+		for _, k := range r.Unclaimed() {
+			_, _ = fmt.Fprintf(w, "  - %s\n", k)
+		}
+	}
+}
+
+// Render renders the given page as HTML, as plain-text report in the text format,
+// or as review suggestions in the github-suggestions format, to w.
+// This is the analyzed page, or a split mode page of it.
+func (r *Result) Render(w io.Writer, p *Page) error {
+	if r.Options.Minify && r.Options.Format == "html" {
+		// the size limit applies to the page before minification
+		var buf bytes.Buffer
+		opts := *r.Options
+		opts.Minify = false
+		plain := *r
+		plain.Options = &opts
+		if err := plain.Render(&buf, p); err != nil {
+			return err
+		}
+		r.truncated = r.truncated || plain.truncated
+		_, err := w.Write(minifyHTML(buf.Bytes()))
+		return err
+	}
+	out := &sizeLimit{w: w, max: r.Options.MaxTotalSize}
+	defer func() {
+		if out.reached {
+			r.truncated = true
+			r.Options.logf("output reached the maximum size of %d bytes, the remaining diffs are omitted\n", out.max)
+		}
+	}()
+	switch r.Options.Format {
+	case "text":
+		return r.renderText(out, p)
+	case "github-suggestions":
+		return r.renderSuggestions(out, p)
+	case "tree-diff":
+		return r.renderTreeDiff(out, p)
+	case "json":
+		return r.renderJSON(out, p)
+	}
+	r.prerenderMarkdown(p)
+	templ := template.New("main")
+	templ.Funcs(r.templateFuncs(p, out))
+	templ, err := templ.ParseFS(page, "*.gohtml")
+	if err != nil {
+		return fmt.Errorf("failed to parse page template: %w", err)
+	}
+	name := "main"
+	if p.sectionFragment {
+		name = "section"
+	} else if r.Options.Fragment {
+		name = "fragment"
+	}
+	if err := templ.ExecuteTemplate(out, name, p); err != nil {
+		return fmt.Errorf("failed to build page: %w", err)
+	}
+	return nil
+}
+
+// IsFormat returns true if the name is one of the output formats of Options.Format.
+func IsFormat(name string) bool {
+	switch name {
+	case "html", "text", "github-suggestions", "tree-diff", "json":
+		return true
+	}
+	return false
+}
+
+// RenderFormat renders the page like Render, but in the given format instead of the Options.Format,
+// to render a single analysis in multiple formats.
+func (r *Result) RenderFormat(w io.Writer, p *Page, format string) error {
+	if !IsFormat(format) {
+		return &ConfigError{Err: fmt.Errorf("unknown format %q", format)}
+	}
+	opts := *r.Options
+	opts.Format = format
+	other := *r
+	other.Options = &opts
+	err := other.Render(w, p)
+	r.truncated = r.truncated || other.truncated
+	return err
+}
+
+// maxTotalSizeNote replaces the diffs that are omitted because the output reached the MaxTotalSize.
+const maxTotalSizeNote = "diff omitted, the page reached the maximum output size."
+
+// markdownFuncs returns the functions for the templating of titles and markdown descriptions.
+func (r *Result) markdownFuncs() template.FuncMap {
+	return template.FuncMap{
+		"includeFile": func(path string) (string, error) {
+			return includeFileMarkdown(r.ForkTree, path, r.Page.fileLanguage)
+		},
+	}
+}
+
+// templateFuncs returns the functions for rendering the given page.
+func (r *Result) templateFuncs(currentPage *Page, out *sizeLimit) template.FuncMap {
+	pageDefinition := r.Page
+	return template.FuncMap{
+		"renderMarkdown": func(md string) (string, error) {
+			md, err := r.expandTemplate(md)
+			if err != nil {
+				return "", err
+			}
+			return r.renderCachedMarkdown(md), nil
+		},
+		"linesShare": func(lines int) string {
+			total := pageDefinition.Def.LinesAdded + pageDefinition.Def.LinesDeleted
+			if total == 0 {
+				return "0%"
+			}
+			// a single commit may change more lines than the whole fork diff
+			return fmt.Sprintf("%.1f%%", math.Min(float64(lines)*100/float64(total), 100))
+		},
+		"fileLanguage": r.Page.fileLanguage,
+		"fileStatus": func(fps *FilePatchStats) string {
+			return fileStatus(changeKind(fps.Patch))
+		},
+		"page": func() *Page {
+			return currentPage
+		},
+		"options": func() *Options {
+			return r.Options
+		},
+		"fileTree": func() *FileTreeNode {
+			tree := buildFileTree(sortedPatchNames(r.patchByName), r.baseFiles, r.forkFiles, r.lessPath, r.Options.AnchorPrefix)
+			if r.Options.Heatmap {
+				tree.setHeat(r.patchByName)
+			}
+			return tree
+		},
+		"existsInBase": func(path string) bool {
+			_, ok := r.baseFiles[path]
+			return ok
+		},
+		"existsInFork": func(path string) bool {
+			_, ok := r.forkFiles[path]
+			return ok
+		},
+		"submoduleCommit": func(path, hash string) string {
+			if u := pageDefinition.submoduleCommitURL(path, hash); u != "" {
+				return fmt.Sprintf(`<a href="%s"><code>%s</code></a>`, template.HTMLEscapeString(u), hash)
+			}
+			return "<code>" + hash + "</code>"
+		},
+		"baseFileURL": func(path string) string {
+			return fmt.Sprintf("%s/blob/%s/%s", pageDefinition.Base.URL, r.BaseCommit.Hash, path)
+		},
+		"forkFileURL": func(path string) string {
+			return fmt.Sprintf("%s/blob/%s/%s", pageDefinition.Fork.URL, r.ForkCommit.Hash, path)
+		},
+		"baseCommitHash": func() string {
+			return r.BaseCommit.Hash.String()
+		},
+		"baseRawFileURL": func(path string) string {
+			return fmt.Sprintf("%s/raw/%s/%s", pageDefinition.Base.URL, r.BaseCommit.Hash, path)
+		},
+		"forkRawFileURL": func(path string) string {
+			return fmt.Sprintf("%s/raw/%s/%s", pageDefinition.Fork.URL, r.ForkCommit.Hash, path)
+		},
+		"forkCommitHash": func() string {
+			return r.ForkCommit.Hash.String()
+		},
+		"diffColorsCSS": r.Options.diffColorsCSS,
+		"definitionSource": func() string {
+			if !r.Options.EmbedDefinition {
+				return ""
+			}
+			return template.HTMLEscapeString(string(pageDefinition.source))
+		},
+		"commitTime": func(t time.Time) string {
+			return renderCommitTime(t)
+		},
+		"sectionTitle": func(fd *ForkDefinition) string {
+			if fd.commitSubject {
+				return template.HTMLEscapeString(fd.Title)
+			}
+			return fd.Title
+		},
+		"commitSubject": func(c *object.Commit) string {
+			subject, _, _ := strings.Cut(c.Message, "\n")
+			return subject
+		},
+		"renderPreview": func(path string) (string, error) {
+			if out.reached {
+				return "", nil
+			}
+			html, err := r.renderPreview(path)
+			if err != nil || !out.allow(len(html)) {
+				return "", err
+			}
+			return html, nil
+		},
+		"renderPatch": func(fps *FilePatchStats) (string, error) {
+			if out.reached {
+				return maxTotalSizeNote, nil
+			}
+			html, err := r.renderPatch(fps)
+			if err != nil {
+				return "", err
+			}
+			if !out.allow(len(html)) {
+				return maxTotalSizeNote, nil
+			}
+			return html, nil
+		},
+	}
+}
+
+// DefaultContext is the default number of unchanged lines around the changes in the diffs, like git.
+const DefaultContext = 3
+
+// encodePatch encodes the patch of a file as unified diff, optionally with ANSI colors,
+// with the context of the section of the file, or else Options.Context.
+// The hunk headers show the enclosing declaration of the hunk, for the languages of funcContextPatterns.
+func (r *Result) encodePatch(fps *FilePatchStats, color bool) (string, error) {
+	contextLines := r.Options.Context
+	if fps.context != nil {
+		contextLines = *fps.context
+	}
+	var out bytes.Buffer
+	enc := diff.NewUnifiedEncoder(&out, contextLines)
+	switch r.Options.Prefix {
+	case "a/b":
+		enc.SetSrcPrefix("a/")
+		enc.SetDstPrefix("b/")
+	case "none":
+		enc.SetSrcPrefix("")
+		enc.SetDstPrefix("")
+	default:
+		enc.SetSrcPrefix(r.Page.Base.Name + "/")
+		enc.SetDstPrefix(r.Page.Fork.Name + "/")
+	}
+	if color {
+		enc.SetColor(diffColorConfig())
+	}
+	if err := enc.Encode(FilePatch{filePatch: fps.Patch}); err != nil {
+		return "", fmt.Errorf("failed to encode patch of %q: %w", fps.Path, err)
+	}
+	encoded := withFuncContext(out.String(), fps.Patch.Chunks(), r.Page.fileLanguage(fps.Path), color)
+	if r.Options.ExpandTabs {
+		return expandTabs(encoded, r.Options.TabWidth), nil
+	}
+	return encoded, nil
+}
+
+// renderPatch renders the patch of a file as HTML.
+// With Blame, the hunks are annotated with the commits that introduced them,
+// with MaxHunks, the hunks beyond the limit are collapsed,
+// with CollapseContext, long runs of unchanged lines within the hunks are collapsed,
+// and the comments of the page on the file are rendered after the lines they are on.
+func (r *Result) renderPatch(fps *FilePatchStats) (string, error) {
+	encoded, err := r.encodePatch(fps, !r.Options.NoColor)
+	if err != nil {
+		return "", err
+	}
+	_, inFork := r.forkFiles[fps.Path]
+	// the lines of converted files are not those of the file, which blame and since refer to
+	_, converted := fps.Patch.(*textconvFilePatch)
+	blame := r.blames != nil && !fps.Patch.IsBinary() && inFork && !converted
+	since := r.since != nil && len(r.since.added[fps.Path]) > 0 && !converted
+	maxHunks := r.Options.MaxHunks
+	collapse := r.Options.CollapseContext
+	comments := r.Page.fileComments(fps.Path)
+	if !blame && !since && maxHunks == 0 && collapse == 0 && len(comments) == 0 {
+		return string(r.renderDiff(encoded, false)), nil
+	}
+	header, hunks := splitHunks(encoded)
+	var annotations []string
+	if blame {
+		annotations, err = r.blameAnnotations(fps.Path, hunks)
+		if err != nil {
+			return "", err
+		}
+	}
+	if since {
+		if annotations == nil {
+			annotations = make([]string, len(hunks))
+		}
+		short := r.since.Commit.Hash.String()[:7]
+		for i, h := range hunks {
+			if r.since.changedHunk(fps.Path, h) {
+				annotations[i] = `<div class="hunk-since">changed since <code>` + short + "</code></div>" + annotations[i]
+			}
+		}
+	}
+	if annotations == nil && (maxHunks == 0 || len(hunks) <= maxHunks) && collapse == 0 && len(comments) == 0 {
+		return string(r.renderDiff(encoded, false)), nil
+	}
+	placed, outside := placeComments(hunks, comments)
+	var out strings.Builder
+	out.Write(r.renderDiff(header, false))
+	for i, h := range hunks {
+		if maxHunks > 0 && i == maxHunks {
+			// the hidden hunks are still in the page, so they can be found with search
+			more := len(hunks) - maxHunks
+			out.WriteString(fmt.Sprintf(`<details class="more-hunks"><summary>show %d more hunk%s</summary>`, more, plural(more)))
+		} else if annotations == nil || annotations[i] == "" {
+			out.WriteString("\n")
+		}
+		// the annotations are blocks, so no newline is needed around them
+		if annotations != nil {
+			out.WriteString(annotations[i])
+		}
+		// the comments are blocks too
+		for j, segment := range splitAtComments(h.Text, placed[i]) {
+			r.renderHunkText(&out, segment.Text, j > 0)
+			for _, c := range segment.Comments {
+				out.WriteString(r.renderLineComment(c, false))
+			}
+		}
+	}
+	if maxHunks > 0 && len(hunks) > maxHunks {
+		out.WriteString("</details>")
+	}
+	for _, c := range outside {
+		out.WriteString(r.renderLineComment(c, true))
+	}
+	return out.String(), nil
+}
+
+// renderHunkText renders a hunk, or the part of it after a comment if inHunk, with CollapseContext.
+func (r *Result) renderHunkText(out *strings.Builder, text string, inHunk bool) {
+	collapse := r.Options.CollapseContext
+	if collapse == 0 {
+		out.Write(r.renderDiff(text, inHunk))
+		return
+	}
+	// the collapsed lines are a block, so no newline is needed around them
+	for _, part := range splitContextRuns(text, collapse) {
+		if part.Collapsed {
+			out.WriteString(fmt.Sprintf(`<details class="collapsed-context"><summary>%d unchanged line%s</summary>`, part.Lines, plural(part.Lines)))
+			out.Write(r.renderDiff(part.Text, true))
+			out.WriteString("</details>")
+			continue
+		}
+		out.Write(r.renderDiff(part.Text, true))
+	}
+}
+
+// previewLines is the maximum number of lines of a preview, after the hunk header, see renderPreview.
+const previewLines = 10
+
+// renderPreview renders the start of the first hunk of the diff of a file, for the file tree with Previews,
+// followed by the number of lines and hunks that are left out. It is empty for files without a line diff.
+func (r *Result) renderPreview(path string) (string, error) {
+	patch, ok := r.patchByName[path]
+	if !ok || patch.IsBinary() {
+		return "", nil
+	}
+	encoded, err := r.encodePatch(&FilePatchStats{Path: path, Patch: patch}, !r.Options.NoColor)
+	if err != nil {
+		return "", err
+	}
+	_, hunks := splitHunks(encoded)
+	if len(hunks) == 0 {
+		return "", nil
+	}
+	lines := strings.Split(hunks[0].Text, "\n")
+	var more []string
+	if n := len(lines) - 1 - previewLines; n > 0 {
+		lines = lines[:previewLines+1]
+		more = append(more, fmt.Sprintf("%d more line%s", n, plural(n)))
+	}
+	if n := len(hunks) - 1; n > 0 {
+		more = append(more, fmt.Sprintf("%d more hunk%s", n, plural(n)))
+	}
+	html := string(r.renderDiff(strings.Join(lines, "\n"), false))
+	if len(more) > 0 {
+		html += `<div class="diff-preview-more">` + strings.Join(more, ", ") + "</div>"
+	}
+	return html, nil
+}
+
+// renderDiff renders (part of) an encoded patch as HTML, from the ANSI colors or, with NoColor, the diff syntax.
+// inHunk is true if the part starts within a hunk, after its header. See labelDiffLines for the changed lines,
+// truncateLines for MaxLineLength, and markWhitespace for ShowWhitespace.
+func (r *Result) renderDiff(encoded string, inHunk bool) []byte {
+	encoded, rests := truncateLines(encoded, r.Options.MaxLineLength, inHunk)
+	var rendered []byte
+	if r.Options.NoColor {
+		rendered = renderPlainDiff(encoded, inHunk)
+	} else {
+		rendered = t2html.Render([]byte(encoded))
+	}
+	if r.Options.ShowWhitespace {
+		rendered = markWhitespace(encoded, rendered, inHunk, rests)
+	}
+	rendered = labelDiffLines(encoded, markTruncatedLines(rendered, rests), inHunk)
+	if r.Options.FoldIndent {
+		rendered = foldIndentLines(encoded, rendered, inHunk, r.Options.TabWidth)
+	}
+	return rendered
+}
+
+func plural(n int) string {
+	if n == 1 {
+		return ""
+	}
+	return "s"
+}
+
+// blameAnnotations renders the commits that introduced the added lines of each hunk, to show above the hunk.
+// If the file cannot be blamed, the annotations are nil, and the patch is rendered without them.
+func (r *Result) blameAnnotations(path string, hunks []*diffHunk) ([]string, error) {
+	hunkCommits := make([][]*object.Commit, len(hunks))
+	for i, h := range hunks {
+		commits, err := r.blames.introducedBy(path, h.Added)
+		if err != nil {
+			r.Options.logf("rendering %q without blame: %v\n", path, err)
+			return nil, nil
+		}
+		hunkCommits[i] = commits
+	}
+	out := make([]string, len(hunks))
+	for i, commits := range hunkCommits {
+		var annotation strings.Builder
+		for _, c := range commits {
+			annotation.WriteString(`<div class="hunk-blame">introduced in `)
+			short := template.HTMLEscapeString(c.Hash.String()[:7])
+			if url := r.Page.Fork.URL; url != "" {
+				annotation.WriteString(fmt.Sprintf(`<a href="%s/commit/%s"><code>%s</code></a>`,
+					template.HTMLEscapeString(url), c.Hash, short))
+			} else {
+				annotation.WriteString("<code>" + short + "</code>")
+			}
+			subject, _, _ := strings.Cut(c.Message, "\n")
+			annotation.WriteString(" " + template.HTMLEscapeString(subject))
+			if r.notes != nil {
+				note, err := r.notes.note(c.Hash)
+				if err != nil {
+					return nil, err
+				}
+				if note != "" {
+					annotation.WriteString(`<div class="hunk-note">` + template.HTMLEscapeString(note) + "</div>")
+				}
+			}
+			annotation.WriteString("</div>")
+		}
+		out[i] = annotation.String()
+	}
+	return out, nil
+}
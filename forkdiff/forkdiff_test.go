@@ -0,0 +1,123 @@
+package forkdiff
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/go-git/go-git/v5/plumbing"
+	"strings"
+	"testing"
+)
+
+func TestGenerateReproducible(t *testing.T) {
+	repo := newTestRepo(t)
+	base := map[string]string{"main.go": "package main\n"}
+	for i := 0; i < 20; i++ {
+		base[fmt.Sprintf("pkg%d/file.go", i)] = fmt.Sprintf("package pkg%d\n", i)
+	}
+	commitTestFiles(t, repo, "base", "base", testFiles(base))
+	fork := make(map[string]string, len(base))
+	for k, v := range base {
+		fork[k] = v
+	}
+	// every commit changes a few files, so the commits and the last changes of the files differ
+	for i := 0; i < 5; i++ {
+		for j := i; j < 20; j += 5 {
+			fork[fmt.Sprintf("pkg%d/file.go", j)] += fmt.Sprintf("\n// change %d\n", i)
+		}
+		fork[fmt.Sprintf("new%d.txt", i)] = "new\n"
+		commitTestFiles(t, repo, "fork", fmt.Sprintf("change %d\n\nof a few files", i), testFiles(fork))
+	}
+	tests := []struct {
+		name string
+		opts Options
+	}{
+		{"group by commit", Options{GroupBy: "commit", LastChanged: true}},
+		{"last changed", Options{LastChanged: true, Sort: "last-modified"}},
+		{"text", Options{GroupBy: "commit", LastChanged: true, Format: "text"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			generate := func() []byte {
+				opts := tt.opts
+				opts.Repo = repo
+				opts.Page = &Page{
+					Title: "test fork",
+					Base:  RefRepo{Name: "base", Ref: "refs/heads/base"},
+					Fork:  RefRepo{Name: "fork", Ref: "refs/heads/fork"},
+					Def: &ForkDefinition{
+						Title: "root",
+						Sub: []*ForkDefinition{
+							{Title: "low", Globs: []string{"pkg1*/*"}},
+							{Title: "new", Globs: []string{"new*"}},
+						},
+					},
+				}
+				out, err := Generate(opts)
+				if err != nil {
+					t.Fatalf("failed to generate: %v", err)
+				}
+				return out
+			}
+			first := generate()
+			if !bytes.Contains(first, []byte("change 4")) {
+				t.Fatalf("the output does not show the last commit:\n%s", first)
+			}
+			for i := 0; i < 3; i++ {
+				if next := generate(); !bytes.Equal(first, next) {
+					t.Fatalf("generating again gave different output, of %d and %d bytes", len(first), len(next))
+				}
+			}
+		})
+	}
+}
+
+func TestResolveRef(t *testing.T) {
+	repo := newTestRepo(t)
+	// a new repository has a symbolic HEAD to a branch without commits
+	_, err := resolveRef(repo, plumbing.HEAD)
+	if err == nil || !strings.Contains(err.Error(), "has no commits yet") {
+		t.Fatalf("unborn HEAD: got %v, want an error that the branch has no commits", err)
+	}
+	commit := commitTestFiles(t, repo, "main", "first", testFiles(map[string]string{"a": "a\n"}))
+	set := func(ref *plumbing.Reference) {
+		t.Helper()
+		if err := repo.Storer.SetReference(ref); err != nil {
+			t.Fatal(err)
+		}
+	}
+	resolve := func(name plumbing.ReferenceName) plumbing.Hash {
+		t.Helper()
+		ref, err := resolveRef(repo, name)
+		if err != nil {
+			t.Fatalf("failed to resolve %q: %v", name, err)
+		}
+		if ref.Type() != plumbing.HashReference {
+			t.Fatalf("resolved %q to a %s reference", name, ref.Type())
+		}
+		return ref.Hash()
+	}
+
+	set(plumbing.NewSymbolicReference(plumbing.HEAD, plumbing.NewBranchReferenceName("main")))
+	if got := resolve(plumbing.HEAD); got != commit.Hash {
+		t.Errorf("symbolic HEAD: got %s, want %s", got, commit.Hash)
+	}
+	set(plumbing.NewSymbolicReference("refs/heads/alias", plumbing.HEAD))
+	if got := resolve("refs/heads/alias"); got != commit.Hash {
+		t.Errorf("symbolic ref to HEAD: got %s, want %s", got, commit.Hash)
+	}
+
+	set(plumbing.NewHashReference(plumbing.HEAD, commit.Hash))
+	if got := resolve(plumbing.HEAD); got != commit.Hash {
+		t.Errorf("detached HEAD: got %s, want %s", got, commit.Hash)
+	}
+
+	set(plumbing.NewSymbolicReference("refs/heads/a", "refs/heads/b"))
+	set(plumbing.NewSymbolicReference("refs/heads/b", "refs/heads/a"))
+	if _, err := resolveRef(repo, "refs/heads/a"); err == nil {
+		t.Error("expected an error for a cycle of symbolic refs")
+	}
+	if _, err := resolveRef(repo, "refs/heads/missing"); !errors.Is(err, plumbing.ErrReferenceNotFound) {
+		t.Errorf("missing ref: got %v, want ErrReferenceNotFound", err)
+	}
+}
@@ -0,0 +1,88 @@
+package forkdiff
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// FragmentManifest lists the HTML fragments of the top-level sections, for site generators that include them
+// individually, see SectionFragments.
+type FragmentManifest struct {
+	Title string `json:"title"`
+	// Base and Fork are the hashes of the compared commits.
+	Base     string            `json:"base"`
+	Fork     string            `json:"fork"`
+	Sections []FragmentSection `json:"sections"`
+}
+
+// FragmentSection is the entry of a top-level section in the FragmentManifest, in the order of the page.
+type FragmentSection struct {
+	// Slug is derived from the title, and unique among the sections.
+	Slug  string `json:"slug"`
+	Title string `json:"title"`
+	// File is the name of the fragment file, in the same directory as the manifest.
+	File string `json:"file"`
+	// ID is the anchor of the section in the fragment.
+	ID      string `json:"id"`
+	Files   int    `json:"files"`
+	Added   int    `json:"added"`
+	Deleted int    `json:"deleted"`
+}
+
+// SectionFragments returns a page per top-level section, that renders only the HTML of that section,
+// without the document, legend or file tree around it, and the manifest of the fragments, in the same order.
+// Sections with the same slug get a numeric suffix, like "utils-2".
+func (r *Result) SectionFragments() (*FragmentManifest, []*Page, error) {
+	if r.Options.GroupBy == "commit" {
+		return nil, nil, &ConfigError{Err: errors.New("cannot render the sections as fragments when grouping by commit")}
+	}
+	if r.Options.Format != "html" {
+		return nil, nil, &ConfigError{Err: fmt.Errorf("section fragments are HTML, not %s", r.Options.Format)}
+	}
+	manifest := &FragmentManifest{
+		Title:    r.Page.Title,
+		Base:     r.BaseCommit.Hash.String(),
+		Fork:     r.ForkCommit.Hash.String(),
+		Sections: []FragmentSection{},
+	}
+	var pages []*Page
+	used := make(map[string]struct{})
+	for _, sub := range r.Page.Def.Sub {
+		slug := slugify(sub.Title)
+		for i := 2; ; i++ {
+			if _, ok := used[slug]; !ok {
+				break
+			}
+			slug = slugify(sub.Title) + "-" + strconv.Itoa(i)
+		}
+		used[slug] = struct{}{}
+		manifest.Sections = append(manifest.Sections, FragmentSection{
+			Slug:    slug,
+			Title:   sub.Title,
+			File:    slug + ".html",
+			ID:      sub.ID,
+			Files:   sub.FileCount,
+			Added:   sub.LinesAdded,
+			Deleted: sub.LinesDeleted,
+		})
+		sectionPage := *r.Page
+		sectionPage.Def = sub
+		sectionPage.Ignored = nil
+		sectionPage.sectionFragment = true
+		pages = append(pages, &sectionPage)
+	}
+	return manifest, pages, nil
+}
+
+// WriteJSON writes the manifest as indented JSON.
+func (m *FragmentManifest) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(m); err != nil {
+		return fmt.Errorf("failed to encode fragment manifest: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package forkdiff
+
+import (
+	"github.com/go-git/go-git/v5/plumbing/format/diff"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// maxFuncContext is the maximum length in bytes of the function context of a hunk header, like git.
+const maxFuncContext = 80
+
+// funcContextPatterns match the lines that declare a function, type or section, by file language,
+// like the builtin diff drivers of git. The languages are those of Page.fileLanguage.
+var funcContextPatterns = func() map[string]*regexp.Regexp {
+	cFamily := regexp.MustCompile(`^[A-Za-z_][\w \t*&:<>,~]*\([^;]*$`)
+	js := regexp.MustCompile(`^\s*((export\s+)?(default\s+)?(async\s+)?function\b|(export\s+)?(abstract\s+)?class\s)`)
+	jvm := regexp.MustCompile(`^\s*((public|protected|private|static|final|abstract|internal|override|open|data|sealed)\s+)*(class|interface|enum|record|fun|object)\s|^\s*(public|protected|private)\s[^=;]*\(`)
+	shell := regexp.MustCompile(`^\s*(function\s+[\w-]+|[\w-]+\s*\(\s*\))`)
+	markdown := regexp.MustCompile(`^#{1,6}\s`)
+	return map[string]*regexp.Regexp{
+		"go":       regexp.MustCompile(`^(func\s|type\s.*\b(struct|interface)\b)`),
+		"py":       regexp.MustCompile(`^\s*((async\s+)?def|class)\s`),
+		"rs":       regexp.MustCompile(`^\s*(pub(\([^)]*\))?\s+)?((async|const|unsafe|extern\s+"[^"]*")\s+)*(fn|struct|enum|union|impl|trait|mod|macro_rules!)\b`),
+		"rb":       regexp.MustCompile(`^\s*(def|class|module)\s`),
+		"sol":      regexp.MustCompile(`^\s*(abstract\s+)?(function|contract|library|interface|modifier|constructor|struct|event)\b`),
+		"c":        cFamily,
+		"h":        cFamily,
+		"cc":       cFamily,
+		"cpp":      cFamily,
+		"hpp":      cFamily,
+		"js":       js,
+		"mjs":      js,
+		"jsx":      js,
+		"ts":       js,
+		"tsx":      js,
+		"java":     jvm,
+		"kt":       jvm,
+		"sh":       shell,
+		"bash":     shell,
+		"md":       markdown,
+		"markdown": markdown,
+	}
+}()
+
+// withFuncContext replaces the context of the hunk headers of an encoded patch with the enclosing declaration
+// of each hunk: the last line before the hunk in the base file that matches the pattern of the language.
+// The encoder of go-git uses the line before the hunk context instead, whatever it declares.
+// Files of other languages are left as they are.
+func withFuncContext(encoded string, chunks []diff.Chunk, language string, color bool) string {
+	pattern, ok := funcContextPatterns[language]
+	if !ok {
+		return encoded
+	}
+	var base strings.Builder
+	for _, c := range chunks {
+		if c.Type() != diff.Add {
+			base.WriteString(c.Content())
+		}
+	}
+	baseLines := strings.Split(base.String(), "\n")
+	colors := diffColorConfig()
+	lines := strings.Split(encoded, "\n")
+	for i, line := range lines {
+		plain := ansiEscapeRegexp.ReplaceAllString(line, "")
+		loc := hunkHeaderRegexp.FindStringSubmatchIndex(plain)
+		if loc == nil {
+			continue
+		}
+		header := plain[:loc[1]]
+		if color {
+			header = colors[diff.Frag] + header + colors.Reset(diff.Frag)
+		}
+		baseStart, _ := strconv.Atoi(plain[loc[2]:loc[3]])
+		if ctx := funcContext(baseLines, baseStart, pattern); ctx != "" {
+			if color {
+				ctx = colors[diff.Func] + ctx + colors.Reset(diff.Func)
+			}
+			header += " " + ctx
+		}
+		lines[i] = header
+	}
+	return strings.Join(lines, "\n")
+}
+
+// funcContext returns the last line before the 1-based base line start that matches the pattern,
+// without trailing whitespace and cut to maxFuncContext bytes, or an empty string if there is none.
+func funcContext(baseLines []string, start int, pattern *regexp.Regexp) string {
+	i := start - 2
+	if i >= len(baseLines) {
+		i = len(baseLines) - 1
+	}
+	for ; i >= 0; i-- {
+		if !pattern.MatchString(baseLines[i]) {
+			continue
+		}
+		ctx := strings.TrimRight(baseLines[i], " \t\r")
+		if len(ctx) > maxFuncContext {
+			// do not cut a UTF-8 sequence
+			cut := maxFuncContext
+			for cut > 0 && ctx[cut]&0xC0 == 0x80 {
+				cut--
+			}
+			ctx = ctx[:cut]
+		}
+		return ctx
+	}
+	return ""
+}
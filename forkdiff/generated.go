@@ -0,0 +1,78 @@
+package forkdiff
+
+import (
+	"fmt"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/format/diff"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// DefaultGeneratedMarker matches the line that marks generated Go code, which many other generators write too:
+// "// Code generated by <tool>. DO NOT EDIT.", see https://go.dev/s/generatedcode.
+const DefaultGeneratedMarker = `^// Code generated .* DO NOT EDIT\.$`
+
+// generatedHeaderSize is the number of bytes at the start of a file that are searched for the generated marker.
+const generatedHeaderSize = 4096
+
+// generatedMarker returns the compiled Options.GeneratedMarker, or the DefaultGeneratedMarker if it is empty.
+func (opts *Options) generatedMarker() (*regexp.Regexp, error) {
+	marker := opts.GeneratedMarker
+	if marker == "" {
+		marker = DefaultGeneratedMarker
+	}
+	re, err := regexp.Compile(marker)
+	if err != nil {
+		return nil, fmt.Errorf("invalid generated marker %q: %w", marker, err)
+	}
+	return re, nil
+}
+
+// splitGenerated moves the patches of the files that are generated in the fork, see isGenerated, out of the patches.
+func splitGenerated(repo *git.Repository, patches map[string]diff.FilePatch, marker *regexp.Regexp) (kept, generated map[string]diff.FilePatch, err error) {
+	kept = make(map[string]diff.FilePatch, len(patches))
+	generated = make(map[string]diff.FilePatch)
+	for k, fp := range patches {
+		ok, err := isGenerated(repo, fp, marker)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to check if %q is generated: %w", k, err)
+		}
+		if ok {
+			generated[k] = fp
+		} else {
+			kept[k] = fp
+		}
+	}
+	return kept, generated, nil
+}
+
+// isGenerated returns true if a line in the first generatedHeaderSize bytes of the fork version of the file
+// matches the marker. Files that are deleted in the fork, binary files, symlinks and submodules are not generated.
+// The blob is read, so this also works for files that are too large to diff.
+func isGenerated(repo *git.Repository, fp diff.FilePatch, marker *regexp.Regexp) (bool, error) {
+	_, to := fp.Files()
+	if to == nil || fp.IsBinary() || to.Mode() == filemode.Symlink || to.Mode() == filemode.Submodule {
+		return false, nil
+	}
+	blob, err := repo.BlobObject(to.Hash())
+	if err != nil {
+		return false, err
+	}
+	r, err := blob.Reader()
+	if err != nil {
+		return false, err
+	}
+	defer r.Close()
+	header, err := io.ReadAll(io.LimitReader(r, generatedHeaderSize))
+	if err != nil {
+		return false, err
+	}
+	for _, line := range strings.Split(string(header), "\n") {
+		if marker.MatchString(strings.TrimSuffix(line, "\r")) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,47 @@
+package forkdiff
+
+import (
+	"fmt"
+	"github.com/go-git/go-git/v5/plumbing/format/diff"
+	"math"
+)
+
+// heatLevels is the number of steps of the color scale of the Heatmap.
+const heatLevels = 5
+
+// changeIntensity returns the share of the lines of the file that changed: the added and deleted lines,
+// relative to the lines of the base and fork versions together, counting the unchanged lines once.
+// A new, deleted or entirely rewritten file is 1. It is false for files without line diff, like binary files.
+func changeIntensity(fp diff.FilePatch) (float64, bool) {
+	chunks := fp.Chunks()
+	added, deleted := countOperations(chunks, diff.Add), countOperations(chunks, diff.Delete)
+	total := added + deleted + countOperations(chunks, diff.Equal)
+	if total == 0 {
+		return 0, false
+	}
+	return float64(added+deleted) / float64(total), true
+}
+
+// setHeat sets the heat of the files in the tree, from the intensity of the changes of their patches.
+func (n *FileTreeNode) setHeat(patchByName map[string]diff.FilePatch) {
+	for _, c := range n.Children {
+		if c.Status == "" {
+			c.setHeat(patchByName)
+			continue
+		}
+		fp, ok := patchByName[c.Path]
+		if !ok {
+			continue
+		}
+		intensity, ok := changeIntensity(fp)
+		if !ok || intensity == 0 {
+			continue
+		}
+		c.Heat = int(math.Ceil(intensity * heatLevels))
+		if intensity < 0.01 {
+			c.HeatTitle = "less than 1% of the lines changed"
+		} else {
+			c.HeatTitle = fmt.Sprintf("%.0f%% of the lines changed", intensity*100)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package forkdiff
+
+import (
+	"errors"
+	"fmt"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"io"
+)
+
+// commitTrees returns the tree of the first parent of the commit, or an empty tree for a root commit,
+// and the tree of the commit itself.
+func commitTrees(c *object.Commit) (parentTree *object.Tree, tree *object.Tree, err error) {
+	parentTree = &object.Tree{}
+	if c.NumParents() > 0 {
+		parent, err := c.Parent(0)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to open parent of commit %s: %w", c.Hash, err)
+		}
+		parentTree, err = parent.Tree()
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to open tree of commit %s: %w", parent.Hash, err)
+		}
+	}
+	tree, err = c.Tree()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open tree of commit %s: %w", c.Hash, err)
+	}
+	return parentTree, tree, nil
+}
+
+// commitChanges returns the changes of the commit against its first parent, see commitTrees.
+// Everything in a root commit is added by it.
+func commitChanges(c *object.Commit) (object.Changes, error) {
+	parentTree, tree, err := commitTrees(c)
+	if err != nil {
+		return nil, err
+	}
+	changes, err := object.DiffTree(parentTree, tree)
+	if err != nil {
+		return nil, fmt.Errorf("failed to diff commit %s with parent: %w", c.Hash, err)
+	}
+	return changes, nil
+}
+
+// latestFileCommits walks the history of the given commit, newest first by committer time,
+// and returns the latest commit that touched each of the given paths.
+// The walk stops as soon as all paths are found. Paths that are never touched are omitted.
+func latestFileCommits(from *object.Commit, paths map[string]struct{}) (map[string]*object.Commit, error) {
+	out := make(map[string]*object.Commit, len(paths))
+	iter := object.NewCommitIterCTime(from, nil, nil)
+	defer iter.Close()
+	for len(out) < len(paths) {
+		commit, err := iter.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to walk history: %w", err)
+		}
+		changes, err := commitChanges(commit)
+		if err != nil {
+			return nil, err
+		}
+		for _, ch := range changes {
+			for _, name := range []string{ch.From.Name, ch.To.Name} {
+				if _, ok := paths[name]; !ok {
+					continue
+				}
+				if _, ok := out[name]; !ok {
+					out[name] = commit
+				}
+			}
+		}
+	}
+	return out, nil
+}
+
+// firstFileCommits returns the index of the first of the commits that touched each of the given paths,
+// with the commits oldest first, like forkCommits. Merge commits are skipped, like in lastAuthors.
+// The walk stops as soon as all paths are found. Paths that are never touched are omitted.
+func firstFileCommits(commits []*object.Commit, paths map[string]struct{}) (map[string]int, error) {
+	out := make(map[string]int, len(paths))
+	for i, commit := range commits {
+		if len(out) == len(paths) {
+			break
+		}
+		if commit.NumParents() > 1 {
+			continue
+		}
+		changes, err := commitChanges(commit)
+		if err != nil {
+			return nil, err
+		}
+		for _, ch := range changes {
+			for _, name := range []string{ch.From.Name, ch.To.Name} {
+				if _, ok := paths[name]; !ok {
+					continue
+				}
+				if _, ok := out[name]; !ok {
+					out[name] = i
+				}
+			}
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,52 @@
+package forkdiff
+
+import (
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"reflect"
+	"testing"
+)
+
+func TestFileCommits(t *testing.T) {
+	repo := newTestRepo(t)
+	first := commitTestFiles(t, repo, "main", "first", testFiles(map[string]string{"a": "1\n", "b": "1\n"}))
+	second := commitTestFiles(t, repo, "main", "second", testFiles(map[string]string{"a": "2\n", "b": "1\n", "c": "1\n"}))
+	third := commitTestFiles(t, repo, "main", "third", testFiles(map[string]string{"a": "2\n", "c": "2\n"}))
+	paths := map[string]struct{}{"a": {}, "b": {}, "c": {}, "never": {}}
+
+	changes, err := commitChanges(first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 2 {
+		t.Errorf("got %d changes of the root commit, want it to add both files", len(changes))
+	}
+
+	latest, err := latestFileCommits(third, paths)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"a": "second", "b": "third", "c": "third"}
+	got := make(map[string]string, len(latest))
+	for k, c := range latest {
+		got[k] = c.Message
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("latest commits: got %v, want %v", got, want)
+	}
+
+	firstCommits, err := firstFileCommits([]*object.Commit{first, second, third}, paths)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]int{"a": 0, "b": 0, "c": 1}; !reflect.DeepEqual(firstCommits, want) {
+		t.Errorf("first commits: got %v, want %v", firstCommits, want)
+	}
+
+	authors, err := lastAuthors([]*object.Commit{first, second, third})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]string{"a": "dev@example.com", "b": "dev@example.com", "c": "dev@example.com"}; !reflect.DeepEqual(authors, want) {
+		t.Errorf("last authors: got %v, want %v", authors, want)
+	}
+}
@@ -0,0 +1,288 @@
+package forkdiff
+
+import (
+	"fmt"
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+var (
+	ansiEscapeRegexp = regexp.MustCompile(`\x1b\[[0-9;]*m`)
+	hunkHeaderRegexp = regexp.MustCompile(`^@@ -(\d+)(?:,(\d+))? \+(\d+)(?:,(\d+))? @@`)
+)
+
+// diffHunk is a hunk of a unified diff, as encoded (with ANSI colors) by the diff.UnifiedEncoder.
+type diffHunk struct {
+	// Text is the encoded hunk, starting with the "@@" header line, without trailing newline.
+	Text string
+	// BaseStart and ForkStart are the first line numbers of the hunk in the base and fork file.
+	BaseStart, ForkStart int
+	// Added are the fork line numbers of the lines that the hunk adds.
+	Added []int
+}
+
+// splitHunks splits an encoded unified diff of a single file into the file header and the hunks.
+func splitHunks(encoded string) (header string, hunks []*diffHunk) {
+	lines := strings.Split(strings.TrimSuffix(encoded, "\n"), "\n")
+	var headerLines []string
+	var current []string
+	var hunk *diffHunk
+	forkLine := 0
+	flush := func() {
+		if hunk != nil {
+			hunk.Text = strings.Join(current, "\n")
+			hunks = append(hunks, hunk)
+		}
+		current = nil
+	}
+	for _, line := range lines {
+		plain := ansiEscapeRegexp.ReplaceAllString(line, "")
+		if m := hunkHeaderRegexp.FindStringSubmatch(plain); m != nil {
+			flush()
+			baseStart, _ := strconv.Atoi(m[1])
+			forkLine, _ = strconv.Atoi(m[3])
+			hunk = &diffHunk{BaseStart: baseStart, ForkStart: forkLine}
+			current = append(current, line)
+			continue
+		}
+		if hunk == nil {
+			headerLines = append(headerLines, line)
+			continue
+		}
+		current = append(current, line)
+		if plain == "" {
+			continue
+		}
+		switch plain[0] {
+		case '+':
+			hunk.Added = append(hunk.Added, forkLine)
+			forkLine++
+		case ' ':
+			forkLine++
+		}
+	}
+	flush()
+	return strings.Join(headerLines, "\n"), hunks
+}
+
+// hunkPart is a part of the text of a hunk, see splitContextRuns.
+type hunkPart struct {
+	Text string
+	// Collapsed is true if the part is a run of unchanged lines that is collapsed, of Lines lines.
+	Collapsed bool
+	Lines     int
+}
+
+// splitContextRuns splits the text of an encoded hunk into parts, with the runs of more than max
+// unchanged context lines in separate, collapsed parts. The hunk header is never collapsed.
+func splitContextRuns(text string, max int) []hunkPart {
+	var out []hunkPart
+	var current, run []string
+	flush := func() {
+		if len(run) > max {
+			if len(current) > 0 {
+				out = append(out, hunkPart{Text: strings.Join(current, "\n")})
+				current = nil
+			}
+			out = append(out, hunkPart{Text: strings.Join(run, "\n"), Collapsed: true, Lines: len(run)})
+		} else {
+			current = append(current, run...)
+		}
+		run = nil
+	}
+	for i, line := range strings.Split(text, "\n") {
+		plain := ansiEscapeRegexp.ReplaceAllString(line, "")
+		if i > 0 && strings.HasPrefix(plain, " ") {
+			run = append(run, line)
+			continue
+		}
+		flush()
+		current = append(current, line)
+	}
+	flush()
+	if len(current) > 0 {
+		out = append(out, hunkPart{Text: strings.Join(current, "\n")})
+	}
+	return out
+}
+
+// renderPlainDiff renders an uncolored unified diff as HTML, with a CSS class per kind of line instead of colors:
+// "diff-meta" for the file header, "diff-hunk" for hunk headers, and "diff-add" and "diff-delete" for changed lines.
+// Context lines have no class. inHunk is true if the diff starts within a hunk, after its header.
+func renderPlainDiff(encoded string, inHunk bool) []byte {
+	var out strings.Builder
+	for i, line := range strings.Split(encoded, "\n") {
+		if i > 0 {
+			out.WriteString("\n")
+		}
+		class := diffLineClass(line, &inHunk)
+		if line == "" {
+			continue
+		}
+		if class == "" {
+			out.WriteString(html.EscapeString(line))
+			continue
+		}
+		out.WriteString(`<span class="` + class + `">` + html.EscapeString(line) + "</span>")
+	}
+	return []byte(out.String())
+}
+
+// diffLineClass returns the renderPlainDiff class of an uncolored diff line.
+// inHunk tracks whether the line is within a hunk: the lines before the first hunk header are the file header.
+func diffLineClass(line string, inHunk *bool) string {
+	switch {
+	case strings.HasPrefix(line, "@@"):
+		*inHunk = true
+		return "diff-hunk"
+	case !*inHunk || strings.HasPrefix(line, "\\"):
+		return "diff-meta"
+	case strings.HasPrefix(line, "+"):
+		return "diff-add"
+	case strings.HasPrefix(line, "-"):
+		return "diff-delete"
+	}
+	return ""
+}
+
+// labelDiffLines wraps the added and removed lines of a rendered diff in <ins> and <del> elements,
+// with a visually hidden label, so assistive technology announces them as such, instead of by color only.
+// The rendered lines correspond to the lines of the encoded diff, that they are classified by.
+// If they do not, the rendered diff is returned as-is.
+func labelDiffLines(encoded string, rendered []byte, inHunk bool) []byte {
+	// a trailing newline may not be rendered
+	lines := strings.Split(strings.TrimSuffix(encoded, "\n"), "\n")
+	trimmed := strings.TrimSuffix(string(rendered), "\n")
+	renderedLines := strings.Split(trimmed, "\n")
+	if len(lines) != len(renderedLines) {
+		return rendered
+	}
+	var out strings.Builder
+	for i, line := range lines {
+		if i > 0 {
+			out.WriteString("\n")
+		}
+		switch diffLineClass(ansiEscapeRegexp.ReplaceAllString(line, ""), &inHunk) {
+		case "diff-add":
+			out.WriteString(`<ins class="diff-line"><span class="visually-hidden">added line: </span>` + renderedLines[i] + "</ins>")
+		case "diff-delete":
+			out.WriteString(`<del class="diff-line"><span class="visually-hidden">removed line: </span>` + renderedLines[i] + "</del>")
+		default:
+			out.WriteString(renderedLines[i])
+		}
+	}
+	if len(trimmed) < len(rendered) {
+		out.WriteString("\n")
+	}
+	return []byte(out.String())
+}
+
+// truncateLines truncates the lines of an encoded diff within the hunks that have more than max characters
+// after the diff marker, 0 to not truncate. The truncated rest of the lines are returned by line index.
+// inHunk is true if the diff starts within a hunk. Lines with colors within the line are left as they are:
+// the encoder only colors whole lines.
+func truncateLines(encoded string, max int, inHunk bool) (string, map[int]string) {
+	if max <= 0 {
+		return encoded, nil
+	}
+	lines := strings.Split(encoded, "\n")
+	var rests map[int]string
+	for i, line := range lines {
+		plain := ansiEscapeRegexp.ReplaceAllString(line, "")
+		if class := diffLineClass(plain, &inHunk); class == "diff-hunk" || class == "diff-meta" {
+			continue
+		}
+		if utf8.RuneCountInString(plain) <= max+1 {
+			continue
+		}
+		// the escape codes of whole lines are before and after the text
+		loc := ansiEscapeRegexp.FindAllStringIndex(line, -1)
+		start, end := 0, len(line)
+		for _, l := range loc {
+			if l[0] == start {
+				start = l[1]
+			}
+		}
+		for j := len(loc) - 1; j >= 0 && loc[j][1] == end; j-- {
+			end = loc[j][0]
+		}
+		if line[start:end] != plain {
+			continue
+		}
+		runes := []rune(plain)
+		if rests == nil {
+			rests = make(map[int]string)
+		}
+		// the diff marker does not count
+		rests[i] = string(runes[max+1:])
+		lines[i] = line[:start] + string(runes[:max+1]) + line[end:]
+	}
+	return strings.Join(lines, "\n"), rests
+}
+
+// markTruncatedLines appends a marker with the rest of the line to the rendered lines that truncateLines truncated,
+// within the colored span of the line, so the rest has the same color when it is shown.
+func markTruncatedLines(rendered []byte, rests map[int]string) []byte {
+	if len(rests) == 0 {
+		return rendered
+	}
+	lines := strings.Split(string(rendered), "\n")
+	for i, rest := range rests {
+		if i >= len(lines) {
+			continue
+		}
+		n := utf8.RuneCountInString(rest)
+		marker := fmt.Sprintf(`<span class="long-line" role="button" tabindex="0" title="show the full line" data-rest="%s">… (%d more char%s)</span>`,
+			html.EscapeString(rest), n, plural(n))
+		if strings.HasSuffix(lines[i], "</span>") {
+			lines[i] = strings.TrimSuffix(lines[i], "</span>") + marker + "</span>"
+		} else {
+			lines[i] += marker
+		}
+	}
+	return []byte(strings.Join(lines, "\n"))
+}
+
+// expandTabs replaces the tabs in an encoded diff with spaces, up to the next tab stop.
+// The tab stops are relative to the content of a line, after the "+", "-" or " " of the diff,
+// so the alignment is the same as in the file. ANSI escape codes take no space.
+func expandTabs(encoded string, width int) string {
+	if width <= 0 {
+		width = 8
+	}
+	var out strings.Builder
+	// the diff marker at the start of a line is not part of the content
+	col := -1
+	for i := 0; i < len(encoded); i++ {
+		c := encoded[i]
+		switch {
+		case c == '\n':
+			col = -1
+			out.WriteByte(c)
+		case c == '\x1b':
+			end := strings.IndexByte(encoded[i:], 'm')
+			if end < 0 {
+				end = len(encoded) - i - 1
+			}
+			out.WriteString(encoded[i : i+end+1])
+			i += end
+		case c == '\t':
+			if col < 0 {
+				col = 0
+			}
+			n := width - col%width
+			out.WriteString(strings.Repeat(" ", n))
+			col += n
+		default:
+			out.WriteByte(c)
+			// count characters, not the continuation bytes of UTF-8 sequences
+			if c&0xC0 != 0x80 {
+				col++
+			}
+		}
+	}
+	return out.String()
+}
@@ -0,0 +1,112 @@
+package forkdiff
+
+import (
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// lfsPointerVersion is the start of the first line of a git LFS pointer file, the version of the pointer spec.
+const lfsPointerVersion = "version https://git-lfs"
+
+// maxLFSPointerSize is the maximum size of a git LFS pointer file, per the spec.
+// Larger files are not read to check if they are pointers.
+const maxLFSPointerSize = 1024
+
+// lfsOIDRegexp matches the object IDs of LFS pointer files: the hash method and the hex hash.
+var lfsOIDRegexp = regexp.MustCompile(`^[a-z0-9]+:[0-9a-f]+$`)
+
+// LFSObject is a git LFS object that a pointer file refers to.
+type LFSObject struct {
+	// OID is the object ID, like "sha256:4d7a...".
+	OID string
+	// Size is the size of the object in bytes.
+	Size int64
+}
+
+// LFSChange describes the change of a file that is tracked with git LFS, by the objects of its pointer files.
+// From is nil if the file was added, To is nil if it was removed.
+type LFSChange struct {
+	From *LFSObject
+	To   *LFSObject
+}
+
+// parseLFSPointer returns the object of the content of a git LFS pointer file,
+// or nil if it is not one: the version line, followed by lines of a key and value, including the oid and size.
+func parseLFSPointer(content string) *LFSObject {
+	if !strings.HasPrefix(content, lfsPointerVersion) || !strings.HasSuffix(content, "\n") {
+		return nil
+	}
+	out := &LFSObject{Size: -1}
+	lines := strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+	for _, line := range lines[1:] {
+		key, value, ok := strings.Cut(line, " ")
+		if !ok || value == "" {
+			return nil
+		}
+		switch key {
+		case "oid":
+			if !lfsOIDRegexp.MatchString(value) {
+				return nil
+			}
+			out.OID = value
+		case "size":
+			size, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || size < 0 {
+				return nil
+			}
+			out.Size = size
+		}
+	}
+	if out.OID == "" || out.Size < 0 {
+		return nil
+	}
+	return out
+}
+
+// lfsPointer returns the object of the LFS pointer file of the change entry,
+// or nil if the entry is empty, not a regular file, or not a pointer file.
+func lfsPointer(ce *object.ChangeEntry) (*LFSObject, error) {
+	if ce.Tree == nil || !ce.TreeEntry.Mode.IsRegular() {
+		return nil, nil
+	}
+	f, err := ce.Tree.TreeEntryFile(&ce.TreeEntry)
+	if err != nil {
+		return nil, err
+	}
+	if f.Size > maxLFSPointerSize {
+		return nil, nil
+	}
+	content, err := f.Contents()
+	if err != nil {
+		return nil, err
+	}
+	return parseLFSPointer(content), nil
+}
+
+// lfsChange returns the change of the LFS objects of a change, or nil if either side is not an LFS pointer file.
+// A file that is moved in or out of LFS is not an LFS change, its diff shows the move.
+func lfsChange(ch *object.Change) (*LFSChange, error) {
+	from, err := lfsPointer(&ch.From)
+	if err != nil {
+		return nil, err
+	}
+	if from == nil && ch.From.Tree != nil {
+		return nil, nil
+	}
+	to, err := lfsPointer(&ch.To)
+	if err != nil {
+		return nil, err
+	}
+	if to == nil && ch.To.Tree != nil {
+		return nil, nil
+	}
+	return &LFSChange{From: from, To: to}, nil
+}
+
+// lfsFilePatch is a file patch of a change to a git LFS pointer file, without the diff of the pointer file.
+type lfsFilePatch struct {
+	omittedFilePatch
+	change *LFSChange
+}
@@ -0,0 +1,102 @@
+package forkdiff
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const (
+	testLFSOID1 = "sha256:4d7a214614ab2935c943f9e0ff69d22eadbb8f32b1258daaa5e2ca24d17e2393"
+	testLFSOID2 = "sha256:7f83b1657ff1fc53b92dc18148a1d65dfc2d4b1fa3d677284addd200126d9069"
+)
+
+// testLFSPointer returns the content of an LFS pointer file of the object.
+func testLFSPointer(oid string, size int64) string {
+	return fmt.Sprintf("version https://git-lfs.github.com/spec/v1\noid %s\nsize %d\n", oid, size)
+}
+
+func TestParseLFSPointer(t *testing.T) {
+	tests := []struct {
+		name, content string
+		want          *LFSObject
+	}{
+		{"pointer", testLFSPointer(testLFSOID1, 12345), &LFSObject{OID: testLFSOID1, Size: 12345}},
+		{"extension keys", "version https://git-lfs.github.com/spec/v1\next-0-foo sha256:00\noid " + testLFSOID1 + "\nsize 1\n", &LFSObject{OID: testLFSOID1, Size: 1}},
+		{"no final newline", strings.TrimSuffix(testLFSPointer(testLFSOID1, 1), "\n"), nil},
+		{"no version", "oid " + testLFSOID1 + "\nsize 1\n", nil},
+		{"other version", "version 1\noid " + testLFSOID1 + "\nsize 1\n", nil},
+		{"no oid", "version https://git-lfs.github.com/spec/v1\nsize 1\n", nil},
+		{"no size", "version https://git-lfs.github.com/spec/v1\noid " + testLFSOID1 + "\n", nil},
+		{"uppercase oid", testLFSPointer(strings.ToUpper(testLFSOID1), 1), nil},
+		{"oid without method", testLFSPointer("4d7a2146", 1), nil},
+		{"negative size", testLFSPointer(testLFSOID1, -1), nil},
+		{"size not a number", "version https://git-lfs.github.com/spec/v1\noid " + testLFSOID1 + "\nsize big\n", nil},
+		{"line without value", "version https://git-lfs.github.com/spec/v1\noid " + testLFSOID1 + "\nsize 1\nfoo\n", nil},
+		{"text", "version https://git-lfs is a tool\nto store large files\n", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseLFSPointer(tt.content); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLFSPointerChange(t *testing.T) {
+	repo, _, _ := testTrees(t,
+		testFiles(map[string]string{"assets/logo.png": testLFSPointer(testLFSOID1, 1000)}),
+		testFiles(map[string]string{"assets/logo.png": testLFSPointer(testLFSOID2, 2000)}))
+	def := &ForkDefinition{Title: "root", Dirs: []string{"assets"}}
+	res := analyzeTest(t, repo, def, Options{Format: "text"})
+	if len(def.Files) != 1 {
+		t.Fatalf("got files %v", def.Files)
+	}
+	fps := def.Files[0]
+	if _, ok := fps.Patch.(*lfsFilePatch); !ok {
+		t.Errorf("got a %T patch, want an LFS patch", fps.Patch)
+	}
+	want := &LFSChange{From: &LFSObject{OID: testLFSOID1, Size: 1000}, To: &LFSObject{OID: testLFSOID2, Size: 2000}}
+	if !reflect.DeepEqual(fps.LFS, want) {
+		t.Errorf("got LFS change %+v, want %+v", fps.LFS, want)
+	}
+	if fps.LinesAdded != 0 || fps.LinesDeleted != 0 {
+		t.Errorf("got +%d -%d, the lines of the pointer files are not changes of the file", fps.LinesAdded, fps.LinesDeleted)
+	}
+	var buf bytes.Buffer
+	if err := res.Render(&buf, res.Page); err != nil {
+		t.Fatal(err)
+	}
+	if line := "assets/logo.png (LFS object " + testLFSOID1 + " (1000 bytes) -> " + testLFSOID2 + " (2000 bytes))"; !strings.Contains(buf.String(), line) {
+		t.Errorf("the text report does not contain %q:\n%s", line, buf.String())
+	}
+}
+
+func TestNotLFSPointer(t *testing.T) {
+	// a malformed pointer and a file that starts like a pointer, but is larger than a pointer can be
+	malformed := "version https://git-lfs.github.com/spec/v1\noid sha256:xyz\nsize 10\n"
+	oversized := testLFSPointer(testLFSOID1, 10) + "# " + strings.Repeat("x", maxLFSPointerSize) + "\n"
+	_, baseTree, forkTree := testTrees(t,
+		testFiles(map[string]string{"malformed.bin": malformed, "oversized.bin": oversized, "moved.bin": "real content\n"}),
+		testFiles(map[string]string{"malformed.bin": malformed + "size 11\n", "oversized.bin": oversized + "more\n", "moved.bin": testLFSPointer(testLFSOID1, 13)}))
+	patches, err := ComputePatches(context.Background(), baseTree, forkTree, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"malformed.bin", "oversized.bin", "moved.bin"} {
+		p, ok := patches.ByName[name]
+		if !ok {
+			t.Fatalf("no patch of %s", name)
+		}
+		if _, ok := p.(*lfsFilePatch); ok {
+			t.Errorf("%s is treated as an LFS pointer", name)
+		}
+		if len(p.Chunks()) == 0 {
+			t.Errorf("%s has no diff", name)
+		}
+	}
+}
@@ -0,0 +1,31 @@
+package forkdiff
+
+import "io"
+
+// sizeLimit counts the output that is written, to omit the diffs once the output would exceed a maximum size.
+type sizeLimit struct {
+	w       io.Writer
+	written int64
+	// max is the maximum output size in bytes, 0 to disable.
+	max int64
+	// reached is set once a diff did not fit within the limit.
+	reached bool
+}
+
+func (s *sizeLimit) Write(p []byte) (int, error) {
+	n, err := s.w.Write(p)
+	s.written += int64(n)
+	return n, err
+}
+
+// allow reports if n more bytes of diff fit within the limit.
+// Once a diff does not fit, no more diffs are allowed, so that only the last diffs are omitted.
+func (s *sizeLimit) allow(n int) bool {
+	if s.max == 0 {
+		return true
+	}
+	if !s.reached && s.written+int64(n) > s.max {
+		s.reached = true
+	}
+	return !s.reached
+}
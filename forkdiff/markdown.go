@@ -0,0 +1,413 @@
+package forkdiff
+
+import (
+	"fmt"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/gomarkdown/markdown"
+	"github.com/gomarkdown/markdown/ast"
+	"github.com/gomarkdown/markdown/html"
+	"github.com/gomarkdown/markdown/parser"
+	"io"
+	"path"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+)
+
+// maxIncludeSize is the maximum size of a file that may be included in markdown with includeFile.
+const maxIncludeSize = 64 * 1024
+
+// renderMarkdown renders markdown to HTML. Unless unsafe, raw HTML is escaped instead of passed through,
+// and only links to trusted protocols are rendered. With emoji, the emoji shortcodes like ":rocket:" are expanded.
+func renderMarkdown(md string, unsafe, emoji bool) string {
+	opts := html.RendererOptions{
+		Flags:     html.Smartypants | html.SmartypantsFractions | html.SmartypantsDashes | html.SmartypantsLatexDashes,
+		Generator: "forkdiff",
+	}
+	if !unsafe {
+		opts.Flags |= html.Safelink
+		opts.RenderNodeHook = escapeRawHTML
+	}
+	markdownRenderer := html.NewRenderer(opts)
+	markdownParser := parser.NewWithExtensions(parser.CommonExtensions | parser.OrderedListStart)
+	doc := markdown.Parse([]byte(md), markdownParser)
+	if emoji {
+		expandEmojiShortcodes(doc)
+	}
+	return string(markdown.Render(doc, markdownRenderer))
+}
+
+// escapeRawHTML is a render hook that renders raw HTML spans and blocks as escaped text.
+func escapeRawHTML(w io.Writer, node ast.Node, entering bool) (ast.WalkStatus, bool) {
+	switch n := node.(type) {
+	case *ast.HTMLSpan:
+		html.EscapeHTML(w, n.Literal)
+		return ast.GoToNext, true
+	case *ast.HTMLBlock:
+		_, _ = io.WriteString(w, "<p>")
+		html.EscapeHTML(w, n.Literal)
+		_, _ = io.WriteString(w, "</p>\n")
+		return ast.GoToNext, true
+	}
+	return ast.GoToNext, false
+}
+
+// expandTemplate executes a description, footer or title as a template with the given functions and data,
+// to process directives like {{ includeFile "path/to/file" }} and values like {{ .Fork.ShortHash }}.
+// The code spans and fenced code blocks are not part of the template, see literalCode.
+func expandTemplate(text string, funcs template.FuncMap, data *TemplateData) (string, error) {
+	if !strings.Contains(text, "{{") {
+		return text, nil
+	}
+	templ, err := parseTemplate(text, funcs)
+	if err != nil {
+		return "", err
+	}
+	var out strings.Builder
+	if err := templ.Execute(&out, data); err != nil {
+		return "", fmt.Errorf("failed to execute template: %w", err)
+	}
+	return out.String(), nil
+}
+
+// parseTemplate parses the text as template with the given functions, see expandTemplate.
+func parseTemplate(text string, funcs template.FuncMap) (*template.Template, error) {
+	templ, err := template.New("text").Funcs(funcs).Parse(literalCode(text))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse template: %w", err)
+	}
+	return templ, nil
+}
+
+// literalCode turns the fenced code blocks and code spans of markdown that contain "{{" into string constants
+// of a template, so they are kept as-is when the markdown is executed as template, like snippets of other templates.
+// An unclosed fence runs to the end of the text, like in CommonMark.
+func literalCode(md string) string {
+	var out, prose strings.Builder
+	lines := strings.SplitAfter(md, "\n")
+	for i := 0; i < len(lines); {
+		fence := codeFence(lines[i])
+		if fence == "" {
+			prose.WriteString(lines[i])
+			i++
+			continue
+		}
+		end := i + 1
+		for end < len(lines) && !isClosingFence(lines[end], fence) {
+			end++
+		}
+		if end < len(lines) {
+			end++
+		}
+		out.WriteString(literalCodeSpans(prose.String()))
+		prose.Reset()
+		out.WriteString(templateLiteral(strings.Join(lines[i:end], "")))
+		i = end
+	}
+	out.WriteString(literalCodeSpans(prose.String()))
+	return out.String()
+}
+
+// codeFence returns the fence that opens a fenced code block on the line, like "```" or "~~~~", or an empty string.
+func codeFence(line string) string {
+	trimmed := strings.TrimLeft(line, " ")
+	if len(line)-len(trimmed) > 3 || trimmed == "" || (trimmed[0] != '`' && trimmed[0] != '~') {
+		return ""
+	}
+	n := len(trimmed) - len(strings.TrimLeft(trimmed, trimmed[:1]))
+	if n < 3 || (trimmed[0] == '`' && strings.Contains(trimmed[n:], "`")) {
+		return ""
+	}
+	return trimmed[:n]
+}
+
+// isClosingFence returns true if the line closes the code block of the fence:
+// a fence of the same character that is at least as long, without info string.
+func isClosingFence(line, fence string) bool {
+	trimmed := strings.TrimLeft(line, " ")
+	if len(line)-len(trimmed) > 3 {
+		return false
+	}
+	rest := strings.TrimLeft(trimmed, fence[:1])
+	return len(trimmed)-len(rest) >= len(fence) && strings.TrimSpace(rest) == ""
+}
+
+// literalCodeSpans turns the code spans of markdown without fenced code blocks that contain "{{"
+// into string constants of a template, see literalCode. A code span is a run of backticks
+// up to the next run of the same length; a run without such end is literal text.
+func literalCodeSpans(md string) string {
+	var out strings.Builder
+	for {
+		start := strings.IndexByte(md, '`')
+		if start < 0 {
+			out.WriteString(md)
+			return out.String()
+		}
+		n := len(md[start:]) - len(strings.TrimLeft(md[start:], "`"))
+		end := -1
+		for i := start + n; i < len(md); {
+			j := strings.IndexByte(md[i:], '`')
+			if j < 0 {
+				break
+			}
+			i += j
+			m := len(md[i:]) - len(strings.TrimLeft(md[i:], "`"))
+			if m == n {
+				end = i + m
+				break
+			}
+			i += m
+		}
+		if end < 0 {
+			out.WriteString(md[:start+n])
+			md = md[start+n:]
+			continue
+		}
+		out.WriteString(md[:start])
+		out.WriteString(templateLiteral(md[start:end]))
+		md = md[end:]
+	}
+}
+
+// templateLiteral returns a template action that outputs the text as-is, or the text itself if it has no actions.
+func templateLiteral(text string) string {
+	if !strings.Contains(text, "{{") {
+		return text
+	}
+	return "{{" + strconv.Quote(text) + "}}"
+}
+
+// expandTemplate expands the templates in a title, description or footer of the page with expandTemplate,
+// if the page enables them with Page.Template, and otherwise returns the text as-is.
+func (r *Result) expandTemplate(text string) (string, error) {
+	if !r.Page.Template {
+		return text, nil
+	}
+	return expandTemplate(text, r.markdownFuncs(), r.templateData)
+}
+
+// checkTemplates parses the templates of the descriptions and footer of the page, if Page.Template enables them,
+// so a template that does not parse fails the analysis with a ConfigError that names its section,
+// instead of the rendering. The titles are checked when they are expanded, see expandTitles.
+func (r *Result) checkTemplates() error {
+	if !r.Page.Template {
+		return nil
+	}
+	funcs := r.markdownFuncs()
+	check := func(what, text string) error {
+		if !strings.Contains(text, "{{") {
+			return nil
+		}
+		if _, err := parseTemplate(text, funcs); err != nil {
+			return &ConfigError{Err: fmt.Errorf("invalid %s: %w", what, err)}
+		}
+		return nil
+	}
+	if err := check("page description", r.Page.Description); err != nil {
+		return err
+	}
+	if err := check("page footer", r.Page.Footer); err != nil {
+		return err
+	}
+	var walk func(fd *ForkDefinition) error
+	walk = func(fd *ForkDefinition) error {
+		if err := check(fmt.Sprintf("description of section %q", fd.Title), fd.Description); err != nil {
+			return err
+		}
+		if err := check(fmt.Sprintf("empty_description of section %q", fd.Title), fd.EmptyDescription); err != nil {
+			return err
+		}
+		for _, sub := range fd.Sub {
+			if err := walk(sub); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return walk(r.Page.Def)
+}
+
+// TemplateData is the data of the templates in the titles, descriptions and footer of a fork page definition.
+type TemplateData struct {
+	Base TemplateRef
+	Fork TemplateRef
+	// Target is the short name of the fork ref, like "main" for "refs/heads/main", or the short fork hash if there is no ref.
+	Target string
+	// Date is the committer date of the fork commit, formatted as YYYY-MM-DD.
+	Date string
+}
+
+// TemplateRef describes the base or fork commit in the TemplateData.
+type TemplateRef struct {
+	Name      string
+	URL       string
+	Ref       string
+	Hash      string
+	ShortHash string
+	// Date is the committer date of the commit, formatted as YYYY-MM-DD.
+	Date string
+}
+
+func newTemplateRef(ref *RefRepo, c *object.Commit) TemplateRef {
+	return TemplateRef{
+		Name:      ref.Name,
+		URL:       ref.URL,
+		Ref:       ref.Ref,
+		Hash:      c.Hash.String(),
+		ShortHash: c.Hash.String()[:7],
+		Date:      c.Committer.When.Format("2006-01-02"),
+	}
+}
+
+// expandTitles expands the templates in the titles of the definition and its sub-definitions.
+func (fd *ForkDefinition) expandTitles(funcs template.FuncMap, data *TemplateData) error {
+	title, err := expandTemplate(fd.Title, funcs, data)
+	if err != nil {
+		return fmt.Errorf("failed to expand the title of section %q: %w", fd.Title, err)
+	}
+	fd.Title = title
+	for _, sub := range fd.Sub {
+		if err := sub.expandTitles(funcs, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// includeFileMarkdown reads a file from the tree, and formats it as a fenced markdown code block.
+// The path must be relative to the root of the tree, and may not escape it.
+func includeFileMarkdown(tree *object.Tree, p string, language func(name string) string) (string, error) {
+	clean := path.Clean(p)
+	if path.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, "../") {
+		return "", fmt.Errorf("cannot include %q: path must be within the repository", p)
+	}
+	f, err := tree.File(clean)
+	if err != nil {
+		return "", fmt.Errorf("cannot include %q: %w", p, err)
+	}
+	if f.Size > maxIncludeSize {
+		return "", fmt.Errorf("cannot include %q: file is %d bytes, the limit is %d bytes", p, f.Size, maxIncludeSize)
+	}
+	if bin, err := f.IsBinary(); err != nil {
+		return "", fmt.Errorf("cannot include %q: %w", p, err)
+	} else if bin {
+		return "", fmt.Errorf("cannot include %q: binary file", p)
+	}
+	content, err := f.Contents()
+	if err != nil {
+		return "", fmt.Errorf("cannot include %q: %w", p, err)
+	}
+	if !strings.HasSuffix(content, "\n") {
+		content += "\n"
+	}
+	// the fence must be longer than any backtick sequence in the content itself
+	fence := "```"
+	for strings.Contains(content, fence) {
+		fence += "`"
+	}
+	return fmt.Sprintf("\n%s%s\n%s%s\n", fence, language(clean), content, fence), nil
+}
+
+// markdownSources returns the markdown of the page that is rendered to HTML: the description and footer,
+// the shown descriptions of the sections and the ignored changes, and the line comments.
+// The templates in the descriptions and footer are expanded; those that fail to expand are left out,
+// the error is reported when the page is rendered.
+func (r *Result) markdownSources(p *Page) []string {
+	var out []string
+	add := func(md string, expand bool) {
+		if md == "" {
+			return
+		}
+		if expand {
+			expanded, err := r.expandTemplate(md)
+			if err != nil {
+				return
+			}
+			md = expanded
+		}
+		out = append(out, md)
+	}
+	add(p.Description, true)
+	add(p.Footer, true)
+	var walk func(fd *ForkDefinition)
+	walk = func(fd *ForkDefinition) {
+		add(fd.ShownDescription(), true)
+		for _, sub := range fd.Sub {
+			walk(sub)
+		}
+	}
+	walk(p.Def)
+	if p.Ignored != nil {
+		walk(p.Ignored)
+	}
+	for i := range p.Comments {
+		add(p.Comments[i].Comment, false)
+	}
+	return out
+}
+
+// prerenderMarkdown renders the markdown of the page, see markdownSources, with Options.MarkdownWorkers
+// concurrent workers, and caches the HTML by markdown source for renderCachedMarkdown.
+// Every render has its own parser and renderer, see renderMarkdown, so the workers share no state.
+func (r *Result) prerenderMarkdown(p *Page) {
+	workers := r.Options.MarkdownWorkers
+	if workers == 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	if workers < 2 {
+		// rendered while executing the page template
+		return
+	}
+	if r.markdownHTML == nil {
+		r.markdownHTML = make(map[string]string)
+	}
+	seen := make(map[string]struct{})
+	var todo []string
+	for _, md := range r.markdownSources(p) {
+		if _, ok := r.markdownHTML[md]; ok {
+			continue
+		}
+		if _, ok := seen[md]; ok {
+			continue
+		}
+		seen[md] = struct{}{}
+		todo = append(todo, md)
+	}
+	if len(todo) < 2 {
+		return
+	}
+	if workers > len(todo) {
+		workers = len(todo)
+	}
+	rendered := make([]string, len(todo))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				rendered[i] = renderMarkdown(todo[i], r.Options.MarkdownUnsafe, !r.Options.NoEmoji)
+			}
+		}()
+	}
+	for i := range todo {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	for i, md := range todo {
+		r.markdownHTML[md] = rendered[i]
+	}
+}
+
+// renderCachedMarkdown returns the HTML of the markdown from the cache of prerenderMarkdown,
+// or renders it if it is not in the cache.
+func (r *Result) renderCachedMarkdown(md string) string {
+	if out, ok := r.markdownHTML[md]; ok {
+		return out
+	}
+	return renderMarkdown(md, r.Options.MarkdownUnsafe, !r.Options.NoEmoji)
+}
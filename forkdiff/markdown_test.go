@@ -0,0 +1,95 @@
+package forkdiff
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"text/template"
+)
+
+func TestExpandTemplate(t *testing.T) {
+	data := &TemplateData{Fork: TemplateRef{ShortHash: "abc1234"}, Target: "main"}
+	funcs := template.FuncMap{"includeFile": func(path string) (string, error) { return "<" + path + ">", nil }}
+	tests := []struct {
+		name, in, want string
+	}{
+		{"plain", "no actions", "no actions"},
+		{"value", "as of {{ .Target }}", "as of main"},
+		{"function", `{{ includeFile "a.toml" }}`, "<a.toml>"},
+		{"helm code span", "set `{{ .Values.image }}` to {{ .Fork.ShortHash }}", "set `{{ .Values.image }}` to abc1234"},
+		{"double backtick span", "``{{ a `b` }}`` {{ .Target }}", "``{{ a `b` }}`` main"},
+		{"unclosed backtick", "a ` b {{ .Target }}", "a ` b main"},
+		{"fenced block", "{{ .Target }}\n```yaml\nimage: {{ .Values.image }}\n```\nafter", "main\n```yaml\nimage: {{ .Values.image }}\n```\nafter"},
+		{"tilde fence", "~~~~\n{{ x }}\n~~~\n~~~~\n{{ .Target }}", "~~~~\n{{ x }}\n~~~\n~~~~\nmain"},
+		{"unclosed fence", "```\n{{ .Values }}\n", "```\n{{ .Values }}\n"},
+		{"condition around code", "{{ if .Target }}`{{ x }}`{{ end }}", "`{{ x }}`"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := expandTemplate(tt.in, funcs, data)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExpandTemplateParseError(t *testing.T) {
+	for _, in := range []string{"hello {{ user.name }}", `{{ includeFile "x"`} {
+		if _, err := expandTemplate(in, template.FuncMap{"includeFile": func(string) string { return "" }}, &TemplateData{}); err == nil {
+			t.Errorf("expected an error for %q", in)
+		}
+	}
+}
+
+func TestCheckTemplates(t *testing.T) {
+	repo, _, _ := testTrees(t, testFiles(map[string]string{"a": "a\n"}), testFiles(map[string]string{"a": "b\n"}))
+	def := &ForkDefinition{
+		Title: "root",
+		Sub:   []*ForkDefinition{{Title: "config", Globs: []string{"a"}, Description: `see {{ includeFile "a"`}},
+	}
+	page := &Page{
+		Base:     RefRepo{Name: "base", Ref: "refs/heads/base"},
+		Fork:     RefRepo{Name: "fork", Ref: "refs/heads/fork"},
+		Def:      def,
+		Template: true,
+	}
+	_, err := Analyze(&Options{Repo: repo, Page: page})
+	var configErr *ConfigError
+	if !errors.As(err, &configErr) || !strings.Contains(err.Error(), `section "config"`) {
+		t.Fatalf("got %v, want a ConfigError that names the section", err)
+	}
+	// without templates, the text is not parsed at all
+	page.Template = false
+	if _, err := Analyze(&Options{Repo: repo, Page: page}); err != nil {
+		t.Errorf("unexpected error without templates: %v", err)
+	}
+}
+
+func TestExpandTemplateExecError(t *testing.T) {
+	if _, err := expandTemplate("{{ .Values.image }}", nil, &TemplateData{}); err == nil {
+		t.Fatal("expected an error for an unknown field outside of code")
+	}
+}
+
+func TestResultExpandTemplate(t *testing.T) {
+	r := &Result{Page: &Page{}, templateData: &TemplateData{Target: "main"}}
+	got, err := r.expandTemplate("{{ .Values.image }} as of {{ .Target }}")
+	if err != nil {
+		t.Fatalf("unexpected error without templates: %v", err)
+	}
+	if want := "{{ .Values.image }} as of {{ .Target }}"; got != want {
+		t.Errorf("got %q, want %q without templates", got, want)
+	}
+	r.Page.Template = true
+	got, err = r.expandTemplate(`{{ "{{" }} .Target }} is {{ .Target }}`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := "{{ .Target }} is main"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,89 @@
+package forkdiff
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+)
+
+// maxFaviconSize is the maximum size of a favicon file that is embedded in the page.
+const maxFaviconSize = 256 << 10
+
+// faviconTypes are the media types of the favicon files by extension,
+// since the system MIME types do not include all of them.
+var faviconTypes = map[string]string{
+	".ico":  "image/x-icon",
+	".png":  "image/png",
+	".svg":  "image/svg+xml",
+	".gif":  "image/gif",
+	".jpg":  "image/jpeg",
+	".jpeg": "image/jpeg",
+	".webp": "image/webp",
+}
+
+// LoadFavicon returns the favicon of the path, like that of Page.Favicon, but with a file path relative to the
+// working directory: a data URI or http(s) URL is returned as-is, the file of another path is embedded as a data URI.
+// Errors are ConfigError errors.
+func LoadFavicon(p string) (string, error) {
+	uri, err := faviconURI(p, os.ReadFile)
+	if err != nil {
+		return "", &ConfigError{Err: err}
+	}
+	return uri, nil
+}
+
+// faviconURI returns the data URI or URL of a favicon, see Page.Favicon. The file of a path is read with read.
+func faviconURI(p string, read func(name string) ([]byte, error)) (string, error) {
+	if strings.HasPrefix(p, "data:") || IsPageURL(p) {
+		return p, nil
+	}
+	data, err := read(p)
+	if err != nil {
+		return "", fmt.Errorf("failed to read favicon: %w", err)
+	}
+	if len(data) > maxFaviconSize {
+		return "", fmt.Errorf("favicon %q is larger than %d bytes", p, maxFaviconSize)
+	}
+	mediaType, ok := faviconTypes[strings.ToLower(path.Ext(p))]
+	if !ok {
+		mediaType = http.DetectContentType(data)
+	}
+	if !strings.HasPrefix(mediaType, "image/") {
+		return "", fmt.Errorf("favicon %q is not an image, but %s", p, mediaType)
+	}
+	return "data:" + mediaType + ";base64," + base64.StdEncoding.EncodeToString(data), nil
+}
+
+// loadFavicon embeds the favicon file of the page, if it refers to one, as a data URI.
+// The file is read with read, by its path relative to the fork page definition.
+func (p *Page) loadFavicon(read func(name string) ([]byte, error)) error {
+	if p.Favicon == "" {
+		return nil
+	}
+	uri, err := faviconURI(p.Favicon, read)
+	if err != nil {
+		return err
+	}
+	p.Favicon = uri
+	return nil
+}
+
+// PageDescription is the description of the page in its metadata, for search engines and link previews:
+// the MetaDescription, or else a summary of the changes after the title.
+func (p *Page) PageDescription() string {
+	if p.MetaDescription != "" {
+		return p.MetaDescription
+	}
+	if len(p.Targets) > 0 {
+		return fmt.Sprintf("%s: the changes of %d fork targets", p.Title, len(p.Targets))
+	}
+	if p.Def == nil {
+		return p.Title
+	}
+	return fmt.Sprintf("%s: %d changed file%s, %d line%s added and %d line%s deleted",
+		p.Title, p.Def.FileCount, plural(p.Def.FileCount),
+		p.Def.LinesAdded, plural(p.Def.LinesAdded), p.Def.LinesDeleted, plural(p.Def.LinesDeleted))
+}
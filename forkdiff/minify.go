@@ -0,0 +1,165 @@
+package forkdiff
+
+import (
+	"bytes"
+	"golang.org/x/net/html"
+	"regexp"
+	"strings"
+)
+
+// preformattedClasses are the classes of the page elements that are styled with "white-space: pre-wrap",
+// in which the whitespace is significant, like in the diffs, see minifyHTML.
+var preformattedClasses = []string{"term-container", "commit-message", "hunk-note"}
+
+// blockElements are the elements around which whitespace is not rendered, so that it can be dropped,
+// unlike around inline elements, where a space separates words.
+var blockElements = map[string]bool{
+	"html": true, "head": true, "body": true, "title": true, "meta": true, "link": true, "script": true, "style": true,
+	"div": true, "p": true, "ul": true, "ol": true, "li": true, "dl": true, "dt": true, "dd": true,
+	"table": true, "thead": true, "tbody": true, "tr": true, "th": true, "td": true,
+	"h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true, "hr": true, "br": true,
+	"details": true, "summary": true, "nav": true, "section": true, "header": true, "footer": true, "main": true,
+	"form": true, "select": true, "option": true, "pre": true, "blockquote": true, "svg": true,
+}
+
+var whitespaceRunRegexp = regexp.MustCompile(`[ \t\r\n\f]+`)
+
+// minifyHTML minifies a rendered page, see Options.Minify: it drops the comments, collapses runs of whitespace
+// in the text to a single space, and drops the whitespace around block elements.
+// The content of pre, textarea, script and style elements, and of the elements with preformattedClasses, like the diffs,
+// is kept as-is, as are the attribute values.
+func minifyHTML(src []byte) []byte {
+	type openElement struct {
+		name     string
+		preserve bool
+	}
+	var stack []openElement
+	preserving := func() bool {
+		return len(stack) > 0 && stack[len(stack)-1].preserve
+	}
+	var out bytes.Buffer
+	out.Grow(len(src))
+	// pending is collapsed whitespace that is written before the next token, unless it is next to a block element
+	pending, afterBlock := false, true
+	z := html.NewTokenizer(bytes.NewReader(src))
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			// the end of the page, the tokenizer does not fail on malformed HTML
+			break
+		}
+		raw := z.Raw()
+		switch tt {
+		case html.CommentToken:
+			// conditional comments are markup for old browsers
+			if !bytes.HasPrefix(raw, []byte("<!--[if")) {
+				continue
+			}
+		case html.TextToken:
+			if preserving() {
+				break
+			}
+			text := whitespaceRunRegexp.ReplaceAll(raw, []byte(" "))
+			if bytes.HasPrefix(text, []byte(" ")) {
+				pending, text = !afterBlock, text[1:]
+			}
+			if len(text) == 0 {
+				continue
+			}
+			if pending {
+				out.WriteByte(' ')
+				pending = false
+			}
+			pending = bytes.HasSuffix(text, []byte(" "))
+			out.Write(bytes.TrimSuffix(text, []byte(" ")))
+			afterBlock = false
+			continue
+		case html.StartTagToken, html.EndTagToken, html.SelfClosingTagToken:
+			name, hasAttr := z.TagName()
+			tag := string(name)
+			if tt == html.StartTagToken && !isVoidElement(tag) {
+				preserve := preserving() || tag == "pre" || tag == "textarea" || tag == "script" || tag == "style"
+				for hasAttr && !preserve {
+					var key, val []byte
+					key, val, hasAttr = z.TagAttr()
+					if string(key) == "class" && hasPreformattedClass(string(val)) {
+						preserve = true
+					}
+				}
+				stack = append(stack, openElement{name: tag, preserve: preserve})
+			} else if tt == html.EndTagToken {
+				// any elements that were left open, like list items without end tag, are closed with their parent
+				for i := len(stack) - 1; i >= 0; i-- {
+					if stack[i].name == tag {
+						stack = stack[:i]
+						break
+					}
+				}
+			}
+			if pending && !blockElements[tag] {
+				out.WriteByte(' ')
+			}
+			pending, afterBlock = false, blockElements[tag]
+			out.Write(collapseTagWhitespace(raw))
+			continue
+		}
+		if pending {
+			out.WriteByte(' ')
+			pending = false
+		}
+		afterBlock = false
+		out.Write(raw)
+	}
+	return out.Bytes()
+}
+
+// collapseTagWhitespace collapses the runs of whitespace between the attributes of a tag to a single space,
+// and drops the whitespace before the end of the tag. Quoted attribute values are kept as-is.
+func collapseTagWhitespace(raw []byte) []byte {
+	out := make([]byte, 0, len(raw))
+	var quote byte
+	space := false
+	for _, c := range raw {
+		if quote != 0 {
+			if c == quote {
+				quote = 0
+			}
+			out = append(out, c)
+			continue
+		}
+		switch c {
+		case ' ', '\t', '\r', '\n', '\f':
+			space = true
+			continue
+		case '"', '\'':
+			quote = c
+		}
+		if space && c != '>' {
+			out = append(out, ' ')
+		}
+		space = false
+		out = append(out, c)
+	}
+	return out
+}
+
+// hasPreformattedClass returns true if the class attribute has one of the preformattedClasses.
+func hasPreformattedClass(class string) bool {
+	for _, c := range strings.Fields(class) {
+		for _, pc := range preformattedClasses {
+			if c == pc {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// isVoidElement returns true for the elements that have no end tag.
+func isVoidElement(tag string) bool {
+	switch tag {
+	case "area", "base", "br", "col", "embed", "hr", "img", "input", "link", "meta", "source", "track", "wbr":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,65 @@
+package forkdiff
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestNaturalLess(t *testing.T) {
+	tests := []struct {
+		in, want []string
+	}{
+		{[]string{"file10", "file2", "file1"}, []string{"file1", "file2", "file10"}},
+		{[]string{"v1.10.0", "v1.9.2", "v1.9.10"}, []string{"v1.9.2", "v1.9.10", "v1.10.0"}},
+		{[]string{"a/file02.go", "a/file2.go", "a/file1.go"}, []string{"a/file1.go", "a/file2.go", "a/file02.go"}},
+		{[]string{"b", "a10", "a", "a9z"}, []string{"a", "a9z", "a10", "b"}},
+		{[]string{"x99999999999999999999999", "x100000000000000000000000"}, []string{"x99999999999999999999999", "x100000000000000000000000"}},
+	}
+	for _, tt := range tests {
+		got := append([]string(nil), tt.in...)
+		sort.Slice(got, func(i, j int) bool { return naturalLess(got[i], got[j]) })
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("sorted %v to %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestNaturalSortFiles(t *testing.T) {
+	files := map[string]string{}
+	for _, p := range []string{"util/file10.go", "util/file2.go", "util/file1.go", "file10.txt", "file2.txt", "file1.txt"} {
+		files[p] = "old " + p + "\n"
+	}
+	fork := map[string]string{}
+	for p := range files {
+		fork[p] = "new " + p + "\n"
+	}
+	repo, _, _ := testTrees(t, testFiles(files), testFiles(fork))
+	paths := func(fd *ForkDefinition) []string {
+		var out []string
+		for _, f := range fd.Files {
+			out = append(out, f.Path)
+		}
+		return out
+	}
+	for _, natural := range []bool{false, true} {
+		def := &ForkDefinition{Title: "root", Sub: []*ForkDefinition{{Title: "util", Dirs: []string{"util"}}}}
+		res := analyzeTest(t, repo, def, Options{NaturalSort: natural})
+		section, remaining := def.Sub[0], def.Sub[1]
+		wantSection := []string{"util/file1.go", "util/file10.go", "util/file2.go"}
+		wantRemaining := []string{"file1.txt", "file10.txt", "file2.txt"}
+		if natural {
+			wantSection = []string{"util/file1.go", "util/file2.go", "util/file10.go"}
+			wantRemaining = []string{"file1.txt", "file2.txt", "file10.txt"}
+		}
+		if got := paths(section); !reflect.DeepEqual(got, wantSection) {
+			t.Errorf("natural sort %v: got section files %v, want %v", natural, got, wantSection)
+		}
+		if remaining != res.remainingDef {
+			t.Fatalf("natural sort %v: the last section is not that of the remaining files", natural)
+		}
+		if got := paths(remaining); !reflect.DeepEqual(got, wantRemaining) {
+			t.Errorf("natural sort %v: got remaining files %v, want %v", natural, got, wantRemaining)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package forkdiff
+
+import (
+	"errors"
+	"fmt"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"strings"
+)
+
+// notesRef is the default git notes ref, as written by "git notes add".
+const notesRef = plumbing.ReferenceName("refs/notes/commits")
+
+// notesReader reads the git notes of commits from the tree of the notes ref.
+type notesReader struct {
+	// tree is nil if the repository has no notes.
+	tree  *object.Tree
+	notes map[plumbing.Hash]string
+}
+
+func newNotesReader(repo *git.Repository) (*notesReader, error) {
+	out := &notesReader{notes: make(map[plumbing.Hash]string)}
+	ref, err := repo.Reference(notesRef, true)
+	if errors.Is(err, plumbing.ErrReferenceNotFound) {
+		return out, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to find notes ref %q: %w", notesRef, err)
+	}
+	commit, err := repo.CommitObject(ref.Hash())
+	if err != nil {
+		return nil, fmt.Errorf("failed to open notes commit %s: %w", ref.Hash(), err)
+	}
+	out.tree, err = commit.Tree()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open tree of notes commit %s: %w", ref.Hash(), err)
+	}
+	return out, nil
+}
+
+// note returns the note of the given commit, or an empty string if it has none.
+// Notes may be stored under a fanout of the hash, like "ab/cdef...", which is tried per level.
+func (n *notesReader) note(h plumbing.Hash) (string, error) {
+	if n.tree == nil {
+		return "", nil
+	}
+	if note, ok := n.notes[h]; ok {
+		return note, nil
+	}
+	hex := h.String()
+	var dirs []string
+	for len(hex) > 2 {
+		f, err := n.tree.File(strings.Join(append(dirs, hex), "/"))
+		if err == nil {
+			content, err := f.Contents()
+			if err != nil {
+				return "", fmt.Errorf("failed to read note of commit %s: %w", h, err)
+			}
+			note := strings.TrimSpace(content)
+			n.notes[h] = note
+			return note, nil
+		}
+		if !errors.Is(err, object.ErrFileNotFound) {
+			return "", fmt.Errorf("failed to find note of commit %s: %w", h, err)
+		}
+		dirs = append(dirs, hex[:2])
+		hex = hex[2:]
+	}
+	n.notes[h] = ""
+	return "", nil
+}
@@ -0,0 +1,51 @@
+package forkdiff
+
+import (
+	"bytes"
+	"github.com/go-git/go-git/v5/plumbing"
+	"strings"
+	"testing"
+)
+
+func TestGroupByCommitNotes(t *testing.T) {
+	repo, _, _ := testTrees(t,
+		testFiles(map[string]string{"main.go": "package main\n"}),
+		testFiles(map[string]string{"main.go": "package main\n\nfunc main() {}\n"}))
+	fork, err := repo.Reference(plumbing.NewBranchReferenceName("fork"), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// git notes stores the note of a commit in a file named by the commit hash, here with a fanout directory
+	hex := fork.Hash().String()
+	notes := commitTestFiles(t, repo, "notes", "notes", testFiles(map[string]string{hex[:2] + "/" + hex[2:]: "reviewed <ok>\n"}))
+	if err := repo.Storer.SetReference(plumbing.NewHashReference(notesRef, notes.Hash)); err != nil {
+		t.Fatal(err)
+	}
+	res := analyzeTest(t, repo, &ForkDefinition{Title: "root"}, Options{GroupBy: "commit", ShowNotes: true})
+	if len(res.Page.Commits) != 1 || res.Page.Commits[0].Note != "reviewed <ok>" {
+		t.Fatalf("got commits %+v", res.Page.Commits)
+	}
+	var buf bytes.Buffer
+	if err := res.Render(&buf, res.Page); err != nil {
+		t.Fatal(err)
+	}
+	if want := `<pre class="commit-note small mb-0">reviewed &lt;ok&gt;</pre>`; !strings.Contains(buf.String(), want) {
+		t.Errorf("the page does not contain the note %s", want)
+	}
+	res.Options.Format = "text"
+	buf.Reset()
+	if err := res.Render(&buf, res.Page); err != nil {
+		t.Fatal(err)
+	}
+	if want := "Notes:\n    reviewed <ok>\n"; !strings.Contains(buf.String(), want) {
+		t.Errorf("the text report does not contain the note %q:\n%s", want, buf.String())
+	}
+}
+
+func TestShowNotesRequiresCommits(t *testing.T) {
+	repo, _, _ := testTrees(t, testFiles(map[string]string{"a": "a\n"}), testFiles(map[string]string{"a": "b\n"}))
+	opts := Options{Repo: repo, Page: &Page{Def: &ForkDefinition{}}, ShowNotes: true}
+	if err := opts.check(); err == nil {
+		t.Error("expected an error for notes without blame or grouping by commit")
+	}
+}
@@ -0,0 +1,41 @@
+package forkdiff
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// outlineEscaper escapes the markdown syntax in section titles, so they are shown as they are.
+var outlineEscaper = strings.NewReplacer(`\`, `\\`, "`", "\\`", "*", `\*`, "_", `\_`, "[", `\[`, "]", `\]`, "<", `\<`)
+
+// WriteOutline writes the outline of the sections of the page to w, as a nested markdown list
+// of the section titles with their file and line counts, independent of the output format.
+// If pageLink is not empty, the titles link to the sections on the page at pageLink, which may be relative.
+// The ignored files are listed last, if there are any.
+func (r *Result) WriteOutline(w io.Writer, pageLink string) error {
+	var out strings.Builder
+	out.WriteString("# " + outlineEscaper.Replace(r.Page.Title) + "\n\n")
+	writeOutlineSection(&out, r.Page.Def, 0, pageLink)
+	if r.Page.Ignored != nil {
+		writeOutlineSection(&out, r.Page.Ignored, 0, pageLink)
+	}
+	_, err := io.WriteString(w, out.String())
+	return err
+}
+
+// writeOutlineSection writes the list item of a section, and those of its sub-sections indented below it.
+func writeOutlineSection(out *strings.Builder, fd *ForkDefinition, depth int, pageLink string) {
+	title := outlineEscaper.Replace(fd.Title)
+	if fd.Title == "" {
+		title = "(untitled)"
+	}
+	if pageLink != "" {
+		title = fmt.Sprintf("[%s](%s#%s)", title, pageLink, fd.ID)
+	}
+	fmt.Fprintf(out, "%s- %s: %d file%s (+%d -%d)\n", strings.Repeat("  ", depth), title,
+		fd.FileCount, plural(fd.FileCount), fd.LinesAdded, fd.LinesDeleted)
+	for _, sub := range fd.Sub {
+		writeOutlineSection(out, sub, depth+1, pageLink)
+	}
+}
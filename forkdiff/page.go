@@ -0,0 +1,715 @@
+package forkdiff
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/go-git/go-git/v5/plumbing/format/diff"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"gopkg.in/yaml.v3"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ReadPage reads a fork page definition from a YAML file,
+// and loads the description files it references, relative to the YAML file.
+// Errors are ConfigError errors.
+func ReadPage(path string) (*Page, error) {
+	page, err := readPage(path)
+	if err != nil {
+		return nil, &ConfigError{Err: err}
+	}
+	return page, nil
+}
+
+func readPage(path string) (*Page, error) {
+	f, err := os.OpenFile(path, os.O_RDONLY, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read page YAML file: %w", err)
+	}
+	defer f.Close()
+	// the bytes are kept for Options.EmbedDefinition, since the file may be a stream like /dev/stdin that cannot be read again
+	source, err := io.ReadAll(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read page YAML file: %w", err)
+	}
+	page, err := decodePage(source)
+	if err != nil {
+		return nil, err
+	}
+	read := func(name string) ([]byte, error) {
+		p, err := resolveDefinitionPath(filepath.Dir(path), name)
+		if err != nil {
+			return nil, err
+		}
+		return os.ReadFile(p)
+	}
+	if err := page.Def.loadDescriptionFiles(read); err != nil {
+		return nil, fmt.Errorf("failed to load description files: %w", err)
+	}
+	if err := page.loadFavicon(read); err != nil {
+		return nil, err
+	}
+	return page, nil
+}
+
+// decodePage decodes a fork page definition from YAML, without loading the description files it references.
+func decodePage(source []byte) (*Page, error) {
+	dec := yaml.NewDecoder(bytes.NewReader(source))
+	dec.KnownFields(true)
+	var page Page
+	if err := dec.Decode(&page); err != nil {
+		return nil, fmt.Errorf("failed to decode page YAML file: %w", err)
+	}
+	page.source = source
+	if page.Def == nil {
+		return nil, errors.New("no root fork definition defined")
+	}
+	return &page, nil
+}
+
+// resolveDefinitionPath resolves the path of an auxiliary file that is referenced by the fork page definition.
+// Paths are relative to the directory of the definition file, and may not escape that directory.
+func resolveDefinitionPath(baseDir string, p string) (string, error) {
+	if filepath.IsAbs(p) {
+		return "", fmt.Errorf("path %q must be relative to the fork page definition", p)
+	}
+	joined := filepath.Join(baseDir, p)
+	rel, err := filepath.Rel(baseDir, joined)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("path %q escapes the directory of the fork page definition", p)
+	}
+	return joined, nil
+}
+
+type RefRepo struct {
+	Name string `yaml:"name"`
+	Ref  string `yaml:"ref,omitempty"`
+	Hash string `yaml:"hash,omitempty"`
+	URL  string `yaml:"url"`
+}
+
+type Page struct {
+	Title string `yaml:"title"`
+	// Description is an optional markdown introduction of the fork, rendered above the sections.
+	Description string          `yaml:"description,omitempty"`
+	Footer      string          `yaml:"footer"`
+	Base        RefRepo         `yaml:"base"`
+	Fork        RefRepo         `yaml:"fork"`
+	Def         *ForkDefinition `yaml:"def"`
+	Ignore      []string        `yaml:"ignore"`
+	// GlobCaseInsensitive matches the section, ignore and language globs regardless of case,
+	// for forks developed on case-insensitive filesystems. The paths are still displayed with their own case.
+	GlobCaseInsensitive bool `yaml:"glob_case_insensitive,omitempty"`
+	// Languages overrides the language of files, for syntax highlighting. The first matching glob applies.
+	Languages []LanguageOverride `yaml:"languages,omitempty"`
+	// Submodules are the repository URLs of submodules, by path, to link the submodule commits of the diffs.
+	Submodules []SubmoduleURL `yaml:"submodules,omitempty"`
+	// Comments are rendered within the diffs of the files they comment on, like an annotated walkthrough of the fork.
+	Comments []LineComment `yaml:"comments,omitempty"`
+	// Textconv converts files to text before diffing them, by glob. The first matching glob applies.
+	// The filters run commands, so they are only applied with Options.Textconv.
+	Textconv []TextconvFilter `yaml:"textconv,omitempty"`
+	// Favicon is the icon of the page: a data URI, an http(s) URL,
+	// or the path of an image file relative to the definition, that is embedded as a data URI.
+	Favicon string `yaml:"favicon,omitempty"`
+	// Template processes the page and section titles, the descriptions and the footer as Go templates,
+	// with the TemplateData and functions like includeFile, see expandTemplate.
+	// It is off by default, so the text of a definition may contain "{{", like the placeholders of other templates.
+	Template bool `yaml:"template,omitempty"`
+	// MetaDescription is the description of the page for search engines and link previews,
+	// a summary of the changes if empty, see PageDescription.
+	MetaDescription string `yaml:"meta_description,omitempty"`
+
+	Ignored *ForkDefinition `yaml:"-"`
+	// StructureChanges compares the categorization with that of the -baseline definition, if any.
+	StructureChanges *StructureChanges `yaml:"-"`
+	// Since lists the changes since a previous fork commit, if Options.Since is set.
+	Since *SinceChanges `yaml:"-"`
+	// Divergence is the position of the fork relative to the base in the commit graph, if Options.Divergence is set.
+	Divergence *Divergence `yaml:"-"`
+	// Contributors are the authors and co-authors of the fork commits, if Options.Contributors is set.
+	Contributors []Contributor `yaml:"-"`
+	// Upstream are the changes upstream since the base, if Options.Upstream is set.
+	Upstream *UpstreamChanges `yaml:"-"`
+	// ListedFiles is the number of files that are only listed, without their diff, with Options.Top.
+	ListedFiles int `yaml:"-"`
+	// Targets are the rendered pages of multiple fork targets, on a page that combines them, see RenderTargets.
+	Targets []TargetTab `yaml:"-"`
+	// TargetMatrix lists which files each of the Targets changes.
+	TargetMatrix *TargetMatrix `yaml:"-"`
+	// Commits are the changes of each fork commit, if the changes are grouped by commit.
+	Commits []CommitChanges `yaml:"-"`
+	// Split lists the top-level sections that are rendered to separate pages, on the index page in split mode.
+	Split []SplitSection `yaml:"-"`
+	// IndexLink is the relative link to the index page, on section pages in split mode.
+	IndexLink string `yaml:"-"`
+
+	// source is the YAML that ReadPage read the definition from, nil if it was not read from a file.
+	source []byte
+	// sectionFragment renders only the section of Def, without anything around it, see SectionFragments.
+	sectionFragment bool
+}
+
+// LanguageOverride sets the language of the files that match the glob,
+// for files of which the extension does not determine the language.
+type LanguageOverride struct {
+	Glob     string `yaml:"glob"`
+	Language string `yaml:"language"`
+}
+
+// fileLanguage returns the language of a file for syntax highlighting:
+// that of the first matching language override, or else the file extension.
+func (p *Page) fileLanguage(name string) string {
+	for _, l := range p.Languages {
+		if ok, _ := matchGlob(l.Glob, name, p.GlobCaseInsensitive); ok {
+			return l.Language
+		}
+	}
+	return strings.TrimPrefix(path.Ext(name), ".")
+}
+
+// checkLanguages returns an error if any of the language override globs is invalid.
+func (p *Page) checkLanguages() error {
+	for i, l := range p.Languages {
+		if _, err := filepath.Match(l.Glob, ""); err != nil {
+			return fmt.Errorf("invalid glob %d (%q) of language %q: %w", i, l.Glob, l.Language, err)
+		}
+	}
+	return nil
+}
+
+// SubmoduleURL is the repository URL of the submodule at the path,
+// like "https://github.com/org/dep", of which the commits are linked as "<url>/commit/<hash>".
+type SubmoduleURL struct {
+	Path string `yaml:"path"`
+	URL  string `yaml:"url"`
+}
+
+// submoduleCommitURL returns the URL of the commit of the submodule at the path,
+// or an empty string if the URL of the submodule is not set.
+func (p *Page) submoduleCommitURL(path, hash string) string {
+	for _, s := range p.Submodules {
+		if s.Path == path {
+			return strings.TrimSuffix(s.URL, "/") + "/commit/" + hash
+		}
+	}
+	return ""
+}
+
+// checkSubmodules returns an error if any of the submodules has no path or URL.
+func (p *Page) checkSubmodules() error {
+	for i, s := range p.Submodules {
+		if s.Path == "" || s.URL == "" {
+			return fmt.Errorf("submodule %d (%q) needs both a path and a URL", i, s.Path)
+		}
+	}
+	return nil
+}
+
+type FilePatchStats struct {
+	// ID is the HTML anchor of the file, derived from its path.
+	ID           string
+	Path         string
+	LinesAdded   int
+	LinesDeleted int
+	Binary       bool
+	// TooLarge is true if the diff was omitted because of the file size limit.
+	TooLarge bool
+	// Size is the largest blob size of the two sides, only set if TooLarge.
+	Size int64
+	// NewlineAtEOF is "added" or "removed" if the file gained or lost the newline at the end of the file.
+	NewlineAtEOF string
+	// BOM is "added" or "removed" if the file gained or lost a UTF-8 byte order mark.
+	BOM string
+	// ChangedSince is true if the file changed since the Options.Since commit.
+	ChangedSince bool
+	// LastCommit is the latest commit of the fork history that changed the file, with Options.LastChanged.
+	LastCommit *object.Commit
+	// Listed is true if the file is only listed, without its diff, because it is not one of the Options.Top files.
+	Listed bool
+	// Submodule is set if the file is a submodule (gitlink) in the base or fork.
+	Submodule *SubmoduleChange
+	// Symlink is set if the file is a symlink in the base and/or fork.
+	Symlink *SymlinkChange
+	// LFS is set if the file is a git LFS pointer file in the base and/or fork.
+	LFS   *LFSChange
+	Patch diff.FilePatch
+
+	// context is the ForkDefinition.Context of the section the file is listed in, nil to use Options.Context.
+	context *int
+}
+
+// SymlinkChange describes the change of a symlink target.
+// From is empty if the symlink was added, To is empty if it was removed.
+type SymlinkChange struct {
+	From string
+	To   string
+}
+
+// SubmoduleChange describes the change of a submodule commit pointer.
+// From is empty if the submodule was added, To is empty if it was removed.
+type SubmoduleChange struct {
+	From string
+	To   string
+}
+
+type ForkDefinition struct {
+	Title       string `yaml:"title,omitempty"`
+	Description string `yaml:"description,omitempty"`
+	// DescriptionFile is a markdown file to use as description, relative to the fork page definition.
+	DescriptionFile string `yaml:"description_file,omitempty"`
+	// EmptyDescription is markdown that is shown instead of the description if no changed files are in the section,
+	// like "No changes to the networking layer in this release".
+	EmptyDescription string   `yaml:"empty_description,omitempty"`
+	Globs            []string `yaml:"globs,omitempty"`
+	// Dirs claims all files under these directories, at any depth,
+	// and the files are rendered as a tree of the directories, instead of in the flat list of files.
+	Dirs []string          `yaml:"dirs,omitempty"`
+	Sub  []*ForkDefinition `yaml:"sub,omitempty"`
+	// Context is the number of unchanged lines around the changes in the diffs of the files of the section,
+	// instead of Options.Context. The sub-sections inherit it, unless they set their own. 0 shows only the changes.
+	Context *int `yaml:"context,omitempty"`
+
+	Files        []FilePatchStats `yaml:"-"`
+	LinesAdded   int              `yaml:"-"`
+	LinesDeleted int              `yaml:"-"`
+	// ID is the HTML anchor of the section, derived from the titles of the section and its parents.
+	ID string `yaml:"-"`
+	// FileCount is the number of files in this definition, including all sub-definitions.
+	FileCount int `yaml:"-"`
+	Level     int `yaml:"-"`
+	// DirTrees are the trees of the files of the section that are claimed by Dirs, a tree per directory.
+	DirTrees []*DirTree `yaml:"-"`
+	// LooseFiles are the files of the section that are not in the DirTrees.
+	LooseFiles []*FilePatchStats `yaml:"-"`
+	// Auto is true for the sections that are generated for the unclaimed files of a directory, see Options.AutoSection.
+	Auto bool `yaml:"-"`
+
+	// commitSubject is true for the sections of the changes of a commit, that are titled by the commit subject.
+	// Unlike the titles of the page definition, the title is repository content, and escaped on the page.
+	commitSubject bool
+}
+
+// ShownDescription returns the description of the section, or its EmptyDescription if it has no changed files.
+func (fd *ForkDefinition) ShownDescription() string {
+	if fd.FileCount == 0 && fd.EmptyDescription != "" {
+		return fd.EmptyDescription
+	}
+	return fd.Description
+}
+
+// checkContext returns an error if the definition or any of its sub-definitions has a negative context.
+func (fd *ForkDefinition) checkContext() error {
+	if fd.Context != nil && *fd.Context < 0 {
+		return fmt.Errorf("invalid context %d of section %q", *fd.Context, fd.Title)
+	}
+	for _, sub := range fd.Sub {
+		if err := sub.checkContext(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DefaultMaxDepth is the default maximum nesting depth of fork definitions, the root definition being depth 1.
+const DefaultMaxDepth = 10
+
+// checkNesting returns an error if the definition is nested deeper than maxDepth, or if it contains itself.
+// The parents are the definitions along the path from the root to this definition.
+func (fd *ForkDefinition) checkNesting(maxDepth int, parents []*ForkDefinition) error {
+	for _, p := range parents {
+		if p == fd {
+			return fmt.Errorf("definition %q contains itself", fd.Title)
+		}
+	}
+	if len(parents) >= maxDepth {
+		return fmt.Errorf("definition %q is nested deeper than the maximum depth of %d", fd.Title, maxDepth)
+	}
+	parents = append(parents, fd)
+	for _, sub := range fd.Sub {
+		if err := sub.checkNesting(maxDepth, parents); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadDescriptionFiles reads the DescriptionFile of this definition, and those of all sub-definitions, into the Description.
+// The files are read with read, by their path relative to the fork page definition.
+func (fd *ForkDefinition) loadDescriptionFiles(read func(name string) ([]byte, error)) error {
+	if fd.DescriptionFile != "" {
+		if fd.Description != "" {
+			return fmt.Errorf("definition %q cannot have both a description and a description file", fd.Title)
+		}
+		data, err := read(fd.DescriptionFile)
+		if err != nil {
+			return fmt.Errorf("failed to read description file of definition %q: %w", fd.Title, err)
+		}
+		fd.Description = string(data)
+	}
+	for _, sub := range fd.Sub {
+		if err := sub.loadDescriptionFiles(read); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Assignment is the result of assigning file patches to the sections of a page.
+type Assignment struct {
+	// Patches are the file patches that are not ignored, by path.
+	Patches map[string]diff.FilePatch
+	// Ignored are the file patches that match an ignore glob of the page, by path.
+	Ignored map[string]diff.FilePatch
+	// Claims are the sections that claim the file patches, by path.
+	// A file only has multiple claims if that is allowed.
+	Claims map[string][]*ForkDefinition
+	// Remaining are the paths of the patches that are not claimed by any section.
+	Remaining map[string]struct{}
+}
+
+// AssignSections filters out the ignored file patches, and claims the file patches for the sections
+// of the page definition that match them. Neither the page definition nor the given patchByName map are modified,
+// so the same definition can be assigned multiple times; Analyze hydrates the sections with the claimed files.
+// If allowMultiple, a file may be listed in every section that matches it, otherwise that is an error.
+// Invalid globs and conflicting claims are ConfigError errors.
+func AssignSections(pageDefinition *Page, patchByName map[string]diff.FilePatch, allowMultiple bool) (*Assignment, error) {
+	if pageDefinition.Def == nil {
+		return nil, errors.New("no root fork definition defined")
+	}
+	out := &Assignment{
+		Patches: make(map[string]diff.FilePatch, len(patchByName)),
+		Ignored: make(map[string]diff.FilePatch),
+	}
+	for k, fp := range patchByName {
+		ignored, err := pageDefinition.isIgnored(k)
+		if err != nil {
+			return nil, &ConfigError{Err: err}
+		}
+		if ignored {
+			out.Ignored[k] = fp
+		} else {
+			out.Patches[k] = fp
+		}
+	}
+	var err error
+	out.Claims, out.Remaining, err = pageDefinition.Def.assignFiles(out.Patches, allowMultiple, pageDefinition.GlobCaseInsensitive)
+	if err != nil {
+		return nil, &ConfigError{Err: fmt.Errorf("failed to assign files to sections: %w", err)}
+	}
+	return out, nil
+}
+
+// isIgnored returns true if the path matches any of the ignore globs of the page definition.
+func (p *Page) isIgnored(name string) (bool, error) {
+	for _, globPattern := range p.Ignore {
+		ok, err := matchGlob(globPattern, name, p.GlobCaseInsensitive)
+		if err != nil {
+			return false, fmt.Errorf("failed to check %q against ignore glob pattern %q: %w", name, globPattern, err)
+		}
+		if ok {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// assignFiles claims the file patches for this definition and its sub-definitions, in the order of their paths,
+// so the result does not depend on the iteration order of patchByName. The definitions are not modified,
+// see hydrateClaims for their stats.
+// If allowMultiple, a file may be claimed by multiple sections, otherwise that is an error.
+// If foldCase, the globs match regardless of case.
+func (fd *ForkDefinition) assignFiles(patchByName map[string]diff.FilePatch, allowMultiple, foldCase bool) (claims map[string][]*ForkDefinition, remaining map[string]struct{}, err error) {
+	paths := sortedPatchNames(patchByName)
+	claims = make(map[string][]*ForkDefinition)
+	if err := fd.claimFiles(paths, claims, allowMultiple, foldCase); err != nil {
+		return nil, nil, err
+	}
+	remaining = make(map[string]struct{})
+	for _, k := range paths {
+		if _, ok := claims[k]; !ok {
+			remaining[k] = struct{}{}
+		}
+	}
+	return claims, remaining, nil
+}
+
+// claimFiles claims the paths that match the globs of this definition, after the sub-definitions claimed theirs.
+// A path that is matched by multiple globs of the same definition is claimed once.
+func (fd *ForkDefinition) claimFiles(paths []string, claims map[string][]*ForkDefinition, allowMultiple, foldCase bool) error {
+	for i, sub := range fd.Sub {
+		if err := sub.claimFiles(paths, claims, allowMultiple, foldCase); err != nil {
+			return fmt.Errorf("sub definition %d failed to claim files: %w", i, err)
+		}
+	}
+	for i, globPattern := range fd.Globs {
+		for _, name := range paths {
+			ok, err := matchGlob(globPattern, name, foldCase)
+			if err != nil {
+				return fmt.Errorf("failed to glob match entry %q against pattern %q: %w", name, globPattern, err)
+			}
+			if !ok || claimedBy(claims[name], fd) {
+				continue
+			}
+			if owners := claims[name]; len(owners) > 0 && !allowMultiple {
+				return fmt.Errorf("file %q was matched by glob %d (%q) but is already claimed by section %q", name, i, globPattern, owners[0].Title)
+			}
+			claims[name] = append(claims[name], fd)
+		}
+	}
+	for i, dir := range fd.Dirs {
+		prefix, err := dirPrefix(dir)
+		if err != nil {
+			return fmt.Errorf("invalid dir %d: %w", i, err)
+		}
+		for _, name := range paths {
+			if !matchDir(prefix, name, foldCase) || claimedBy(claims[name], fd) {
+				continue
+			}
+			if owners := claims[name]; len(owners) > 0 && !allowMultiple {
+				return fmt.Errorf("file %q was matched by dir %d (%q) but is already claimed by section %q", name, i, dir, owners[0].Title)
+			}
+			claims[name] = append(claims[name], fd)
+		}
+	}
+	return nil
+}
+
+// dirPrefix returns the path prefix of the files under the directory of a Dirs entry, with a trailing slash.
+func dirPrefix(dir string) (string, error) {
+	clean := strings.Trim(path.Clean(strings.TrimSpace(dir)), "/")
+	if clean == "" || clean == "." || strings.HasPrefix(clean, "../") || clean == ".." {
+		return "", fmt.Errorf("%q is not a directory of the repository", dir)
+	}
+	return clean + "/", nil
+}
+
+// matchDir returns true if the name is under the directory of the prefix. If foldCase, case is ignored.
+func matchDir(prefix, name string, foldCase bool) bool {
+	if foldCase {
+		prefix, name = strings.ToLower(prefix), strings.ToLower(name)
+	}
+	return strings.HasPrefix(name, prefix)
+}
+
+// matchGlob matches the name against the glob pattern, like filepath.Match. If foldCase, case is ignored.
+func matchGlob(pattern, name string, foldCase bool) (bool, error) {
+	if foldCase {
+		pattern, name = strings.ToLower(pattern), strings.ToLower(name)
+	}
+	return filepath.Match(pattern, name)
+}
+
+func claimedBy(owners []*ForkDefinition, fd *ForkDefinition) bool {
+	for _, owner := range owners {
+		if owner == fd {
+			return true
+		}
+	}
+	return false
+}
+
+// hydrateClaims sets the levels and file stats of this root definition and its sub-definitions,
+// from the claims of assignFiles.
+func (fd *ForkDefinition) hydrateClaims(patchByName map[string]diff.FilePatch, claims map[string][]*ForkDefinition) {
+	fd.hydrate(patchByName, sortedPatchNames(patchByName), claims, 1)
+}
+
+// hydrate sets the level and file stats of this definition and its sub-definitions, based on the claimed files.
+// It returns the stats of all files in the definition, including sub-definitions,
+// so files that are listed in multiple sections are only counted once in the totals.
+func (fd *ForkDefinition) hydrate(patchByName map[string]diff.FilePatch, paths []string, claims map[string][]*ForkDefinition, level int) map[string]FilePatchStats {
+	fd.Level = level
+	files := make(map[string]FilePatchStats)
+	for _, sub := range fd.Sub {
+		if sub.Context == nil {
+			sub.Context = fd.Context
+		}
+		for k, v := range sub.hydrate(patchByName, paths, claims, level+1) {
+			files[k] = v
+		}
+	}
+	for _, name := range paths {
+		if claimedBy(claims[name], fd) {
+			fd.hydratePatch(name, patchByName[name])
+			files[name] = fd.Files[len(fd.Files)-1]
+		}
+	}
+	fd.FileCount, fd.LinesAdded, fd.LinesDeleted = len(files), 0, 0
+	for _, f := range files {
+		fd.LinesAdded += f.LinesAdded
+		fd.LinesDeleted += f.LinesDeleted
+	}
+	return files
+}
+
+// assignIDs assigns each section an anchor ID based on its path of titles,
+// so links to it do not depend on the order of the sections.
+// Sections with the same path of titles are deduplicated with a counter suffix,
+// and so are the files that are listed in multiple sections.
+func (fd *ForkDefinition) assignIDs(parentPath string, used map[string]struct{}) {
+	sectionPath := parentPath + "/" + fd.Title
+	fd.ID = uniqueAnchorID("section", sectionPath, used)
+	for i := range fd.Files {
+		fd.Files[i].ID = uniqueAnchorID("file", fd.Files[i].Path, used)
+	}
+	for _, sub := range fd.Sub {
+		sub.assignIDs(sectionPath, used)
+	}
+}
+
+// prefixIDs prepends the prefix to the IDs of the definition, its files and its sub-definitions.
+func (fd *ForkDefinition) prefixIDs(prefix string) {
+	fd.ID = prefix + fd.ID
+	for i := range fd.Files {
+		fd.Files[i].ID = prefix + fd.Files[i].ID
+	}
+	for _, sub := range fd.Sub {
+		sub.prefixIDs(prefix)
+	}
+}
+
+// uniqueAnchorID returns the anchorID of the key, with a counter suffix if it is already used, and marks it as used.
+func uniqueAnchorID(prefix string, key string, used map[string]struct{}) string {
+	id := anchorID(prefix, key)
+	for i := 2; ; i++ {
+		if _, ok := used[id]; !ok {
+			break
+		}
+		id = fmt.Sprintf("%s-%d", anchorID(prefix, key), i)
+	}
+	used[id] = struct{}{}
+	return id
+}
+
+// anchorID returns a stable HTML ID, with the given prefix, for the given key.
+func anchorID(prefix string, key string) string {
+	h := sha256.Sum256([]byte(key))
+	return prefix + "-" + hex.EncodeToString(h[:6])
+}
+
+// sortFiles sorts the files of this definition, and those of all sub-definitions.
+func (fd *ForkDefinition) sortFiles(less func(a, b *FilePatchStats) bool) {
+	sort.SliceStable(fd.Files, func(i, j int) bool {
+		return less(&fd.Files[i], &fd.Files[j])
+	})
+	for _, sub := range fd.Sub {
+		sub.sortFiles(less)
+	}
+}
+
+func (fd *ForkDefinition) hydratePatch(name string, p diff.FilePatch) {
+	stat := FilePatchStats{
+		ID:           anchorID("file", name),
+		Path:         name,
+		LinesAdded:   countOperations(p.Chunks(), diff.Add),
+		LinesDeleted: countOperations(p.Chunks(), diff.Delete),
+		Binary:       p.IsBinary(),
+		Patch:        p,
+		context:      fd.Context,
+	}
+	stat.NewlineAtEOF, stat.BOM = contentTransitions(p)
+	switch op := p.(type) {
+	case *omittedFilePatch:
+		stat.TooLarge = true
+		stat.Size = op.size
+	case *symlinkFilePatch:
+		stat.Symlink = &SymlinkChange{From: op.fromTarget, To: op.toTarget}
+	case *lfsFilePatch:
+		stat.LFS = op.change
+	case *submoduleFilePatch:
+		stat.Submodule = &SubmoduleChange{}
+		if op.from != nil {
+			stat.Submodule.From = op.from.Hash().String()
+		}
+		if op.to != nil {
+			stat.Submodule.To = op.to.Hash().String()
+		}
+	}
+	fd.Files = append(fd.Files, stat)
+	fd.FileCount += 1
+	fd.LinesAdded += stat.LinesAdded
+	fd.LinesDeleted += stat.LinesDeleted
+}
+
+// autoSectionDir returns the directory of the generated section of an unclaimed file: the first depth directories
+// of its path, or all of them if it has fewer. It is empty for files outside of any directory, or if depth is 0.
+func autoSectionDir(name string, depth int) string {
+	if depth == 0 {
+		return ""
+	}
+	dir := path.Dir(name)
+	if dir == "." {
+		return ""
+	}
+	if parts := strings.Split(dir, "/"); len(parts) > depth {
+		dir = strings.Join(parts[:depth], "/")
+	}
+	return dir
+}
+
+// sortedKeys returns the keys of the set in sorted order.
+func sortedKeys(set map[string]struct{}) []string {
+	out := make([]string, 0, len(set))
+	for k := range set {
+		out = append(out, k)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// PrintDefinition writes a plain-text tree of the definition, with the files it claims, to w.
+func PrintDefinition(w io.Writer, fd *ForkDefinition, depth int) {
+	indent := strings.Repeat("  ", depth)
+	title := fd.Title
+	if title == "" {
+		title = "(untitled)"
+	}
+	_, _ = fmt.Fprintf(w, "%s%s: %d files (+%d -%d)\n", indent, title, fd.FileCount, fd.LinesAdded, fd.LinesDeleted)
+	for _, f := range fd.Files {
+		_, _ = fmt.Fprintf(w, "%s  - %s\n", indent, f.Path)
+	}
+	for _, sub := range fd.Sub {
+		PrintDefinition(w, sub, depth+1)
+	}
+}
+
+// markTop marks all the files of the page as Listed, except the top files with the most changed lines.
+// Ties are broken by path, so the selection is stable. The ignored files are never in the top.
+func (p *Page) markTop(patchByName map[string]diff.FilePatch, top int) {
+	type fileChanges struct {
+		path  string
+		lines int
+	}
+	files := make([]fileChanges, 0, len(patchByName))
+	for _, k := range sortedPatchNames(patchByName) {
+		chunks := patchByName[k].Chunks()
+		files = append(files, fileChanges{path: k, lines: countOperations(chunks, diff.Add) + countOperations(chunks, diff.Delete)})
+	}
+	sort.SliceStable(files, func(i, j int) bool {
+		return files[i].lines > files[j].lines
+	})
+	inTop := make(map[string]struct{}, top)
+	for i := 0; i < len(files) && i < top; i++ {
+		inTop[files[i].path] = struct{}{}
+	}
+	listed := make(map[string]struct{})
+	mark := func(fps *FilePatchStats) {
+		if _, ok := inTop[fps.Path]; !ok {
+			fps.Listed = true
+			listed[fps.Path] = struct{}{}
+		}
+	}
+	p.Def.collectFiles(mark)
+	if p.Ignored != nil {
+		p.Ignored.collectFiles(mark)
+	}
+	p.ListedFiles = len(listed)
+}
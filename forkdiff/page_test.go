@@ -0,0 +1,308 @@
+package forkdiff
+
+import (
+	"bytes"
+	"errors"
+	"github.com/go-git/go-git/v5/plumbing/format/diff"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// syntheticPatches returns file patches without content, of files that exist in the base and fork, by path.
+func syntheticPatches(paths ...string) map[string]diff.FilePatch {
+	out := make(map[string]diff.FilePatch, len(paths))
+	for _, p := range paths {
+		out[p] = &omittedFilePatch{from: &entryFile{name: p}, to: &entryFile{name: p}}
+	}
+	return out
+}
+
+// claimTitles returns the titles of the sections that claim each path.
+func claimTitles(claims map[string][]*ForkDefinition) map[string][]string {
+	out := make(map[string][]string, len(claims))
+	for k, owners := range claims {
+		for _, fd := range owners {
+			out[k] = append(out[k], fd.Title)
+		}
+	}
+	return out
+}
+
+func testAssignPage() *Page {
+	return &Page{
+		Ignore: []string{"*.lock"},
+		Def: &ForkDefinition{
+			Title: "root",
+			Globs: []string{"util.go"},
+			Sub: []*ForkDefinition{
+				{Title: "cmd", Globs: []string{"cmd/*", "main.go"}},
+				{Title: "vendor", Dirs: []string{"vendor"}},
+			},
+		},
+	}
+}
+
+func TestAssignSections(t *testing.T) {
+	page := testAssignPage()
+	patches := syntheticPatches("main.go", "util.go", "cmd/run.go", "vendor/a/b.go", "go.lock", "README.md")
+	out, err := AssignSections(page, patches, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string][]string{
+		"main.go":       {"cmd"},
+		"cmd/run.go":    {"cmd"},
+		"vendor/a/b.go": {"vendor"},
+		"util.go":       {"root"},
+	}
+	if got := claimTitles(out.Claims); !reflect.DeepEqual(got, want) {
+		t.Errorf("claims: got %v, want %v", got, want)
+	}
+	if got := sortedPatchNames(out.Ignored); !reflect.DeepEqual(got, []string{"go.lock"}) {
+		t.Errorf("ignored: got %v", got)
+	}
+	if got := sortedKeys(out.Remaining); !reflect.DeepEqual(got, []string{"README.md"}) {
+		t.Errorf("remaining: got %v", got)
+	}
+	if len(out.Patches) != 5 || len(patches) != 6 {
+		t.Errorf("got %d patches that are not ignored of %d, want 5 of 6", len(out.Patches), len(patches))
+	}
+}
+
+func TestAssignSectionsDoesNotModifyDefinition(t *testing.T) {
+	page := testAssignPage()
+	patches := syntheticPatches("main.go", "util.go", "vendor/b.go")
+	first, err := AssignSections(page, patches, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(page, testAssignPage()) {
+		t.Fatal("the page definition was modified")
+	}
+	second, err := AssignSections(page, patches, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(claimTitles(first.Claims), claimTitles(second.Claims)) {
+		t.Errorf("assigning twice differs: %v and %v", claimTitles(first.Claims), claimTitles(second.Claims))
+	}
+}
+
+func TestAssignSectionsMultiple(t *testing.T) {
+	page := &Page{Def: &ForkDefinition{
+		Title: "root",
+		Sub: []*ForkDefinition{
+			{Title: "a", Globs: []string{"*.go"}},
+			{Title: "b", Globs: []string{"main.*"}},
+		},
+	}}
+	patches := syntheticPatches("main.go")
+	_, err := AssignSections(page, patches, false)
+	var configErr *ConfigError
+	if !errors.As(err, &configErr) {
+		t.Fatalf("got %v, want a conflicting claims ConfigError", err)
+	}
+	out, err := AssignSections(page, patches, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := claimTitles(out.Claims)["main.go"]
+	sort.Strings(got)
+	if !reflect.DeepEqual(got, []string{"a", "b"}) {
+		t.Errorf("got claims %v, want both sections", got)
+	}
+}
+
+func TestHydrateClaims(t *testing.T) {
+	page := testAssignPage()
+	patches := syntheticPatches("main.go", "util.go", "vendor/b.go")
+	out, err := AssignSections(page, patches, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	page.Def.hydrateClaims(out.Patches, out.Claims)
+	if page.Def.FileCount != 3 || len(page.Def.Files) != 1 || page.Def.Files[0].Path != "util.go" {
+		t.Errorf("root: got %d files, listing %v", page.Def.FileCount, page.Def.Files)
+	}
+	if cmd := page.Def.Sub[0]; cmd.Level != 2 || len(cmd.Files) != 1 || cmd.Files[0].Path != "main.go" {
+		t.Errorf("cmd: got level %d, files %v", cmd.Level, cmd.Files)
+	}
+}
+
+func TestAnchorsStableWhenReordered(t *testing.T) {
+	repo, _, _ := testTrees(t,
+		testFiles(map[string]string{"a/x.go": "a\n", "b/y.go": "b\n", "main.go": "m\n"}),
+		testFiles(map[string]string{"a/x.go": "a2\n", "b/y.go": "b2\n", "main.go": "m2\n"}))
+	const header = `
+title: test fork
+base:
+  name: base
+  ref: refs/heads/base
+fork:
+  name: fork
+  ref: refs/heads/fork
+def:
+  title: root
+  sub:
+`
+	const sectionA = `
+    - title: A
+      sub:
+        - title: Nested
+          globs: ["a/*"]
+`
+	const sectionB = `
+    - title: B
+      globs: ["b/*"]
+`
+	anchors := func(source string) map[string]string {
+		t.Helper()
+		page, err := decodePage([]byte(source))
+		if err != nil {
+			t.Fatal(err)
+		}
+		res, err := Analyze(&Options{Repo: repo, Page: page})
+		if err != nil {
+			t.Fatal(err)
+		}
+		out := make(map[string]string)
+		var walk func(fd *ForkDefinition)
+		walk = func(fd *ForkDefinition) {
+			out["section "+fd.Title] = fd.ID
+			for _, f := range fd.Files {
+				out["file "+f.Path] = f.ID
+			}
+			for _, sub := range fd.Sub {
+				walk(sub)
+			}
+		}
+		walk(res.Page.Def)
+		return out
+	}
+	first := anchors(header + sectionA + sectionB)
+	second := anchors(header + sectionB + sectionA)
+	if !reflect.DeepEqual(first, second) {
+		t.Errorf("the anchors changed when reordering the sections:\n%v\n%v", first, second)
+	}
+	if len(first) != 8 {
+		t.Errorf("got %d anchors, want those of 5 sections and 3 files: %v", len(first), first)
+	}
+}
+
+func TestDeletedFilesClaimed(t *testing.T) {
+	repo, _, _ := testTrees(t,
+		testFiles(map[string]string{"old/a.go": "a\n", "old/b.go": "b\n", "old/sub/c.go": "c\nc\n", "main.go": "m\n"}),
+		testFiles(map[string]string{"main.go": "m2\n"}))
+	def := &ForkDefinition{
+		Title: "root",
+		Globs: []string{"main.go"},
+		Sub:   []*ForkDefinition{{Title: "old", Dirs: []string{"old"}}},
+	}
+	res := analyzeTest(t, repo, def, Options{Format: "text"})
+	if len(res.Unclaimed()) != 0 {
+		t.Errorf("got unclaimed files %v", res.Unclaimed())
+	}
+	old := def.Sub[0]
+	var paths []string
+	for _, f := range old.Files {
+		paths = append(paths, f.Path)
+		if kind := changeKind(f.Patch); kind != "delete" {
+			t.Errorf("%s: got change %q, want delete", f.Path, kind)
+		}
+	}
+	if want := []string{"old/a.go", "old/b.go", "old/sub/c.go"}; !reflect.DeepEqual(paths, want) {
+		t.Fatalf("got files %v in the section, want %v", paths, want)
+	}
+	if old.LinesDeleted != 4 || old.LinesAdded != 0 {
+		t.Errorf("got +%d -%d, want +0 -4", old.LinesAdded, old.LinesDeleted)
+	}
+	var buf bytes.Buffer
+	if err := res.Render(&buf, res.Page); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{"old/a.go (+0 -1) (removed in fork)", "old/b.go (+0 -1) (removed in fork)", "old/sub/c.go (+0 -2) (removed in fork)"} {
+		if !strings.Contains(buf.String(), line) {
+			t.Errorf("the text report does not contain %q", line)
+		}
+	}
+	if strings.Contains(buf.String(), "main.go (+1 -1) (removed in fork)") {
+		t.Error("the modified file is marked as removed")
+	}
+	res.Options.Format = "html"
+	buf.Reset()
+	if err := res.Render(&buf, res.Page); err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(buf.String(), `<code class="text-danger text-decoration-line-through">old/`); n != 3 {
+		t.Errorf("got %d struck through paths on the page, want 3", n)
+	}
+}
+
+func TestMatchGlobCase(t *testing.T) {
+	tests := []struct {
+		pattern, name    string
+		match, foldMatch bool
+	}{
+		{"src/*.go", "src/Main.go", true, true},
+		{"src/*.go", "SRC/Main.GO", false, true},
+		{"Docs/*.MD", "docs/readme.md", false, true},
+		{"Makefile", "makefile", false, true},
+		{"[A-C]*.txt", "b.txt", false, true},
+		{"lib/*", "Lib/sub/File.go", false, false},
+		{"*.go", "main.rs", false, false},
+	}
+	for _, tt := range tests {
+		for _, foldCase := range []bool{false, true} {
+			want := tt.match
+			if foldCase {
+				want = tt.foldMatch
+			}
+			got, err := matchGlob(tt.pattern, tt.name, foldCase)
+			if err != nil {
+				t.Fatalf("%q: %v", tt.pattern, err)
+			}
+			if got != want {
+				t.Errorf("matchGlob(%q, %q, %v) = %v, want %v", tt.pattern, tt.name, foldCase, got, want)
+			}
+		}
+	}
+}
+
+func TestAssignSectionsGlobCaseInsensitive(t *testing.T) {
+	page := &Page{
+		GlobCaseInsensitive: true,
+		Ignore:              []string{"*.LOCK"},
+		Def: &ForkDefinition{
+			Title: "root",
+			Sub: []*ForkDefinition{
+				{Title: "docs", Globs: []string{"docs/*.md"}},
+				{Title: "vendor", Dirs: []string{"Vendor"}},
+			},
+		},
+	}
+	patches := syntheticPatches("Docs/README.md", "vendor/Lib/a.go", "Cargo.lock", "Main.go")
+	out, err := AssignSections(page, patches, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string][]string{"Docs/README.md": {"docs"}, "vendor/Lib/a.go": {"vendor"}}
+	if got := claimTitles(out.Claims); !reflect.DeepEqual(got, want) {
+		t.Errorf("claims: got %v, want %v", got, want)
+	}
+	if got := sortedPatchNames(out.Ignored); !reflect.DeepEqual(got, []string{"Cargo.lock"}) {
+		t.Errorf("ignored: got %v", got)
+	}
+	if got := sortedKeys(out.Remaining); !reflect.DeepEqual(got, []string{"Main.go"}) {
+		t.Errorf("remaining: got %v", got)
+	}
+	page.GlobCaseInsensitive = false
+	out, err = AssignSections(page, patches, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out.Claims) != 0 || len(out.Ignored) != 0 {
+		t.Errorf("matched %v and ignored %v regardless of case", claimTitles(out.Claims), sortedPatchNames(out.Ignored))
+	}
+}
@@ -0,0 +1,147 @@
+package forkdiff
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+)
+
+// pageFetchTimeout is the maximum duration of a single request of a PageReader.
+const pageFetchTimeout = time.Minute
+
+// maxPageFetchSize is the maximum size of a fork page definition or description file that is fetched over HTTP.
+const maxPageFetchSize = 16 << 20
+
+// IsPageURL returns true if the path of a fork page definition is an http(s) URL instead of a file path.
+func IsPageURL(p string) bool {
+	return strings.HasPrefix(p, "http://") || strings.HasPrefix(p, "https://")
+}
+
+// PageReader reads fork page definitions from files, like ReadPage, or from http(s) URLs,
+// like from a central configuration service. The description files and favicon of a definition from a URL
+// are fetched relative to that URL. Every URL is fetched once, and cached for later reads with the same reader,
+// like the definition of every -target.
+type PageReader struct {
+	// Header is sent with every request, like the Authorization header of a protected endpoint.
+	Header http.Header
+	// Client sends the requests, a client with a timeout of a minute if nil.
+	Client *http.Client
+
+	cache map[string][]byte
+}
+
+// ReadPage reads a fork page definition from a file or URL. Errors are ConfigError errors.
+func (pr *PageReader) ReadPage(p string) (*Page, error) {
+	if !IsPageURL(p) {
+		return ReadPage(p)
+	}
+	page, err := pr.readPageURL(p)
+	if err != nil {
+		return nil, &ConfigError{Err: err}
+	}
+	return page, nil
+}
+
+func (pr *PageReader) readPageURL(rawURL string) (*Page, error) {
+	base, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid page URL: %w", err)
+	}
+	source, err := pr.fetch(base)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch page YAML: %w", err)
+	}
+	page, err := decodePage(source)
+	if err != nil {
+		return nil, err
+	}
+	read := func(name string) ([]byte, error) {
+		u, err := resolveDefinitionURL(base, name)
+		if err != nil {
+			return nil, err
+		}
+		return pr.fetch(u)
+	}
+	if err := page.Def.loadDescriptionFiles(read); err != nil {
+		return nil, fmt.Errorf("failed to load description files: %w", err)
+	}
+	if err := page.loadFavicon(read); err != nil {
+		return nil, err
+	}
+	return page, nil
+}
+
+// resolveDefinitionURL resolves the URL of an auxiliary file that is referenced by a fork page definition from a URL,
+// like resolveDefinitionPath: it must be relative, and may not escape the directory of the definition.
+func resolveDefinitionURL(base *url.URL, p string) (*url.URL, error) {
+	ref, err := url.Parse(p)
+	if err != nil {
+		return nil, fmt.Errorf("invalid path %q: %w", p, err)
+	}
+	if ref.IsAbs() || ref.Host != "" || path.IsAbs(ref.Path) {
+		return nil, fmt.Errorf("path %q must be relative to the fork page definition", p)
+	}
+	u := base.ResolveReference(ref)
+	dir := path.Dir(base.Path)
+	if !strings.HasPrefix(u.Path, strings.TrimSuffix(dir, "/")+"/") {
+		return nil, fmt.Errorf("path %q escapes the directory of the fork page definition", p)
+	}
+	return u, nil
+}
+
+// fetch returns the body of a GET request of the URL, from the cache if it was fetched before.
+func (pr *PageReader) fetch(u *url.URL) ([]byte, error) {
+	key := u.String()
+	if data, ok := pr.cache[key]; ok {
+		return data, nil
+	}
+	client := pr.Client
+	if client == nil {
+		client = &http.Client{Timeout: pageFetchTimeout}
+	}
+	req, err := http.NewRequest(http.MethodGet, key, nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range pr.Header {
+		req.Header[k] = v
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		// the error of the client contains the full URL
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return nil, fmt.Errorf("GET %s: %w", redactURL(u), err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: %s", redactURL(u), resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxPageFetchSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response of %s: %w", redactURL(u), err)
+	}
+	if len(data) > maxPageFetchSize {
+		return nil, fmt.Errorf("response of %s is larger than %d bytes", redactURL(u), maxPageFetchSize)
+	}
+	if pr.cache == nil {
+		pr.cache = make(map[string][]byte)
+	}
+	pr.cache[key] = data
+	return data, nil
+}
+
+// redactURL returns the URL without its user info and query, which may hold credentials, for error messages.
+func redactURL(u *url.URL) string {
+	out := *u
+	out.User = nil
+	out.RawQuery = ""
+	return out.String()
+}
@@ -0,0 +1,79 @@
+package forkdiff
+
+import (
+	"fmt"
+	"github.com/go-git/go-git/v5/plumbing/color"
+	"github.com/go-git/go-git/v5/plumbing/format/diff"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// diffColorRole is a kind of diff line of which Options.DiffColors can pin the color: the go-git color key and
+// the ANSI color it is encoded with, and the classes of the line in the HTML, rendered by terminal-to-html
+// from that ANSI color, or by renderPlainDiff with NoColor.
+type diffColorRole struct {
+	key        diff.ColorKey
+	ansi       string
+	termClass  string
+	plainClass string
+}
+
+// diffColorRoles are the roles of Options.DiffColors, by name.
+var diffColorRoles = map[string]diffColorRole{
+	"add":    {key: diff.New, ansi: color.Green, termClass: "term-fg32", plainClass: "diff-add"},
+	"delete": {key: diff.Old, ansi: color.Red, termClass: "term-fg31", plainClass: "diff-delete"},
+	"hunk":   {key: diff.Frag, ansi: color.Cyan, termClass: "term-fg36", plainClass: "diff-hunk"},
+	"meta":   {key: diff.Meta, ansi: color.Bold, termClass: "term-fg1", plainClass: "diff-meta"},
+}
+
+// diffColorConfig returns the colors that the diffs are encoded with. The colors of the diffColorRoles are set
+// explicitly, so the classes that terminal-to-html renders them as are those that the DiffColors CSS styles.
+func diffColorConfig() diff.ColorConfig {
+	var options []diff.ColorConfigOption
+	for _, role := range diffColorRoles {
+		options = append(options, diff.WithColor(role.key, role.ansi))
+	}
+	return diff.NewColorConfig(options...)
+}
+
+// cssColorRegexp matches the colors that Options.DiffColors accepts: hex colors like "#7ee787", and color names.
+var cssColorRegexp = regexp.MustCompile(`^(#[0-9a-fA-F]{3,8}|[a-zA-Z]+)$`)
+
+// checkDiffColors returns an error if any of the DiffColors has an unknown role or an invalid color.
+func (opts *Options) checkDiffColors() error {
+	for name, c := range opts.DiffColors {
+		if _, ok := diffColorRoles[name]; !ok {
+			return fmt.Errorf("unknown diff color role %q, must be one of %s", name, strings.Join(diffColorRoleNames(), ", "))
+		}
+		if !cssColorRegexp.MatchString(c) {
+			return fmt.Errorf("invalid %s diff color %q, must be a hex color like #7ee787 or a color name", name, c)
+		}
+	}
+	return nil
+}
+
+func diffColorRoleNames() []string {
+	names := make([]string, 0, len(diffColorRoles))
+	for name := range diffColorRoles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// diffColorsCSS returns the CSS rules that pin the DiffColors, after the default palette of the page,
+// for both the ANSI classes of the colored diffs and the classes of the plain diffs.
+func (opts *Options) diffColorsCSS() string {
+	var rules []string
+	for _, name := range diffColorRoleNames() {
+		c, ok := opts.DiffColors[name]
+		if !ok {
+			continue
+		}
+		role := diffColorRoles[name]
+		rules = append(rules, fmt.Sprintf(".term-container .%s, .term-container .%s { color: %s; }", role.termClass, role.plainClass, c))
+	}
+	// indented like the rules of the page template
+	return strings.Join(rules, "\n        ")
+}
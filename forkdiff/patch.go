@@ -0,0 +1,369 @@
+package forkdiff
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/format/diff"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"path"
+	"sort"
+	"strings"
+)
+
+// Patches are the file patches between a base and fork tree.
+type Patches struct {
+	// ByName are the file patches by path. The fork path is used for renames.
+	ByName map[string]diff.FilePatch
+	// BaseFiles are the changed paths that exist in the base.
+	BaseFiles map[string]struct{}
+	// ForkFiles are the changed paths that exist in the fork.
+	ForkFiles map[string]struct{}
+}
+
+// DefaultRenameThreshold is the default similarity, in percent, of a deleted and an added file to pair them as a rename.
+const DefaultRenameThreshold = 60
+
+// ComputePatches computes the file patches of all changes between the base and fork tree.
+// A deleted and an added file are paired as a rename if they are at least renameThreshold percent similar,
+// 0 uses the DefaultRenameThreshold. See changePatch for the handling of submodules, symlinks and maxFileSize.
+func ComputePatches(ctx context.Context, baseTree, forkTree *object.Tree, maxFileSize int64, renameThreshold int) (*Patches, error) {
+	diffOpts := *object.DefaultDiffTreeOptions
+	if renameThreshold > 0 {
+		diffOpts.RenameScore = uint(renameThreshold)
+	}
+	// identical files are paired by hash, without comparing the contents
+	diffOpts.OnlyExactRenames = diffOpts.RenameScore >= 100
+	changes, err := object.DiffTreeWithOptions(ctx, baseTree, forkTree, &diffOpts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute changes between base and fork: %w", err)
+	}
+	out := &Patches{
+		ByName:    make(map[string]diff.FilePatch, len(changes)),
+		BaseFiles: make(map[string]struct{}),
+		ForkFiles: make(map[string]struct{}),
+	}
+	for _, ch := range changes {
+		fp, err := changePatch(ctx, ch, maxFileSize)
+		if err != nil {
+			return nil, fmt.Errorf("failed to compute patch of %s: %w", ch, err)
+		}
+		from, to := fp.Files()
+		if to != nil {
+			out.ByName[to.Path()] = fp
+		} else {
+			out.ByName[from.Path()] = fp
+		}
+		if to != nil {
+			out.ForkFiles[to.Path()] = struct{}{}
+		}
+		if from != nil {
+			out.BaseFiles[from.Path()] = struct{}{}
+		}
+	}
+	return out, nil
+}
+
+// sortedPatchNames returns the paths of the file patches in sorted order.
+func sortedPatchNames(patchByName map[string]diff.FilePatch) []string {
+	out := make([]string, 0, len(patchByName))
+	for k := range patchByName {
+		out = append(out, k)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// filterExtensions returns the file patches of the paths with one of the given extensions.
+func filterExtensions(patchByName map[string]diff.FilePatch, extensions []string) map[string]diff.FilePatch {
+	allowed := make(map[string]struct{}, len(extensions))
+	for _, ext := range extensions {
+		allowed["."+strings.TrimPrefix(ext, ".")] = struct{}{}
+	}
+	out := make(map[string]diff.FilePatch, len(patchByName))
+	for k, fp := range patchByName {
+		if _, ok := allowed[path.Ext(k)]; ok {
+			out[k] = fp
+		}
+	}
+	return out
+}
+
+// changeKind returns "add", "modify" or "delete", based on the sides of the file patch.
+// Renames are modifications.
+func changeKind(p diff.FilePatch) string {
+	from, to := p.Files()
+	switch {
+	case from == nil:
+		return "add"
+	case to == nil:
+		return "delete"
+	default:
+		return "modify"
+	}
+}
+
+// fileStatus returns the status of a file for display, like in the file tree, for the changeKind.
+func fileStatus(kind string) string {
+	switch kind {
+	case "add":
+		return "added"
+	case "delete":
+		return "removed"
+	default:
+		return "modified"
+	}
+}
+
+// filterChangeKinds returns the file patches with one of the given change kinds, see changeKind.
+func filterChangeKinds(patchByName map[string]diff.FilePatch, kinds []string) (map[string]diff.FilePatch, error) {
+	allowed := make(map[string]struct{}, len(kinds))
+	for _, k := range kinds {
+		switch k {
+		case "add", "modify", "delete":
+			allowed[k] = struct{}{}
+		default:
+			return nil, fmt.Errorf("unknown change kind %q", k)
+		}
+	}
+	out := make(map[string]diff.FilePatch, len(patchByName))
+	for k, fp := range patchByName {
+		if _, ok := allowed[changeKind(fp)]; ok {
+			out[k] = fp
+		}
+	}
+	return out, nil
+}
+
+const utf8BOM = "\xef\xbb\xbf"
+
+// contentTransitions detects if a modified file gained ("added") or lost ("removed")
+// the newline at the end of the file, and the UTF-8 byte order mark at the start.
+// These are easy to miss in a unified diff. Empty and binary files are not considered.
+func contentTransitions(p diff.FilePatch) (newline string, bom string) {
+	if from, to := p.Files(); from == nil || to == nil || p.IsBinary() {
+		return "", ""
+	}
+	var base, fork strings.Builder
+	for _, ch := range p.Chunks() {
+		switch ch.Type() {
+		case diff.Equal:
+			base.WriteString(ch.Content())
+			fork.WriteString(ch.Content())
+		case diff.Delete:
+			base.WriteString(ch.Content())
+		case diff.Add:
+			fork.WriteString(ch.Content())
+		}
+	}
+	a, b := base.String(), fork.String()
+	if a == "" || b == "" {
+		return "", ""
+	}
+	transition := func(before, after bool) string {
+		switch {
+		case after && !before:
+			return "added"
+		case before && !after:
+			return "removed"
+		}
+		return ""
+	}
+	newline = transition(strings.HasSuffix(a, "\n"), strings.HasSuffix(b, "\n"))
+	bom = transition(strings.HasPrefix(a, utf8BOM), strings.HasPrefix(b, utf8BOM))
+	return newline, bom
+}
+
+// changePatch computes the file patch of a single change.
+// Submodule changes are not diffed, and return a submoduleFilePatch.
+// Symlink changes are not diffed either, and return a symlinkFilePatch with the link targets.
+// Changes of git LFS pointer files return an lfsFilePatch with the objects, instead of the diff of the pointers.
+// If maxFileSize is non-zero, and either side of the change is larger,
+// then the diff computation is skipped and an omittedFilePatch is returned instead.
+func changePatch(ctx context.Context, ch *object.Change, maxFileSize int64) (diff.FilePatch, error) {
+	if ch.From.TreeEntry.Mode == filemode.Submodule || ch.To.TreeEntry.Mode == filemode.Submodule {
+		return &submoduleFilePatch{omittedFilePatch{
+			from: changeEntryFile(ch.From),
+			to:   changeEntryFile(ch.To),
+		}}, nil
+	}
+	if isSymlinkChange(ch) {
+		fromTarget, err := symlinkTarget(&ch.From)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read base symlink: %w", err)
+		}
+		toTarget, err := symlinkTarget(&ch.To)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read fork symlink: %w", err)
+		}
+		return &symlinkFilePatch{
+			omittedFilePatch: omittedFilePatch{
+				from: changeEntryFile(ch.From),
+				to:   changeEntryFile(ch.To),
+			},
+			fromTarget: fromTarget,
+			toTarget:   toTarget,
+		}, nil
+	}
+	lfs, err := lfsChange(ch)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read LFS pointer: %w", err)
+	}
+	if lfs != nil {
+		return &lfsFilePatch{
+			omittedFilePatch: omittedFilePatch{
+				from: changeEntryFile(ch.From),
+				to:   changeEntryFile(ch.To),
+			},
+			change: lfs,
+		}, nil
+	}
+	if maxFileSize > 0 {
+		fromSize, err := changeEntrySize(&ch.From)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get base file size: %w", err)
+		}
+		toSize, err := changeEntrySize(&ch.To)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get fork file size: %w", err)
+		}
+		if fromSize > maxFileSize || toSize > maxFileSize {
+			size := fromSize
+			if toSize > size {
+				size = toSize
+			}
+			return &omittedFilePatch{
+				from: changeEntryFile(ch.From),
+				to:   changeEntryFile(ch.To),
+				size: size,
+			}, nil
+		}
+	}
+	p, err := ch.PatchContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return p.FilePatches()[0], nil
+}
+
+// isSymlinkChange returns true if the change adds, removes or modifies a symlink.
+// Changes between a symlink and another type of file are not considered as symlink change.
+func isSymlinkChange(ch *object.Change) bool {
+	fromLink := ch.From.Tree == nil || ch.From.TreeEntry.Mode == filemode.Symlink
+	toLink := ch.To.Tree == nil || ch.To.TreeEntry.Mode == filemode.Symlink
+	return fromLink && toLink
+}
+
+// symlinkTarget returns the target of the symlink change entry, or an empty string if there is no such entry.
+func symlinkTarget(ce *object.ChangeEntry) (string, error) {
+	if ce.Tree == nil {
+		return "", nil
+	}
+	f, err := ce.Tree.TreeEntryFile(&ce.TreeEntry)
+	if err != nil {
+		return "", err
+	}
+	return f.Contents()
+}
+
+// changeEntrySize returns the blob size of the change entry, or 0 if there is no such blob.
+func changeEntrySize(ce *object.ChangeEntry) (int64, error) {
+	if ce.Tree == nil || !ce.TreeEntry.Mode.IsFile() {
+		return 0, nil
+	}
+	f, err := ce.Tree.TreeEntryFile(&ce.TreeEntry)
+	if err != nil {
+		return 0, err
+	}
+	return f.Size, nil
+}
+
+// countOperations counts the lines of the chunks of the operation, like git. The last line of a file
+// without newline at the end, the end of a chunk that does not end with a newline, is a line too.
+func countOperations(chunks []diff.Chunk, op diff.Operation) (out int) {
+	for _, ch := range chunks {
+		if ch.Type() != op {
+			continue
+		}
+		content := ch.Content()
+		out += strings.Count(content, "\n")
+		if content != "" && !strings.HasSuffix(content, "\n") {
+			out++
+		}
+	}
+	return
+}
+
+type FilePatch struct {
+	filePatch diff.FilePatch
+}
+
+var _ diff.Patch = FilePatch{}
+
+func (p FilePatch) FilePatches() []diff.FilePatch {
+	return []diff.FilePatch{p.filePatch}
+}
+
+func (p FilePatch) Message() string {
+	return ""
+}
+
+// omittedFilePatch is a file patch without chunks, for files that are too large to diff.
+type omittedFilePatch struct {
+	from, to diff.File
+	size     int64
+}
+
+var _ diff.FilePatch = (*omittedFilePatch)(nil)
+
+func (p *omittedFilePatch) IsBinary() bool {
+	return false
+}
+
+func (p *omittedFilePatch) Files() (from, to diff.File) {
+	return p.from, p.to
+}
+
+func (p *omittedFilePatch) Chunks() []diff.Chunk {
+	return nil
+}
+
+// submoduleFilePatch is a file patch of a change to a submodule (gitlink) commit pointer.
+type submoduleFilePatch struct {
+	omittedFilePatch
+}
+
+// symlinkFilePatch is a file patch of a change to a symlink target.
+type symlinkFilePatch struct {
+	omittedFilePatch
+	fromTarget, toTarget string
+}
+
+// entryFile is a diff.File based on a git tree entry.
+type entryFile struct {
+	name  string
+	entry object.TreeEntry
+}
+
+var _ diff.File = (*entryFile)(nil)
+
+func (f *entryFile) Hash() plumbing.Hash {
+	return f.entry.Hash
+}
+
+func (f *entryFile) Mode() filemode.FileMode {
+	return f.entry.Mode
+}
+
+func (f *entryFile) Path() string {
+	return f.name
+}
+
+// changeEntryFile turns a change entry into a diff.File, or nil if the entry is empty.
+func changeEntryFile(ce object.ChangeEntry) diff.File {
+	if ce.Tree == nil {
+		return nil
+	}
+	return &entryFile{name: ce.Name, entry: ce.TreeEntry}
+}
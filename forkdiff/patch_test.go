@@ -0,0 +1,186 @@
+package forkdiff
+
+import (
+	"bytes"
+	"context"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"strings"
+	"testing"
+)
+
+func TestContentTransitions(t *testing.T) {
+	tests := []struct {
+		name, base, fork string
+		newline, bom     string
+	}{
+		{"gained newline", "a\nb", "a\nb\n", "added", ""},
+		{"lost newline", "a\nb\n", "a\nc", "removed", ""},
+		{"kept newline", "a\n", "b\n", "", ""},
+		{"kept no newline", "a", "b", "", ""},
+		{"added BOM", "a\n", utf8BOM + "a\n", "", "added"},
+		{"removed BOM", utf8BOM + "a\n", "a\n", "", "removed"},
+		{"kept BOM", utf8BOM + "a\n", utf8BOM + "b\n", "", ""},
+		{"added BOM and newline", "a", utf8BOM + "a\n", "added", "added"},
+		{"emptied", "a\n", "", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, baseTree, forkTree := testTrees(t,
+				testFiles(map[string]string{"f.txt": tt.base}),
+				testFiles(map[string]string{"f.txt": tt.fork}))
+			patches, err := ComputePatches(context.Background(), baseTree, forkTree, 0, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			p, ok := patches.ByName["f.txt"]
+			if !ok {
+				t.Fatal("no patch of the file")
+			}
+			newline, bom := contentTransitions(p)
+			if newline != tt.newline || bom != tt.bom {
+				t.Errorf("got newline %q and BOM %q, want %q and %q", newline, bom, tt.newline, tt.bom)
+			}
+		})
+	}
+}
+
+func TestContentTransitionsNewFile(t *testing.T) {
+	_, baseTree, forkTree := testTrees(t,
+		testFiles(map[string]string{"old.txt": "a"}),
+		testFiles(map[string]string{"old.txt": "a", "new.txt": utf8BOM + "a\n"}))
+	patches, err := ComputePatches(context.Background(), baseTree, forkTree, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if newline, bom := contentTransitions(patches.ByName["new.txt"]); newline != "" || bom != "" {
+		t.Errorf("got newline %q and BOM %q for a new file, want none", newline, bom)
+	}
+}
+
+func TestSubmodulePointer(t *testing.T) {
+	from := plumbing.NewHash("1111111111111111111111111111111111111111")
+	to := plumbing.NewHash("2222222222222222222222222222222222222222")
+	repo, _, _ := testTrees(t,
+		[]testFile{{path: "lib/dep", mode: filemode.Submodule, hash: from}, {path: "main.go", content: "a\n"}},
+		[]testFile{{path: "lib/dep", mode: filemode.Submodule, hash: to}, {path: "main.go", content: "a\n"}})
+	def := &ForkDefinition{Title: "root", Globs: []string{"lib/*"}}
+	res := analyzeTest(t, repo, def, Options{Format: "text"})
+	if len(def.Files) != 1 {
+		t.Fatalf("got files %v, want only the submodule", def.Files)
+	}
+	fps := def.Files[0]
+	if _, ok := fps.Patch.(*submoduleFilePatch); !ok {
+		t.Errorf("got a %T patch, want a submodule patch", fps.Patch)
+	}
+	if fps.Submodule == nil || fps.Submodule.From != from.String() || fps.Submodule.To != to.String() {
+		t.Fatalf("got submodule change %+v", fps.Submodule)
+	}
+	if fps.LinesAdded != 0 || fps.LinesDeleted != 0 || def.FileCount != 1 {
+		t.Errorf("got +%d -%d in %d files, want a single file without lines", fps.LinesAdded, fps.LinesDeleted, def.FileCount)
+	}
+	var buf bytes.Buffer
+	if err := res.Render(&buf, res.Page); err != nil {
+		t.Fatal(err)
+	}
+	if want := "lib/dep (submodule " + from.String() + " -> " + to.String() + ")"; !strings.Contains(buf.String(), want) {
+		t.Errorf("the text report does not contain %q:\n%s", want, buf.String())
+	}
+}
+
+func TestSubmoduleCommitLink(t *testing.T) {
+	from := plumbing.NewHash("1111111111111111111111111111111111111111")
+	to := plumbing.NewHash("2222222222222222222222222222222222222222")
+	repo, _, _ := testTrees(t,
+		[]testFile{{path: "lib/dep", mode: filemode.Submodule, hash: from}, {path: "lib/other", mode: filemode.Submodule, hash: from}},
+		[]testFile{{path: "lib/dep", mode: filemode.Submodule, hash: to}, {path: "lib/other", mode: filemode.Submodule, hash: to}})
+	opts := Options{
+		Repo: repo,
+		Page: &Page{
+			Title:      "test fork",
+			Base:       RefRepo{Name: "base", Ref: "refs/heads/base"},
+			Fork:       RefRepo{Name: "fork", Ref: "refs/heads/fork"},
+			Def:        &ForkDefinition{Title: "root", Globs: []string{"lib/*"}},
+			Submodules: []SubmoduleURL{{Path: "lib/dep", URL: "https://example.com/dep?a=1&b=2/"}},
+		},
+	}
+	res, err := Analyze(&opts)
+	if err != nil {
+		t.Fatalf("failed to analyze: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := res.Render(&buf, res.Page); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`submodule <code>lib/dep</code> updated <a href="https://example.com/dep?a=1&amp;b=2/commit/` + from.String() + `"><code>` + from.String() + `</code></a>`,
+		`submodule <code>lib/other</code> updated <code>` + from.String() + `</code> &rarr; <code>` + to.String() + `</code>`,
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("the page does not contain %s", want)
+		}
+	}
+
+	opts.Page.Submodules = []SubmoduleURL{{Path: "lib/dep"}}
+	if _, err := Analyze(&opts); err == nil {
+		t.Error("a submodule without URL is accepted")
+	}
+}
+
+func TestSymlinkTarget(t *testing.T) {
+	tests := []struct {
+		name       string
+		base, fork []testFile
+		change     SymlinkChange
+		html       string
+	}{
+		{
+			"changed",
+			[]testFile{{path: "link", mode: filemode.Symlink, content: "lib/v1"}},
+			[]testFile{{path: "link", mode: filemode.Symlink, content: "lib/v2"}},
+			SymlinkChange{From: "lib/v1", To: "lib/v2"},
+			"symlink changed: <code>lib/v1</code> &rarr; <code>lib/v2</code>",
+		},
+		{
+			"markup in the target",
+			[]testFile{{path: "link", mode: filemode.Symlink, content: "a&b"}},
+			[]testFile{{path: "link", mode: filemode.Symlink, content: `<img src=x onerror="alert(1)">`}},
+			SymlinkChange{From: "a&b", To: `<img src=x onerror="alert(1)">`},
+			"symlink changed: <code>a&amp;b</code> &rarr; <code>&lt;img src=x onerror=&#34;alert(1)&#34;&gt;</code>",
+		},
+		{
+			"added",
+			[]testFile{{path: "a.txt", content: "a\n"}},
+			[]testFile{{path: "a.txt", content: "a\n"}, {path: "link", mode: filemode.Symlink, content: "<a.txt>"}},
+			SymlinkChange{To: "<a.txt>"},
+			"symlink added: &rarr; <code>&lt;a.txt&gt;</code>",
+		},
+		{
+			"removed",
+			[]testFile{{path: "a.txt", content: "a\n"}, {path: "link", mode: filemode.Symlink, content: "\"a.txt\""}},
+			[]testFile{{path: "a.txt", content: "a\n"}},
+			SymlinkChange{From: "\"a.txt\""},
+			"symlink removed, was &rarr; <code>&#34;a.txt&#34;</code>",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo, _, _ := testTrees(t, tt.base, tt.fork)
+			def := &ForkDefinition{Title: "root", Globs: []string{"link"}}
+			res := analyzeTest(t, repo, def, Options{})
+			if len(def.Files) != 1 {
+				t.Fatalf("got files %v, want only the symlink", def.Files)
+			}
+			if fps := def.Files[0]; fps.Symlink == nil || *fps.Symlink != tt.change {
+				t.Fatalf("got symlink change %+v, want %+v", fps.Symlink, tt.change)
+			}
+			var buf bytes.Buffer
+			if err := res.Render(&buf, res.Page); err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(buf.String(), tt.html) {
+				t.Errorf("the page does not contain %s", tt.html)
+			}
+		})
+	}
+}
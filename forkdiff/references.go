@@ -0,0 +1,79 @@
+package forkdiff
+
+import (
+	"errors"
+	"fmt"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"io"
+	"sort"
+)
+
+// treePaths returns the sorted paths of all the files of the trees, without duplicates.
+func treePaths(trees ...*object.Tree) ([]string, error) {
+	seen := make(map[string]struct{})
+	for _, tree := range trees {
+		iter := tree.Files()
+		for {
+			f, err := iter.Next()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				iter.Close()
+				return nil, fmt.Errorf("failed to list files of tree %s: %w", tree.Hash, err)
+			}
+			seen[f.Name] = struct{}{}
+		}
+		iter.Close()
+	}
+	out := make([]string, 0, len(seen))
+	for k := range seen {
+		out = append(out, k)
+	}
+	sort.Strings(out)
+	return out, nil
+}
+
+// staleReferences appends a problem to out for every glob and dir of the definition, and of its sub-definitions,
+// that matches none of the paths, see Options.Strict. The paths are those of the base and fork trees,
+// so a glob of a section without changes, that still matches files, is not stale.
+func (fd *ForkDefinition) staleReferences(paths []string, foldCase bool, out *[]string) error {
+	for i, globPattern := range fd.Globs {
+		found := false
+		for _, name := range paths {
+			ok, err := matchGlob(globPattern, name, foldCase)
+			if err != nil {
+				return fmt.Errorf("failed to glob match entry %q against pattern %q: %w", name, globPattern, err)
+			}
+			if ok {
+				found = true
+				break
+			}
+		}
+		if !found {
+			*out = append(*out, fmt.Sprintf("section %q: glob %d (%q) matches no file", fd.Title, i, globPattern))
+		}
+	}
+	for i, dir := range fd.Dirs {
+		prefix, err := dirPrefix(dir)
+		if err != nil {
+			return fmt.Errorf("invalid dir %d: %w", i, err)
+		}
+		found := false
+		for _, name := range paths {
+			if matchDir(prefix, name, foldCase) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			*out = append(*out, fmt.Sprintf("section %q: dir %d (%q) matches no file", fd.Title, i, dir))
+		}
+	}
+	for _, sub := range fd.Sub {
+		if err := sub.staleReferences(paths, foldCase, out); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,138 @@
+package forkdiff
+
+import (
+	"fmt"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// isRefPattern returns true if the ref name contains glob characters.
+func isRefPattern(ref string) bool {
+	return strings.ContainsAny(ref, "*?[")
+}
+
+// resolveRefPattern finds the highest sorted reference that matches the glob pattern.
+// Versions in reference names are compared semver-aware, other names are compared lexically.
+func resolveRefPattern(repo *git.Repository, pattern string) (plumbing.ReferenceName, error) {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return "", fmt.Errorf("invalid ref pattern %q: %w", pattern, err)
+	}
+	iter, err := repo.References()
+	if err != nil {
+		return "", fmt.Errorf("failed to list references: %w", err)
+	}
+	var best plumbing.ReferenceName
+	err = iter.ForEach(func(ref *plumbing.Reference) error {
+		name := ref.Name()
+		if ok, _ := path.Match(pattern, name.String()); !ok {
+			return nil
+		}
+		if best == "" || compareRefNames(name.String(), best.String()) > 0 {
+			best = name
+		}
+		return nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to iterate references: %w", err)
+	}
+	if best == "" {
+		return "", fmt.Errorf("no references match pattern %q", pattern)
+	}
+	return best, nil
+}
+
+var refVersionRegex = regexp.MustCompile(`v?(\d+(?:\.\d+)*)(?:-([0-9A-Za-z.-]+))?$`)
+
+// compareRefNames compares two ref names by the semver-like version at the end of their name,
+// or lexically if either does not end with a version.
+func compareRefNames(a, b string) int {
+	ma, mb := refVersionRegex.FindStringSubmatch(a), refVersionRegex.FindStringSubmatch(b)
+	if ma == nil || mb == nil {
+		return strings.Compare(a, b)
+	}
+	pa, pb := strings.Split(ma[1], "."), strings.Split(mb[1], ".")
+	for i := 0; i < len(pa) || i < len(pb); i++ {
+		var va, vb uint64
+		if i < len(pa) {
+			va, _ = strconv.ParseUint(pa[i], 10, 64)
+		}
+		if i < len(pb) {
+			vb, _ = strconv.ParseUint(pb[i], 10, 64)
+		}
+		if va != vb {
+			if va < vb {
+				return -1
+			}
+			return 1
+		}
+	}
+	// a release is higher than its pre-release
+	switch {
+	case ma[2] == "" && mb[2] != "":
+		return 1
+	case ma[2] != "" && mb[2] == "":
+		return -1
+	case ma[2] != mb[2]:
+		if c := comparePrerelease(ma[2], mb[2]); c != 0 {
+			return c
+		}
+	}
+	return strings.Compare(a, b)
+}
+
+// comparePrerelease compares two pre-release versions like semver: by their dot-separated identifiers,
+// numerically if both are numeric, so "rc.2" is lower than "rc.10", otherwise lexically.
+// A numeric identifier is lower than a non-numeric one, and a shorter list of identifiers is lower if it is a prefix.
+func comparePrerelease(a, b string) int {
+	ia, ib := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(ia) && i < len(ib); i++ {
+		x, y := ia[i], ib[i]
+		nx, ny := isNumeric(x), isNumeric(y)
+		switch {
+		case nx && ny:
+			// compare the numeric value without parsing, numbers may be large
+			tx, ty := strings.TrimLeft(x, "0"), strings.TrimLeft(y, "0")
+			if len(tx) != len(ty) {
+				if len(tx) < len(ty) {
+					return -1
+				}
+				return 1
+			}
+			if c := strings.Compare(tx, ty); c != 0 {
+				return c
+			}
+		case nx:
+			return -1
+		case ny:
+			return 1
+		default:
+			if c := strings.Compare(x, y); c != 0 {
+				return c
+			}
+		}
+	}
+	switch {
+	case len(ia) < len(ib):
+		return -1
+	case len(ia) > len(ib):
+		return 1
+	}
+	return 0
+}
+
+// isNumeric returns true if s is a non-empty run of digits.
+func isNumeric(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if !isDigit(s[i]) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,74 @@
+package forkdiff
+
+import (
+	"github.com/go-git/go-git/v5/plumbing"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestCompareRefNames(t *testing.T) {
+	// in ascending order
+	ordered := []string{
+		"refs/tags/v1.2.0-alpha",
+		"refs/tags/v1.2.0-alpha.1",
+		"refs/tags/v1.2.0-alpha.beta",
+		"refs/tags/v1.2.0-beta",
+		"refs/tags/v1.2.0-beta.2",
+		"refs/tags/v1.2.0-beta.11",
+		"refs/tags/v1.2.0-rc.1",
+		"refs/tags/v1.2.0-rc.2",
+		"refs/tags/v1.2.0-rc.10",
+		"refs/tags/v1.2.0",
+		"refs/tags/v1.10.0-rc.1",
+		"refs/tags/v1.10.0",
+	}
+	got := append([]string(nil), ordered...)
+	sort.Slice(got, func(i, j int) bool { return compareRefNames(got[i], got[j]) < 0 })
+	if !reflect.DeepEqual(got, ordered) {
+		t.Errorf("got order %v", got)
+	}
+	for i := 1; i < len(ordered); i++ {
+		if c := compareRefNames(ordered[i], ordered[i-1]); c <= 0 {
+			t.Errorf("compareRefNames(%q, %q) = %d, want > 0", ordered[i], ordered[i-1], c)
+		}
+	}
+}
+
+func TestComparePrerelease(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"rc.2", "rc.10", -1},
+		{"rc.10", "rc.2", 1},
+		{"rc.02", "rc.2", 0},
+		{"1", "alpha", -1},
+		{"alpha", "1", 1},
+		{"rc", "rc.1", -1},
+		{"beta.99999999999999999999", "beta.100000000000000000000", -1},
+		{"rc-1", "rc-2", -1},
+	}
+	for _, tt := range tests {
+		if got := comparePrerelease(tt.a, tt.b); got != tt.want {
+			t.Errorf("comparePrerelease(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestResolveRefPattern(t *testing.T) {
+	repo := newTestRepo(t)
+	commit := commitTestFiles(t, repo, "main", "release", testFiles(map[string]string{"a": "a\n"}))
+	for _, tag := range []string{"v1.2.0-rc.2", "v1.2.0-rc.10", "v1.2.0-rc.9", "other"} {
+		if err := repo.Storer.SetReference(plumbing.NewHashReference(plumbing.NewTagReferenceName(tag), commit.Hash)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	got, err := resolveRefPattern(repo, "refs/tags/v1.2.0-rc.*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := plumbing.NewTagReferenceName("v1.2.0-rc.10"); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,176 @@
+package forkdiff
+
+import (
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/storage/memory"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testFile is a file of a tree of a test repository: a regular file with the content,
+// or, with a mode, a symlink with the content as target or a submodule at the hash.
+type testFile struct {
+	path    string
+	content string
+	mode    filemode.FileMode
+	hash    plumbing.Hash
+}
+
+// testFiles returns the regular files of the contents by path.
+func testFiles(contents map[string]string) []testFile {
+	out := make([]testFile, 0, len(contents))
+	for p, content := range contents {
+		out = append(out, testFile{path: p, content: content})
+	}
+	return out
+}
+
+// newTestRepo returns an empty repository that is only kept in memory.
+func newTestRepo(t *testing.T) *git.Repository {
+	t.Helper()
+	repo, err := git.Init(memory.NewStorage(), nil)
+	if err != nil {
+		t.Fatalf("failed to init repository: %v", err)
+	}
+	return repo
+}
+
+// writeTestObject stores the object in the repository, and returns its hash.
+func writeTestObject(t *testing.T, repo *git.Repository, o interface {
+	Encode(plumbing.EncodedObject) error
+}) plumbing.Hash {
+	t.Helper()
+	obj := repo.Storer.NewEncodedObject()
+	if err := o.Encode(obj); err != nil {
+		t.Fatalf("failed to encode object: %v", err)
+	}
+	h, err := repo.Storer.SetEncodedObject(obj)
+	if err != nil {
+		t.Fatalf("failed to store object: %v", err)
+	}
+	return h
+}
+
+// writeTestTree stores the tree of the files, with the trees of their directories, and returns its hash.
+func writeTestTree(t *testing.T, repo *git.Repository, files []testFile) plumbing.Hash {
+	t.Helper()
+	byDir := make(map[string][]testFile)
+	tree := &object.Tree{}
+	for _, f := range files {
+		dir, rest, nested := strings.Cut(f.path, "/")
+		if nested {
+			sub := f
+			sub.path = rest
+			byDir[dir] = append(byDir[dir], sub)
+			continue
+		}
+		entry := object.TreeEntry{Name: f.path, Mode: f.mode, Hash: f.hash}
+		if f.mode == filemode.Empty {
+			entry.Mode = filemode.Regular
+		}
+		if entry.Mode != filemode.Submodule {
+			blob := repo.Storer.NewEncodedObject()
+			blob.SetType(plumbing.BlobObject)
+			w, err := blob.Writer()
+			if err != nil {
+				t.Fatalf("failed to write blob: %v", err)
+			}
+			if _, err := w.Write([]byte(f.content)); err != nil {
+				t.Fatalf("failed to write blob: %v", err)
+			}
+			if err := w.Close(); err != nil {
+				t.Fatalf("failed to write blob: %v", err)
+			}
+			if entry.Hash, err = repo.Storer.SetEncodedObject(blob); err != nil {
+				t.Fatalf("failed to store blob: %v", err)
+			}
+		}
+		tree.Entries = append(tree.Entries, entry)
+	}
+	for dir, sub := range byDir {
+		tree.Entries = append(tree.Entries, object.TreeEntry{Name: dir, Mode: filemode.Dir, Hash: writeTestTree(t, repo, sub)})
+	}
+	// git sorts the entries by name, with a slash after the names of directories
+	sortName := func(e object.TreeEntry) string {
+		if e.Mode == filemode.Dir {
+			return e.Name + "/"
+		}
+		return e.Name
+	}
+	sort.Slice(tree.Entries, func(i, j int) bool {
+		return sortName(tree.Entries[i]) < sortName(tree.Entries[j])
+	})
+	return writeTestObject(t, repo, tree)
+}
+
+// testCommitTime is the time of the first test commit, every next commit is an hour later,
+// so the commits are ordered, and the output does not depend on when the test runs.
+var testCommitTime = time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC)
+
+// commitTestFiles commits the files as the tree of the branch, on top of the commit of the branch, if any.
+func commitTestFiles(t *testing.T, repo *git.Repository, branch string, message string, files []testFile) *object.Commit {
+	t.Helper()
+	refName := plumbing.NewBranchReferenceName(branch)
+	c := &object.Commit{
+		Message:  message,
+		TreeHash: writeTestTree(t, repo, files),
+	}
+	when := testCommitTime
+	if parent, err := repo.Reference(refName, true); err == nil {
+		parentCommit, err := repo.CommitObject(parent.Hash())
+		if err != nil {
+			t.Fatalf("failed to open parent commit: %v", err)
+		}
+		c.ParentHashes = []plumbing.Hash{parent.Hash()}
+		when = parentCommit.Committer.When.Add(time.Hour)
+	}
+	c.Author = object.Signature{Name: "Dev", Email: "dev@example.com", When: when}
+	c.Committer = c.Author
+	h := writeTestObject(t, repo, c)
+	if err := repo.Storer.SetReference(plumbing.NewHashReference(refName, h)); err != nil {
+		t.Fatalf("failed to set branch %q: %v", branch, err)
+	}
+	commit, err := repo.CommitObject(h)
+	if err != nil {
+		t.Fatalf("failed to open commit: %v", err)
+	}
+	return commit
+}
+
+// testTrees commits the base and fork files to the "base" and "fork" branches of a new repository,
+// and returns their trees.
+func testTrees(t *testing.T, base, fork []testFile) (*git.Repository, *object.Tree, *object.Tree) {
+	t.Helper()
+	repo := newTestRepo(t)
+	baseTree, err := commitTestFiles(t, repo, "base", "base", base).Tree()
+	if err != nil {
+		t.Fatalf("failed to open base tree: %v", err)
+	}
+	forkTree, err := commitTestFiles(t, repo, "fork", "fork", fork).Tree()
+	if err != nil {
+		t.Fatalf("failed to open fork tree: %v", err)
+	}
+	return repo, baseTree, forkTree
+}
+
+// analyzeTest analyzes the "base" and "fork" branches of the repository with the options, by the sections of def.
+func analyzeTest(t *testing.T, repo *git.Repository, def *ForkDefinition, opts Options) *Result {
+	t.Helper()
+	opts.Repo = repo
+	opts.Page = &Page{
+		Title: "test fork",
+		Base:  RefRepo{Name: "base", Ref: "refs/heads/base"},
+		Fork:  RefRepo{Name: "fork", Ref: "refs/heads/fork"},
+		Def:   def,
+	}
+	res, err := Analyze(&opts)
+	if err != nil {
+		t.Fatalf("failed to analyze: %v", err)
+	}
+	return res
+}
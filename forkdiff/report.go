@@ -0,0 +1,148 @@
+package forkdiff
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Report is the JSON rendering of a page, for scripts: the sections with their files and line counts,
+// without the diffs and descriptions, see renderJSON.
+type Report struct {
+	Title string `json:"title"`
+	// Base and Fork are the hashes of the compared commits.
+	Base string `json:"base"`
+	Fork string `json:"fork"`
+	// Stats are the totals of the changed files that are not ignored, also if they are grouped by commit.
+	Stats ReportStats `json:"stats"`
+	// Sections are the sections of the page, depth-first, the root definition being level 1.
+	// Empty if the changes are grouped by commit.
+	Sections []ReportSection `json:"sections"`
+	// Commits are the fork commits with the sections of their changes, if the changes are grouped by commit.
+	Commits []ReportCommit `json:"commits,omitempty"`
+	// Ignored are the changed files that match an ignore glob of the page, if any.
+	Ignored *ReportSection `json:"ignored,omitempty"`
+	// Split are the top-level sections that are rendered to separate pages, on the index page in split mode.
+	Split []ReportSplit `json:"split,omitempty"`
+}
+
+// ReportStats are the number of files and changed lines of a Report or section.
+type ReportStats struct {
+	Files   int `json:"files"`
+	Added   int `json:"added"`
+	Deleted int `json:"deleted"`
+}
+
+// ReportSection is a section of a Report, with the totals including its sub-sections,
+// and the files that it lists itself.
+type ReportSection struct {
+	Title string `json:"title"`
+	// ID is the anchor of the section on the HTML page.
+	ID    string `json:"id"`
+	Level int    `json:"level"`
+	// Auto is true if the section was generated from the directories of the unclaimed files.
+	Auto  bool         `json:"auto,omitempty"`
+	Stats ReportStats  `json:"stats"`
+	Files []ReportFile `json:"files"`
+}
+
+// ReportFile is a changed file of a ReportSection.
+type ReportFile struct {
+	Path string `json:"path"`
+	// Status is "added", "modified" or "removed", like the data-status attribute of the HTML page.
+	Status  string `json:"status"`
+	Added   int    `json:"added"`
+	Deleted int    `json:"deleted"`
+	Binary  bool   `json:"binary,omitempty"`
+	// TooLarge is true if the diff was omitted because of the file size limit.
+	TooLarge bool `json:"too_large,omitempty"`
+}
+
+// ReportCommit is a fork commit of a Report, with the sections of the files that it changed.
+type ReportCommit struct {
+	Hash     string          `json:"hash"`
+	Subject  string          `json:"subject"`
+	Merge    bool            `json:"merge,omitempty"`
+	Note     string          `json:"note,omitempty"`
+	Sections []ReportSection `json:"sections"`
+}
+
+// ReportSplit is a top-level section that is rendered to a separate page, see SplitSection.
+type ReportSplit struct {
+	Title string      `json:"title"`
+	Link  string      `json:"link"`
+	Stats ReportStats `json:"stats"`
+}
+
+// Report returns the JSON rendering of the given page, see Report.
+func (r *Result) Report(p *Page) *Report {
+	out := &Report{
+		Title:    p.Title,
+		Base:     r.BaseCommit.Hash.String(),
+		Fork:     r.ForkCommit.Hash.String(),
+		Stats:    sectionStats(p.Def),
+		Sections: []ReportSection{},
+	}
+	if r.Options.GroupBy == "commit" {
+		for _, c := range p.Commits {
+			out.Commits = append(out.Commits, ReportCommit{
+				Hash:     c.Commit.Hash.String(),
+				Subject:  c.Def.Title,
+				Merge:    c.Merge,
+				Note:     c.Note,
+				Sections: reportSections(nil, c.Def, 1),
+			})
+		}
+	} else {
+		out.Sections = reportSections(out.Sections, p.Def, 1)
+	}
+	for _, s := range p.Split {
+		out.Split = append(out.Split, ReportSplit{Title: s.Def.Title, Link: s.Link, Stats: sectionStats(s.Def)})
+	}
+	if p.Ignored != nil {
+		ignored := reportSections(nil, p.Ignored, 1)[0]
+		out.Ignored = &ignored
+	}
+	return out
+}
+
+func sectionStats(fd *ForkDefinition) ReportStats {
+	return ReportStats{Files: fd.FileCount, Added: fd.LinesAdded, Deleted: fd.LinesDeleted}
+}
+
+// reportSections appends the section and its sub-sections, depth-first, to out.
+func reportSections(out []ReportSection, fd *ForkDefinition, level int) []ReportSection {
+	section := ReportSection{
+		Title: fd.Title,
+		ID:    fd.ID,
+		Level: level,
+		Auto:  fd.Auto,
+		Stats: sectionStats(fd),
+		Files: make([]ReportFile, 0, len(fd.Files)),
+	}
+	for i := range fd.Files {
+		fps := &fd.Files[i]
+		section.Files = append(section.Files, ReportFile{
+			Path:     fps.Path,
+			Status:   fileStatus(changeKind(fps.Patch)),
+			Added:    fps.LinesAdded,
+			Deleted:  fps.LinesDeleted,
+			Binary:   fps.Binary,
+			TooLarge: fps.TooLarge,
+		})
+	}
+	out = append(out, section)
+	for _, sub := range fd.Sub {
+		out = reportSections(out, sub, level+1)
+	}
+	return out
+}
+
+// renderJSON writes the Report of the page as indented JSON.
+func (r *Result) renderJSON(out *sizeLimit, p *Page) error {
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(r.Report(p)); err != nil {
+		return fmt.Errorf("failed to encode report: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package forkdiff
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestRenderJSON(t *testing.T) {
+	repo, _, _ := testTrees(t,
+		testFiles(map[string]string{"main.go": "package main\n", "util/a.go": "a\n", "old.txt": "x\n"}),
+		testFiles(map[string]string{"main.go": "package main\n\nfunc main() {}\n", "util/a.go": "b\n", "new.txt": "y\n"}))
+	def := &ForkDefinition{
+		Title: "root",
+		Globs: []string{"main.go"},
+		Sub:   []*ForkDefinition{{Title: "util", Dirs: []string{"util"}}},
+	}
+	res := analyzeTest(t, repo, def, Options{Format: "json"})
+	var buf bytes.Buffer
+	if err := res.Render(&buf, res.Page); err != nil {
+		t.Fatal(err)
+	}
+	var got Report
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("invalid JSON: %v\n%s", err, buf.String())
+	}
+	if got.Title != "test fork" || got.Fork != res.ForkCommit.Hash.String() {
+		t.Errorf("got title %q and fork %s", got.Title, got.Fork)
+	}
+	if want := (ReportStats{Files: 4, Added: 4, Deleted: 2}); got.Stats != want {
+		t.Errorf("got stats %+v, want %+v", got.Stats, want)
+	}
+	if len(got.Sections) != 3 {
+		t.Fatalf("got %d sections, want 3", len(got.Sections))
+	}
+	wantFiles := []ReportFile{{Path: "main.go", Status: "modified", Added: 2}}
+	if root := got.Sections[0]; root.Level != 1 || root.ID != def.ID || !reflect.DeepEqual(root.Files, wantFiles) {
+		t.Errorf("got root section %+v", root)
+	}
+	wantFiles = []ReportFile{{Path: "util/a.go", Status: "modified", Added: 1, Deleted: 1}}
+	if util := got.Sections[1]; util.Title != "util" || util.Level != 2 || !reflect.DeepEqual(util.Files, wantFiles) {
+		t.Errorf("got util section %+v", util)
+	}
+	wantFiles = []ReportFile{{Path: "new.txt", Status: "added", Added: 1}, {Path: "old.txt", Status: "removed", Deleted: 1}}
+	if remaining := got.Sections[2]; !reflect.DeepEqual(remaining.Files, wantFiles) {
+		t.Errorf("got remaining section %+v", remaining)
+	}
+}
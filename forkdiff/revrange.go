@@ -0,0 +1,75 @@
+package forkdiff
+
+import (
+	"fmt"
+	"github.com/go-git/go-git/v5/plumbing"
+	"strings"
+)
+
+// parseRange splits a revision range of Options.Range into its sides. An empty side is HEAD, like in git.
+// With three dots, the fork is diffed against the merge base of the sides, instead of the first side.
+func parseRange(expr string) (from, to string, mergeBase bool, err error) {
+	sep := ".."
+	if strings.Contains(expr, "...") {
+		sep, mergeBase = "...", true
+	}
+	from, to, ok := strings.Cut(expr, sep)
+	if !ok {
+		return "", "", false, fmt.Errorf("invalid range %q, must be A..B or A...B", expr)
+	}
+	if from == "" && to == "" {
+		return "", "", false, fmt.Errorf("invalid range %q, needs at least one revision", expr)
+	}
+	if strings.Contains(to, "..") {
+		return "", "", false, fmt.Errorf("invalid range %q, has more than two revisions", expr)
+	}
+	if from == "" {
+		from = "HEAD"
+	}
+	if to == "" {
+		to = "HEAD"
+	}
+	return from, to, mergeBase, nil
+}
+
+// resolveRange resolves the base and fork commits of a revision range, see Options.Range.
+// The revisions may be anything that go-git resolves, like refs, short ref names and hashes.
+func resolveRange(opts *Options, expr string) (base, fork plumbing.Hash, err error) {
+	from, to, mergeBase, err := parseRange(expr)
+	if err != nil {
+		return plumbing.ZeroHash, plumbing.ZeroHash, err
+	}
+	resolve := func(rev string) (plumbing.Hash, error) {
+		h, err := opts.Repo.ResolveRevision(plumbing.Revision(rev))
+		if err != nil {
+			return plumbing.ZeroHash, fmt.Errorf("failed to resolve %q: %w", rev, err)
+		}
+		return *h, nil
+	}
+	if base, err = resolve(from); err != nil {
+		return plumbing.ZeroHash, plumbing.ZeroHash, err
+	}
+	if fork, err = resolve(to); err != nil {
+		return plumbing.ZeroHash, plumbing.ZeroHash, err
+	}
+	if !mergeBase {
+		return base, fork, nil
+	}
+	baseCommit, err := opts.Repo.CommitObject(base)
+	if err != nil {
+		return plumbing.ZeroHash, plumbing.ZeroHash, fmt.Errorf("failed to open commit %s: %w", base, err)
+	}
+	forkCommit, err := opts.Repo.CommitObject(fork)
+	if err != nil {
+		return plumbing.ZeroHash, plumbing.ZeroHash, fmt.Errorf("failed to open commit %s: %w", fork, err)
+	}
+	bases, err := forkCommit.MergeBase(baseCommit)
+	if err != nil {
+		return plumbing.ZeroHash, plumbing.ZeroHash, fmt.Errorf("failed to find merge base of %q and %q: %w", from, to, err)
+	}
+	if len(bases) == 0 {
+		return plumbing.ZeroHash, plumbing.ZeroHash, fmt.Errorf("no merge base, %q and %q have no common history", from, to)
+	}
+	opts.logf("diffing against the merge base %s of %q and %q\n", bases[0].Hash, from, to)
+	return bases[0].Hash, fork, nil
+}
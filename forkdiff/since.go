@@ -0,0 +1,116 @@
+package forkdiff
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/format/diff"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"sort"
+)
+
+// SinceChanges are the changes of the fork since a previous fork commit, see Options.Since.
+type SinceChanges struct {
+	Commit *object.Commit
+	// Files are the files on the page that changed since the commit, in page order.
+	Files []*FilePatchStats
+	// Dropped are the paths that changed since the commit, but are not on the page,
+	// like changes that were reverted to match the base.
+	Dropped []string
+
+	// added are the fork line numbers of the lines that changed since the commit, by path.
+	added map[string]map[int]struct{}
+	// changed are the paths of all the files that changed since the commit.
+	changed map[string]struct{}
+}
+
+// compareSince computes the changes between the tree of the since commit and the fork tree.
+func (r *Result) compareSince(since string) (*SinceChanges, error) {
+	h, err := r.Options.Repo.ResolveRevision(plumbing.Revision(since))
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve %q: %w", since, err)
+	}
+	commit, err := r.Options.Repo.CommitObject(*h)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open commit %s: %w", h, err)
+	}
+	tree, err := commit.Tree()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open tree of commit %s: %w", h, err)
+	}
+	patches, err := ComputePatches(context.Background(), tree, r.ForkTree, r.Options.MaxFileSize, r.Options.RenameThreshold)
+	if err != nil {
+		return nil, err
+	}
+	out := &SinceChanges{
+		Commit:  commit,
+		added:   make(map[string]map[int]struct{}),
+		changed: make(map[string]struct{}),
+	}
+	for _, k := range sortedPatchNames(patches.ByName) {
+		fp := patches.ByName[k]
+		out.changed[k] = struct{}{}
+		if fp.IsBinary() {
+			continue
+		}
+		var encoded bytes.Buffer
+		if err := diff.NewUnifiedEncoder(&encoded, 0).Encode(FilePatch{filePatch: fp}); err != nil {
+			return nil, fmt.Errorf("failed to encode patch of %q since %s: %w", k, h, err)
+		}
+		_, hunks := splitHunks(encoded.String())
+		lines := make(map[int]struct{})
+		for _, hunk := range hunks {
+			for _, n := range hunk.Added {
+				lines[n] = struct{}{}
+			}
+		}
+		out.added[k] = lines
+	}
+	return out, nil
+}
+
+// mark flags the files of the definition, and its sub-definitions, that changed since the commit.
+// The changed paths are added to onPage, so files in multiple sections are listed once.
+func (s *SinceChanges) mark(fd *ForkDefinition, onPage map[string]struct{}) {
+	for i := range fd.Files {
+		fps := &fd.Files[i]
+		if _, ok := s.changed[fps.Path]; !ok {
+			continue
+		}
+		fps.ChangedSince = true
+		if _, ok := onPage[fps.Path]; !ok {
+			s.Files = append(s.Files, fps)
+		}
+		onPage[fps.Path] = struct{}{}
+	}
+	for _, sub := range fd.Sub {
+		s.mark(sub, onPage)
+	}
+}
+
+// markPage flags the changed files of the page, and collects the changed files that are not on the page.
+func (s *SinceChanges) markPage(p *Page) {
+	onPage := make(map[string]struct{})
+	s.mark(p.Def, onPage)
+	if p.Ignored != nil {
+		s.mark(p.Ignored, onPage)
+	}
+	for k := range s.changed {
+		if _, ok := onPage[k]; !ok {
+			s.Dropped = append(s.Dropped, k)
+		}
+	}
+	sort.Strings(s.Dropped)
+}
+
+// changedHunk reports if any of the added lines of the hunk changed since the commit.
+func (s *SinceChanges) changedHunk(path string, h *diffHunk) bool {
+	lines := s.added[path]
+	for _, n := range h.Added {
+		if _, ok := lines[n]; ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,76 @@
+package forkdiff
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// SplitSection is a top-level section that is rendered to its own page in split mode.
+type SplitSection struct {
+	Def *ForkDefinition
+	// Link is the path of the section page, relative to the index page.
+	Link string
+}
+
+// SplitPages splits the analyzed page into an index page, and a page per top-level section, for split mode.
+// The path of each section page, relative to the index page, is the Link of the corresponding index Split entry.
+// The paths are determined by outPattern, see splitPagePath. The index page is named indexName.
+func (r *Result) SplitPages(outPattern string, indexName string) (index *Page, sections []*Page, err error) {
+	if r.Options.GroupBy == "commit" {
+		return nil, nil, &ConfigError{Err: errors.New("cannot split the page by section when grouping by commit")}
+	}
+	indexDef := *r.Page.Def
+	indexDef.Sub = nil
+	indexPage := *r.Page
+	indexPage.Def = &indexDef
+	for i, sub := range r.Page.Def.Sub {
+		link := splitPagePath(outPattern, i+1, sub.Title)
+		for _, prev := range indexPage.Split {
+			if prev.Link == link {
+				return nil, nil, &ConfigError{Err: fmt.Errorf("sections %q and %q are written to the same page %q", prev.Def.Title, sub.Title, link)}
+			}
+		}
+		indexPage.Split = append(indexPage.Split, SplitSection{Def: sub, Link: link})
+	}
+	for _, split := range indexPage.Split {
+		indexLink, err := filepath.Rel(filepath.Dir(filepath.FromSlash(split.Link)), indexName)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to determine link from %q to index page: %w", split.Link, err)
+		}
+		sectionPage := *r.Page
+		sectionPage.Def = split.Def
+		sectionPage.Ignored = nil
+		sectionPage.IndexLink = filepath.ToSlash(indexLink)
+		sections = append(sections, &sectionPage)
+	}
+	return &indexPage, sections, nil
+}
+
+// splitPagePath expands the {index} and {slug} placeholders of a split mode output pattern.
+func splitPagePath(pattern string, index int, title string) string {
+	return strings.NewReplacer("{index}", strconv.Itoa(index), "{slug}", slugify(title)).Replace(pattern)
+}
+
+// slugify turns a title into a lowercase slug that is safe to use in filenames.
+func slugify(title string) string {
+	var out strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(title) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			if dash && out.Len() > 0 {
+				out.WriteByte('-')
+			}
+			dash = false
+			out.WriteRune(r)
+		} else {
+			dash = true
+		}
+	}
+	if out.Len() == 0 {
+		return "section"
+	}
+	return out.String()
+}
@@ -0,0 +1,200 @@
+package forkdiff
+
+import (
+	"fmt"
+	"github.com/go-git/go-git/v5/plumbing/format/diff"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// diffStatWidth is the total width of the diffstat lines, like git when the output is not a terminal.
+const diffStatWidth = 80
+
+// WriteDiffStat writes the diffstat of the files on the page to w, in the format of "git diff --stat":
+// a line per file with the changed lines and a graph of the insertions and deletions, and a summary line.
+// The ignored files, and the unclaimed files if Options.NoRemaining is set, are not on the page and not counted.
+// Files that are too large to diff are listed with their sizes, like binary files,
+// and so are git LFS pointer files, with the sizes of their objects.
+func (r *Result) WriteDiffStat(w io.Writer) error {
+	type statLine struct {
+		name             string
+		added, deleted   int
+		binary           bool
+		fromSize, toSize int64
+	}
+	var lines []statLine
+	maxName, maxChange := 0, 0
+	hasBinary := false
+	totalAdded, totalDeleted := 0, 0
+	for _, k := range sortedPatchNames(r.patchByName) {
+		p := r.patchByName[k]
+		from, to := p.Files()
+		l := statLine{name: k}
+		if from != nil && to != nil && from.Path() != to.Path() {
+			l.name = renameStatName(from.Path(), to.Path())
+		}
+		_, omitted := p.(*omittedFilePatch)
+		if lfs, ok := p.(*lfsFilePatch); ok {
+			l.binary = true
+			hasBinary = true
+			if lfs.change.From != nil {
+				l.fromSize = lfs.change.From.Size
+			}
+			if lfs.change.To != nil {
+				l.toSize = lfs.change.To.Size
+			}
+		} else if p.IsBinary() || omitted {
+			l.binary = true
+			hasBinary = true
+			var err error
+			if l.fromSize, err = r.blobSize(from); err != nil {
+				return err
+			}
+			if l.toSize, err = r.blobSize(to); err != nil {
+				return err
+			}
+		} else {
+			l.added = countOperations(p.Chunks(), diff.Add)
+			l.deleted = countOperations(p.Chunks(), diff.Delete)
+			if l.added+l.deleted > maxChange {
+				maxChange = l.added + l.deleted
+			}
+			totalAdded += l.added
+			totalDeleted += l.deleted
+		}
+		if n := utf8.RuneCountInString(l.name); n > maxName {
+			maxName = n
+		}
+		lines = append(lines, l)
+	}
+
+	// the layout follows git: a space, the name, " | ", the number, a space, the graph, and an empty last column
+	numberWidth := len(strconv.Itoa(maxChange))
+	if hasBinary && numberWidth < 3 {
+		numberWidth = 3 // "Bin"
+	}
+	nameWidth, graphWidth := maxName, maxChange
+	if nameWidth+numberWidth+6+graphWidth > diffStatWidth {
+		if limit := diffStatWidth*3/8 - numberWidth - 6; graphWidth > limit {
+			graphWidth = limit
+			if graphWidth < 6 {
+				graphWidth = 6
+			}
+		}
+		if nameWidth > diffStatWidth-numberWidth-6-graphWidth {
+			nameWidth = diffStatWidth - numberWidth - 6 - graphWidth
+		} else {
+			graphWidth = diffStatWidth - numberWidth - 6 - nameWidth
+		}
+	}
+
+	var out strings.Builder
+	for _, l := range lines {
+		name := truncateStatName(l.name, nameWidth)
+		padding := strings.Repeat(" ", nameWidth-utf8.RuneCountInString(name))
+		if l.binary {
+			fmt.Fprintf(&out, " %s%s | %*s %d -> %d bytes\n", name, padding, numberWidth, "Bin", l.fromSize, l.toSize)
+			continue
+		}
+		added, deleted := l.added, l.deleted
+		if maxChange > graphWidth {
+			added = scaleStat(added, graphWidth, maxChange)
+			deleted = scaleStat(deleted, graphWidth, maxChange)
+		}
+		sep := ""
+		if l.added+l.deleted > 0 {
+			sep = " "
+		}
+		fmt.Fprintf(&out, " %s%s | %*d%s%s%s\n", name, padding, numberWidth, l.added+l.deleted, sep,
+			strings.Repeat("+", added), strings.Repeat("-", deleted))
+	}
+	out.WriteString(diffStatSummary(len(lines), totalAdded, totalDeleted))
+	_, err := io.WriteString(w, out.String())
+	return err
+}
+
+// diffStatSummary formats the last line of a diffstat, like git.
+func diffStatSummary(files, added, deleted int) string {
+	if files == 0 {
+		return " 0 files changed\n"
+	}
+	out := fmt.Sprintf(" %d file%s changed", files, plural(files))
+	if added > 0 || deleted == 0 {
+		out += fmt.Sprintf(", %d insertion%s(+)", added, plural(added))
+	}
+	if deleted > 0 || added == 0 {
+		out += fmt.Sprintf(", %d deletion%s(-)", deleted, plural(deleted))
+	}
+	return out + "\n"
+}
+
+// scaleStat scales a number of changed lines to the graph width, keeping at least one mark for a change, like git.
+func scaleStat(n, width, max int) int {
+	if n == 0 {
+		return 0
+	}
+	return 1 + (n*(width-1))/max
+}
+
+// renameStatName formats a rename like git, with the common leading directories and trailing path outside of braces:
+// "dir/{old => new}/file.go".
+func renameStatName(from, to string) string {
+	// the common prefix ends with a slash, the common suffix starts with one, and they may share that slash
+	prefix := 0
+	for i := 0; i < len(from) && i < len(to) && from[i] == to[i]; i++ {
+		if from[i] == '/' {
+			prefix = i + 1
+		}
+	}
+	shared := 0
+	if prefix > 0 {
+		shared = 1
+	}
+	suffix := 0
+	for i := 1; i <= len(from)-prefix+shared && i <= len(to)-prefix+shared && from[len(from)-i] == to[len(to)-i]; i++ {
+		if from[len(from)-i] == '/' {
+			suffix = i
+		}
+	}
+	if prefix == 0 && suffix == 0 {
+		return from + " => " + to
+	}
+	middle := func(p string) string {
+		if end := len(p) - suffix; end > prefix {
+			return p[prefix:end]
+		}
+		return ""
+	}
+	return from[:prefix] + "{" + middle(from) + " => " + middle(to) + "}" + from[len(from)-suffix:]
+}
+
+// truncateStatName shortens a name that is wider than width to "..." and its end, starting at a directory if possible.
+func truncateStatName(name string, width int) string {
+	runes := []rune(name)
+	if len(runes) <= width {
+		return name
+	}
+	keep := width - 3
+	if keep < 0 {
+		keep = 0
+	}
+	tail := string(runes[len(runes)-keep:])
+	if i := strings.IndexByte(tail, '/'); i >= 0 {
+		tail = tail[i:]
+	}
+	return "..." + tail
+}
+
+// blobSize returns the size of the blob of a side of a patch, 0 if the file does not exist on that side.
+func (r *Result) blobSize(f diff.File) (int64, error) {
+	if f == nil {
+		return 0, nil
+	}
+	blob, err := r.Options.Repo.BlobObject(f.Hash())
+	if err != nil {
+		return 0, fmt.Errorf("failed to open blob of %q: %w", f.Path(), err)
+	}
+	return blob.Size, nil
+}
@@ -0,0 +1,30 @@
+package forkdiff
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestWriteDiffStat(t *testing.T) {
+	repo, baseTree, forkTree := testTrees(t,
+		testFiles(map[string]string{"eof.txt": "a\nb", "main.go": "package main\n", "gone.txt": "x\ny\n"}),
+		testFiles(map[string]string{"eof.txt": "a\nb\n", "main.go": "package main\n\nfunc main() {}\n"}))
+	patches, err := ComputePatches(context.Background(), baseTree, forkTree, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &Result{Options: &Options{Repo: repo}, patchByName: patches.ByName}
+	var out strings.Builder
+	if err := r.WriteDiffStat(&out); err != nil {
+		t.Fatal(err)
+	}
+	// like git diff --stat
+	want := " eof.txt  | 2 +-\n" +
+		" gone.txt | 2 --\n" +
+		" main.go  | 2 ++\n" +
+		" 3 files changed, 3 insertions(+), 3 deletions(-)\n"
+	if out.String() != want {
+		t.Errorf("got:\n%s\nwant:\n%s", out.String(), want)
+	}
+}
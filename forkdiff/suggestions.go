@@ -0,0 +1,126 @@
+package forkdiff
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/go-git/go-git/v5/plumbing/format/diff"
+	"strings"
+)
+
+// suggestion replaces the base lines From to To (inclusive) of a file with the Lines of the fork.
+type suggestion struct {
+	From, To int
+	Lines    []string
+}
+
+// renderSuggestions writes the changes of the files on the page in the GitHub review suggestion format:
+// for every changed region, the base path and line range, followed by a ```suggestion block with the fork lines.
+// Regions that only add lines do not replace any base lines, and cannot be a suggestion; these are skipped,
+// with a note on the log, as are new files, binary files, symlinks, submodules, files that are too large to diff
+// and files that are converted with a textconv filter.
+func (r *Result) renderSuggestions(out *sizeLimit, p *Page) error {
+	tw := &textWriter{w: out, out: out}
+	seen := make(map[string]struct{})
+	var files []*FilePatchStats
+	p.Def.collectFiles(func(fps *FilePatchStats) {
+		if _, ok := seen[fps.Path]; !ok {
+			seen[fps.Path] = struct{}{}
+			files = append(files, fps)
+		}
+	})
+	for _, fps := range files {
+		if fps.Binary || fps.Symlink != nil || fps.Submodule != nil || fps.LFS != nil || fps.TooLarge {
+			r.Options.logf("skipped suggestions for %q: no line diff\n", fps.Path)
+			continue
+		}
+		if _, ok := fps.Patch.(*textconvFilePatch); ok {
+			r.Options.logf("skipped suggestions for %q: the diff is of the textconv output\n", fps.Path)
+			continue
+		}
+		from, _ := fps.Patch.Files()
+		if from == nil {
+			r.Options.logf("skipped suggestions for %q: the file is new in the fork\n", fps.Path)
+			continue
+		}
+		// the suggestions are the file content, so without the tab expansion of encodePatch
+		var encoded bytes.Buffer
+		if err := diff.NewUnifiedEncoder(&encoded, 3).Encode(FilePatch{filePatch: fps.Patch}); err != nil {
+			return fmt.Errorf("failed to encode patch of %q: %w", fps.Path, err)
+		}
+		_, hunks := splitHunks(encoded.String())
+		for _, h := range hunks {
+			suggestions, skipped := hunkSuggestions(h)
+			for _, line := range skipped {
+				r.Options.logf("skipped suggestion for %q: lines added after base line %d, without replacing any\n", fps.Path, line)
+			}
+			for _, s := range suggestions {
+				if s.From == s.To {
+					tw.printf("%s:%d\n", from.Path(), s.From)
+				} else {
+					tw.printf("%s:%d-%d\n", from.Path(), s.From, s.To)
+				}
+				fence := suggestionFence(s.Lines)
+				tw.printf("%ssuggestion\n", fence)
+				for _, l := range s.Lines {
+					tw.printf("%s\n", l)
+				}
+				tw.printf("%s\n\n", fence)
+			}
+		}
+	}
+	return tw.err
+}
+
+// hunkSuggestions splits an uncolored hunk into its runs of changed lines, and returns the runs that replace
+// base lines as suggestions. The base line numbers after which the other runs only add lines are returned as skipped.
+func hunkSuggestions(h *diffHunk) (out []suggestion, skipped []int) {
+	baseLine := h.BaseStart
+	var current *suggestion
+	flush := func() {
+		if current == nil {
+			return
+		}
+		if current.To < current.From {
+			// no base lines to replace, From is the line after the insertion
+			skipped = append(skipped, current.From-1)
+		} else {
+			out = append(out, *current)
+		}
+		current = nil
+	}
+	for _, line := range strings.Split(h.Text, "\n")[1:] {
+		if line == "" || line[0] == '\\' {
+			continue
+		}
+		switch line[0] {
+		case '-', '+':
+			if current == nil {
+				current = &suggestion{From: baseLine, To: baseLine - 1}
+			}
+			if line[0] == '-' {
+				current.To = baseLine
+				baseLine++
+			} else {
+				current.Lines = append(current.Lines, line[1:])
+			}
+		default:
+			flush()
+			baseLine++
+		}
+	}
+	flush()
+	return out, skipped
+}
+
+// suggestionFence returns a fence of backticks that is longer than any run of backticks at the start of the lines.
+func suggestionFence(lines []string) string {
+	n := 3
+	for _, l := range lines {
+		trimmed := strings.TrimLeft(l, " ")
+		run := len(trimmed) - len(strings.TrimLeft(trimmed, "`"))
+		if run >= n {
+			n = run + 1
+		}
+	}
+	return strings.Repeat("`", n)
+}
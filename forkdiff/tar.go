@@ -0,0 +1,250 @@
+package forkdiff
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/storage/memory"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// TarRepo creates an in-memory git repository, with a commit of the files of the base tar archive at DirBaseRef,
+// and a commit of the files of the fork tar archive at DirForkRef, like DirRepo does for directories.
+// This diffs released artifacts without git history. The archives may be gzip-compressed.
+// If all files of each archive are in a single top-level directory, like "project-1.2/" and "project-1.3/",
+// those directories are the roots, so archives of different versions have the same paths.
+// If either archive has files outside of a single top-level directory, the paths of both are kept as they are.
+// The ".git" directories, and the paths matching the .forkdiffignore file at the root of an archive, are left out.
+func TarRepo(baseTar, forkTar string) (*git.Repository, error) {
+	repo, err := git.Init(memory.NewStorage(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create in-memory repository: %w", err)
+	}
+	baseFiles, err := readTar(baseTar)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read archive %q: %w", baseTar, err)
+	}
+	forkFiles, err := readTar(forkTar)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read archive %q: %w", forkTar, err)
+	}
+	// stripping only one of the archives would make every file a removal and an addition
+	baseTop, baseOk := topDir(baseFiles)
+	forkTop, forkOk := topDir(forkFiles)
+	if baseOk && forkOk {
+		baseFiles = stripTopDir(baseFiles, baseTop)
+		forkFiles = stripTopDir(forkFiles, forkTop)
+	}
+	for _, side := range []struct {
+		archive, ref string
+		files        map[string]tarFile
+	}{{baseTar, DirBaseRef, baseFiles}, {forkTar, DirForkRef, forkFiles}} {
+		if err := commitTar(repo, side.files, side.archive, plumbing.ReferenceName(side.ref)); err != nil {
+			return nil, fmt.Errorf("failed to read archive %q: %w", side.archive, err)
+		}
+	}
+	return repo, nil
+}
+
+// tarFile is a regular file or symlink of a tar archive. The content of a symlink is its target.
+type tarFile struct {
+	mode    filemode.FileMode
+	content []byte
+}
+
+// commitTar commits the files of the archive at the ref, without the ignored paths.
+func commitTar(repo *git.Repository, files map[string]tarFile, archive string, ref plumbing.ReferenceName) error {
+	var ignore []string
+	if f, ok := files[dirIgnoreFile]; ok && f.mode != filemode.Symlink {
+		var err error
+		ignore, err = parseDirIgnore(bytes.NewReader(f.content), dirIgnoreFile)
+		if err != nil {
+			return err
+		}
+	}
+	for p := range files {
+		if tarPathIgnored(ignore, p) {
+			delete(files, p)
+		}
+	}
+	treeHash, err := writeTarTree(repo, files)
+	if err != nil {
+		return err
+	}
+	return commitTree(repo, treeHash, fmt.Sprintf("archive %s\n", filepath.Base(archive)), ref)
+}
+
+// readTar reads the regular files and symlinks of a tar archive, optionally gzip-compressed, by cleaned path.
+// Hard links get the content of the file they link to. Directories are implied by the files, like in git.
+func readTar(archive string) (map[string]tarFile, error) {
+	f, err := os.Open(archive)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	br := bufio.NewReader(f)
+	var r io.Reader = br
+	if magic, err := br.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress: %w", err)
+		}
+		defer gz.Close()
+		r = gz
+	}
+	files := make(map[string]tarFile)
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read entry: %w", err)
+		}
+		p, ok := tarPath(hdr.Name)
+		if !ok {
+			continue
+		}
+		switch hdr.Typeflag {
+		case tar.TypeReg, tar.TypeRegA:
+			content, err := io.ReadAll(tr)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read %q: %w", hdr.Name, err)
+			}
+			mode := filemode.Regular
+			if hdr.Mode&0o111 != 0 {
+				mode = filemode.Executable
+			}
+			files[p] = tarFile{mode: mode, content: content}
+		case tar.TypeSymlink:
+			files[p] = tarFile{mode: filemode.Symlink, content: []byte(hdr.Linkname)}
+		case tar.TypeLink:
+			target, ok := tarPath(hdr.Linkname)
+			if !ok {
+				continue
+			}
+			linked, ok := files[target]
+			if !ok {
+				return nil, fmt.Errorf("hard link %q to %q, which is not earlier in the archive", hdr.Name, hdr.Linkname)
+			}
+			files[p] = linked
+		default:
+			// directories are implied, and devices and the like have no git equivalent
+		}
+	}
+	return files, nil
+}
+
+// tarPath cleans the name of a tar entry to a slash-separated relative path.
+// Entries outside of the archive root, and the archive root itself, are not ok.
+func tarPath(name string) (string, bool) {
+	p := path.Clean(strings.TrimLeft(name, "/"))
+	if p == "." || p == ".." || strings.HasPrefix(p, "../") {
+		return "", false
+	}
+	return p, true
+}
+
+// topDir returns the top-level directory of the paths, if all files are in the same one.
+// It is not ok if there are no files, or files outside of it.
+func topDir(files map[string]tarFile) (string, bool) {
+	top := ""
+	for p := range files {
+		dir, _, ok := strings.Cut(p, "/")
+		if !ok || (top != "" && dir != top) {
+			return "", false
+		}
+		top = dir
+	}
+	return top, top != ""
+}
+
+// stripTopDir removes the top-level directory of the paths, which all files are in, see topDir.
+func stripTopDir(files map[string]tarFile, top string) map[string]tarFile {
+	out := make(map[string]tarFile, len(files))
+	for p, f := range files {
+		out[strings.TrimPrefix(p, top+"/")] = f
+	}
+	return out
+}
+
+// tarPathIgnored returns true if the path, or one of its parent directories, is a ".git" directory
+// or matches an ignore pattern, like the directories that DirRepo does not descend into.
+func tarPathIgnored(ignore []string, p string) bool {
+	parts := strings.Split(p, "/")
+	for i := range parts {
+		if parts[i] == ".git" || ignoredPath(ignore, strings.Join(parts[:i+1], "/")) {
+			return true
+		}
+	}
+	return false
+}
+
+// tarDir is a directory of the files of a tar archive, see writeTarTree.
+type tarDir struct {
+	files map[string]tarFile
+	dirs  map[string]*tarDir
+}
+
+// writeTarTree writes the tree of the files, by slash-separated path. The hash is zero if there are no files.
+func writeTarTree(repo *git.Repository, files map[string]tarFile) (plumbing.Hash, error) {
+	root := &tarDir{}
+	for p, f := range files {
+		dir := root
+		parts := strings.Split(p, "/")
+		for _, name := range parts[:len(parts)-1] {
+			if dir.dirs == nil {
+				dir.dirs = make(map[string]*tarDir)
+			}
+			sub, ok := dir.dirs[name]
+			if !ok {
+				sub = &tarDir{}
+				dir.dirs[name] = sub
+			}
+			dir = sub
+		}
+		if dir.files == nil {
+			dir.files = make(map[string]tarFile)
+		}
+		dir.files[parts[len(parts)-1]] = f
+	}
+	return root.write(repo, "")
+}
+
+// write writes the tree of the directory at the slash-separated path rel.
+func (d *tarDir) write(repo *git.Repository, rel string) (plumbing.Hash, error) {
+	tree := &object.Tree{}
+	for name, f := range d.files {
+		if _, ok := d.dirs[name]; ok {
+			return plumbing.ZeroHash, fmt.Errorf("%q is both a file and a directory", path.Join(rel, name))
+		}
+		h, err := writeBlob(repo, f.content)
+		if err != nil {
+			return plumbing.ZeroHash, err
+		}
+		tree.Entries = append(tree.Entries, object.TreeEntry{Name: name, Mode: f.mode, Hash: h})
+	}
+	for name, sub := range d.dirs {
+		h, err := sub.write(repo, path.Join(rel, name))
+		if err != nil {
+			return plumbing.ZeroHash, err
+		}
+		tree.Entries = append(tree.Entries, object.TreeEntry{Name: name, Mode: filemode.Dir, Hash: h})
+	}
+	if len(tree.Entries) == 0 {
+		return plumbing.ZeroHash, nil
+	}
+	return writeTreeObject(repo, tree, rel)
+}
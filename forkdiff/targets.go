@@ -0,0 +1,110 @@
+package forkdiff
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"sort"
+	"strings"
+)
+
+// TargetTab is the rendered page of one of the fork targets of a combined page, see RenderTargets.
+type TargetTab struct {
+	Name string
+	// ID is the HTML anchor of the tab.
+	ID      string
+	Content template.HTML
+}
+
+// TargetMatrix lists which of the targets change which files.
+type TargetMatrix struct {
+	Targets []string
+	Rows    []TargetMatrixRow
+}
+
+// TargetMatrixRow is a file in the TargetMatrix, with a cell per target. A cell is nil if the target does not change the file.
+type TargetMatrixRow struct {
+	Path  string
+	Cells []*FilePatchStats
+}
+
+// RenderTargets renders the results of multiple fork targets, diffed against the same base,
+// as a single HTML page: a matrix of the files that each target changes, and a tab with the page of each target.
+// The results should have distinct Options.AnchorPrefix values, so the anchors of the tabs do not collide.
+// The title and footer of the combined page are those of the first result.
+func RenderTargets(w io.Writer, results []*Result) error {
+	if len(results) == 0 {
+		return errors.New("no targets to render")
+	}
+	combined := *results[0].Page
+	combined.Description = ""
+	matrix := &TargetMatrix{}
+	cells := make(map[string][]*FilePatchStats)
+	for i, r := range results {
+		if r.Options.Format != "html" {
+			return &ConfigError{Err: errors.New("multiple targets can only be rendered as HTML")}
+		}
+		opts := *r.Options
+		opts.Fragment = true
+		// the combined page is minified as a whole
+		opts.Minify = false
+		fragment := &Result{}
+		*fragment = *r
+		fragment.Options = &opts
+		var buf bytes.Buffer
+		if err := fragment.Render(&buf, r.Page); err != nil {
+			return fmt.Errorf("failed to render target %q: %w", r.Page.Fork.Name, err)
+		}
+		r.truncated = r.truncated || fragment.truncated
+		combined.Targets = append(combined.Targets, TargetTab{
+			Name:    r.Page.Fork.Name,
+			ID:      fmt.Sprintf("target-%d", i+1),
+			Content: template.HTML(buf.String()),
+		})
+		matrix.Targets = append(matrix.Targets, r.Page.Fork.Name)
+		r.Page.Def.collectFiles(func(fps *FilePatchStats) {
+			row, ok := cells[fps.Path]
+			if !ok {
+				row = make([]*FilePatchStats, len(results))
+				cells[fps.Path] = row
+			}
+			if row[i] == nil {
+				row[i] = fps
+			}
+		})
+	}
+	paths := make([]string, 0, len(cells))
+	for k := range cells {
+		paths = append(paths, k)
+	}
+	sort.Slice(paths, func(i, j int) bool {
+		return results[0].lessPath(paths[i], paths[j])
+	})
+	for _, k := range paths {
+		matrix.Rows = append(matrix.Rows, TargetMatrixRow{Path: k, Cells: cells[k]})
+	}
+	combined.TargetMatrix = matrix
+	return results[0].Render(w, &combined)
+}
+
+// ShortRefName returns the name of a ref without the refs/heads/, refs/remotes/ or refs/tags/ prefix.
+func ShortRefName(ref string) string {
+	for _, prefix := range []string{"refs/heads/", "refs/remotes/", "refs/tags/"} {
+		if strings.HasPrefix(ref, prefix) {
+			return strings.TrimPrefix(ref, prefix)
+		}
+	}
+	return ref
+}
+
+// collectFiles calls fn for every file of the definition and its sub-definitions.
+func (fd *ForkDefinition) collectFiles(fn func(fps *FilePatchStats)) {
+	for i := range fd.Files {
+		fn(&fd.Files[i])
+	}
+	for _, sub := range fd.Sub {
+		sub.collectFiles(fn)
+	}
+}
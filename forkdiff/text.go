@@ -0,0 +1,269 @@
+package forkdiff
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+const (
+	ansiBold  = "\x1b[1m"
+	ansiReset = "\x1b[m"
+)
+
+// RenderText renders the given page as plain-text report to w: the section headings, descriptions,
+// file lists with stats, and the unified diffs, with ANSI colors if Options.Color is set.
+func (r *Result) RenderText(w io.Writer, p *Page) error {
+	return r.renderText(&sizeLimit{w: w, max: r.Options.MaxTotalSize}, p)
+}
+
+func (r *Result) renderText(out *sizeLimit, p *Page) error {
+	tw := &textWriter{w: out, out: out, page: p, color: r.Options.Color}
+	tw.heading(p.Title, "=")
+	if p.IndexLink != "" {
+		tw.printf("index: %s\n\n", p.IndexLink)
+	} else if p.Description != "" {
+		description, err := r.expandTemplate(p.Description)
+		if err != nil {
+			return err
+		}
+		tw.printf("%s\n\n", strings.TrimSpace(description))
+	}
+	if d := p.Divergence; d != nil && p.IndexLink == "" {
+		tw.printf("%s is %d commit%s ahead and %d commit%s behind %s", p.Fork.Name, d.Ahead, plural(d.Ahead), d.Behind, plural(d.Behind), p.Base.Name)
+		if d.MergeBase != nil {
+			tw.printf(", since the merge base %s (%s)\n\n", d.MergeBase.Hash.String()[:7], d.MergeBase.Committer.When.Format("2006-01-02"))
+		} else {
+			tw.printf(", with no common history\n\n")
+		}
+	}
+	if len(p.Contributors) > 0 && p.IndexLink == "" {
+		tw.printf("%d contributor%s:\n", len(p.Contributors), plural(len(p.Contributors)))
+		for _, c := range p.Contributors {
+			tw.printf("  %s", c.Name)
+			if c.Email != "" {
+				tw.printf(" <%s>", c.Email)
+			}
+			tw.printf(": %d commit%s", c.Commits, plural(c.Commits))
+			if c.CoAuthored > 0 {
+				tw.printf(", co-authored %d", c.CoAuthored)
+			}
+			tw.printf("\n")
+		}
+		tw.printf("\n")
+	}
+	if u := p.Upstream; u != nil && p.IndexLink == "" {
+		n := u.FileCount()
+		tw.printf("upstream %s is %d commit%s ahead of %s, and changed %d file%s: %d also changed by the fork, %d not touched by the fork\n",
+			u.Commit.Hash.String()[:7], u.Commits, plural(u.Commits), p.Base.Name, n, plural(n), u.Conflicts, u.UpstreamOnly)
+		for _, s := range u.Sections {
+			title := s.Title
+			if title == "" {
+				title = "Untitled section"
+			}
+			tw.printf("  %s\n", title)
+			for _, f := range s.Files {
+				marker := " "
+				if f.Fork {
+					marker = "!"
+				}
+				tw.printf("  %s   %s (+%d -%d)\n", marker, f.Path, f.LinesAdded, f.LinesDeleted)
+			}
+		}
+		tw.printf("\n")
+	}
+	if r.Options.GroupBy == "commit" {
+		for _, c := range p.Commits {
+			tw.printf("commit %s\nAuthor: %s <%s>\nDate:   %s\n", c.Commit.Hash, c.Commit.Author.Name, c.Commit.Author.Email, c.Commit.Author.When.Format(time.RFC1123Z))
+			if c.Merge {
+				tw.printf("Merge, diffed against the first parent\n")
+			}
+			tw.printf("\n")
+			if c.Message != "" {
+				tw.printf("    %s\n\n", strings.ReplaceAll(c.Message, "\n", "\n    "))
+			}
+			if len(c.Trailers) > 0 {
+				for _, t := range c.Trailers {
+					tw.printf("    %s: %s\n", t.Key, t.Value)
+				}
+				tw.printf("\n")
+			}
+			if c.Note != "" {
+				tw.printf("Notes:\n    %s\n\n", strings.ReplaceAll(c.Note, "\n", "\n    "))
+			}
+			if err := r.renderTextDefinition(tw, c.Def); err != nil {
+				return err
+			}
+		}
+	} else if err := r.renderTextDefinition(tw, p.Def); err != nil {
+		return err
+	}
+	for _, s := range p.Split {
+		tw.printf("- %s: %d files (+%d -%d), see %s\n", s.Def.Title, s.Def.FileCount, s.Def.LinesAdded, s.Def.LinesDeleted, s.Link)
+	}
+	if p.Ignored != nil {
+		if err := r.renderTextDefinition(tw, p.Ignored); err != nil {
+			return err
+		}
+	}
+	if p.Footer != "" {
+		footer, err := r.expandTemplate(p.Footer)
+		if err != nil {
+			return err
+		}
+		tw.printf("--\n%s\n", strings.TrimSpace(footer))
+	}
+	return tw.err
+}
+
+func (r *Result) renderTextDefinition(tw *textWriter, fd *ForkDefinition) error {
+	title := fd.Title
+	if title == "" {
+		title = "(untitled)"
+	}
+	if fd.Auto {
+		title += " (auto-generated)"
+	}
+	tw.heading(fmt.Sprintf("%s %s: %d files (+%d -%d)", strings.Repeat("#", fd.Level), title, fd.FileCount, fd.LinesAdded, fd.LinesDeleted), "")
+	if r.Options.ShowGlobs {
+		if patterns := tw.page.sectionPatterns(fd); patterns != "" {
+			tw.printf("(%s)\n\n", patterns)
+		}
+	}
+	if shown := fd.ShownDescription(); shown != "" {
+		description, err := r.expandTemplate(shown)
+		if err != nil {
+			return err
+		}
+		tw.printf("%s\n\n", strings.TrimSpace(description))
+	}
+	for i := range fd.Files {
+		fps := &fd.Files[i]
+		tw.printf("%s %s", fps.Path, textFileStat(fps))
+		if changeKind(fps.Patch) == "delete" {
+			tw.printf(" (removed in fork)")
+		}
+		if fps.NewlineAtEOF != "" {
+			tw.printf(" (newline at end of file %s)", fps.NewlineAtEOF)
+		}
+		if fps.BOM != "" {
+			tw.printf(" (byte order mark %s)", fps.BOM)
+		}
+		if fps.ChangedSince {
+			tw.printf(" (changed since %s)", r.since.Commit.Hash.String()[:7])
+		}
+		if c := fps.LastCommit; c != nil {
+			subject, _, _ := strings.Cut(c.Message, "\n")
+			tw.printf(" (last changed in %s %s)", c.Hash.String()[:7], subject)
+		}
+		tw.printf("\n")
+		if r.Options.Mode == "summary" || fps.Listed {
+			continue
+		}
+		if fps.Submodule != nil || fps.Symlink != nil || fps.LFS != nil || fps.TooLarge {
+			continue
+		}
+		encoded, err := r.encodePatch(fps, r.Options.Color)
+		if err != nil {
+			return err
+		}
+		if !tw.out.allow(len(encoded)) {
+			tw.printf("%s\n", maxTotalSizeNote)
+			continue
+		}
+		tw.printf("%s\n", strings.TrimSuffix(encoded, "\n"))
+	}
+	if len(fd.Files) > 0 {
+		tw.printf("\n")
+	}
+	for _, sub := range fd.Sub {
+		if err := r.renderTextDefinition(tw, sub); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sectionPatterns describes the patterns that claim the files of a section of the page, for Options.ShowGlobs:
+// the globs and dirs of the section, or the ignore globs of the page for the ignored changes.
+// It is empty if there are none, like for the sections of the unclaimed files.
+func (p *Page) sectionPatterns(fd *ForkDefinition) string {
+	var out []string
+	if fd == p.Ignored {
+		if len(p.Ignore) > 0 {
+			out = append(out, "ignore: "+strings.Join(p.Ignore, ", "))
+		}
+	} else {
+		if len(fd.Globs) > 0 {
+			out = append(out, "globs: "+strings.Join(fd.Globs, ", "))
+		}
+		if len(fd.Dirs) > 0 {
+			out = append(out, "dirs: "+strings.Join(fd.Dirs, ", "))
+		}
+	}
+	return strings.Join(out, "; ")
+}
+
+// textFileStat describes the change of a file for the plain-text report.
+func textFileStat(fps *FilePatchStats) string {
+	switch {
+	case fps.Submodule != nil:
+		return fmt.Sprintf("(submodule %s -> %s)", orNone(fps.Submodule.From), orNone(fps.Submodule.To))
+	case fps.Symlink != nil:
+		return fmt.Sprintf("(symlink %s -> %s)", orNone(fps.Symlink.From), orNone(fps.Symlink.To))
+	case fps.LFS != nil:
+		return fmt.Sprintf("(LFS object %s -> %s)", lfsObjectText(fps.LFS.From), lfsObjectText(fps.LFS.To))
+	case fps.TooLarge:
+		return fmt.Sprintf("(file too large, %d bytes, diff omitted)", fps.Size)
+	case fps.Binary:
+		return "(binary file)"
+	default:
+		return fmt.Sprintf("(+%d -%d)", fps.LinesAdded, fps.LinesDeleted)
+	}
+}
+
+// lfsObjectText describes an LFS object of textFileStat, by its ID and size.
+func lfsObjectText(o *LFSObject) string {
+	if o == nil {
+		return "(none)"
+	}
+	return fmt.Sprintf("%s (%d bytes)", o.OID, o.Size)
+}
+
+func orNone(s string) string {
+	if s == "" {
+		return "(none)"
+	}
+	return s
+}
+
+// textWriter writes the plain-text report, and keeps the first write error.
+type textWriter struct {
+	w   io.Writer
+	out *sizeLimit
+	// page is the page that is rendered
+	page  *Page
+	color bool
+	err   error
+}
+
+func (tw *textWriter) printf(format string, args ...any) {
+	if tw.err != nil {
+		return
+	}
+	_, tw.err = fmt.Fprintf(tw.w, format, args...)
+}
+
+// heading writes a bold line, underlined with the given character if not empty.
+func (tw *textWriter) heading(text string, underline string) {
+	if tw.color {
+		tw.printf("%s%s%s\n", ansiBold, text, ansiReset)
+	} else {
+		tw.printf("%s\n", text)
+	}
+	if underline != "" {
+		tw.printf("%s\n", strings.Repeat(underline, len(text)))
+	}
+	tw.printf("\n")
+}
@@ -0,0 +1,219 @@
+package forkdiff
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/format/diff"
+	utildiff "github.com/go-git/go-git/v5/utils/diff"
+	"github.com/sergi/go-diff/diffmatchpatch"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// TextconvFilter converts the files that match the glob to a text representation before diffing them,
+// like the diff.textconv setting of git. The command is run with the shell, with the path of a temporary file
+// with the contents as argument, and writes the text to stdout. See Options.Textconv.
+type TextconvFilter struct {
+	Glob    string `yaml:"glob"`
+	Command string `yaml:"command"`
+}
+
+// textconvTimeout is the maximum duration of a single textconv command.
+const textconvTimeout = time.Minute
+
+// checkTextconv returns an error if any of the textconv filters has an invalid glob or no command.
+func (p *Page) checkTextconv() error {
+	for i, f := range p.Textconv {
+		if _, err := filepath.Match(f.Glob, ""); err != nil {
+			return fmt.Errorf("invalid glob %d (%q) of textconv filter: %w", i, f.Glob, err)
+		}
+		if strings.TrimSpace(f.Command) == "" {
+			return fmt.Errorf("textconv filter %d (%q) has no command", i, f.Glob)
+		}
+	}
+	return nil
+}
+
+// textconvCommand returns the command of the first textconv filter that matches the path, or an empty string.
+func (p *Page) textconvCommand(name string) string {
+	for _, f := range p.Textconv {
+		if ok, _ := matchGlob(f.Glob, name, p.GlobCaseInsensitive); ok {
+			return f.Command
+		}
+	}
+	return ""
+}
+
+// textconv converts blobs with the textconv filters of a page, and caches the output by command and blob.
+type textconv struct {
+	repo  *git.Repository
+	page  *Page
+	cache map[string]string
+}
+
+// newTextconv returns the converter of the options, or nil if the page has no textconv filters or they are not enabled.
+func newTextconv(opts *Options) *textconv {
+	if len(opts.Page.Textconv) == 0 {
+		return nil
+	}
+	if !opts.Textconv {
+		opts.logf("not applying the textconv filters of the fork page definition: running their commands is not enabled\n")
+		return nil
+	}
+	return &textconv{repo: opts.Repo, page: opts.Page, cache: make(map[string]string)}
+}
+
+// convert replaces the file patches of the files that match a textconv filter on either side
+// with a diff of their converted contents. Submodules, symlinks, LFS pointer files and files that are too large to diff
+// are left as they are.
+func (t *textconv) convert(ctx context.Context, patchByName map[string]diff.FilePatch) error {
+	for k, fp := range patchByName {
+		switch fp.(type) {
+		case *submoduleFilePatch, *symlinkFilePatch, *omittedFilePatch, *lfsFilePatch:
+			continue
+		}
+		from, to := fp.Files()
+		command := ""
+		if to != nil {
+			command = t.page.textconvCommand(to.Path())
+		}
+		if command == "" && from != nil {
+			command = t.page.textconvCommand(from.Path())
+		}
+		if command == "" {
+			continue
+		}
+		converted, err := t.patch(ctx, command, from, to)
+		if err != nil {
+			return fmt.Errorf("failed to convert %q with textconv command %q: %w", k, command, err)
+		}
+		patchByName[k] = converted
+	}
+	return nil
+}
+
+// patch diffs the converted contents of the two sides of a file, either of which may be nil.
+func (t *textconv) patch(ctx context.Context, command string, from, to diff.File) (*textconvFilePatch, error) {
+	var fromText, toText string
+	var err error
+	if from != nil {
+		if fromText, err = t.run(ctx, command, from); err != nil {
+			return nil, err
+		}
+	}
+	if to != nil {
+		if toText, err = t.run(ctx, command, to); err != nil {
+			return nil, err
+		}
+	}
+	out := &textconvFilePatch{from: from, to: to}
+	for _, d := range utildiff.Do(fromText, toText) {
+		op := diff.Equal
+		switch d.Type {
+		case diffmatchpatch.DiffDelete:
+			op = diff.Delete
+		case diffmatchpatch.DiffInsert:
+			op = diff.Add
+		}
+		out.chunks = append(out.chunks, textconvChunk{content: d.Text, op: op})
+	}
+	return out, nil
+}
+
+// run runs the command on the contents of the blob of the file, in a temporary file with the same extension,
+// since converters often detect the format by extension.
+func (t *textconv) run(ctx context.Context, command string, f diff.File) (string, error) {
+	key := command + "\x00" + f.Hash().String()
+	if out, ok := t.cache[key]; ok {
+		return out, nil
+	}
+	content, err := t.blob(f.Hash())
+	if err != nil {
+		return "", fmt.Errorf("failed to read blob %s: %w", f.Hash(), err)
+	}
+	tmp, err := os.CreateTemp("", "forkdiff-textconv-*"+path.Ext(f.Path()))
+	if err != nil {
+		return "", fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(content); err != nil {
+		_ = tmp.Close()
+		return "", fmt.Errorf("failed to write temporary file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return "", fmt.Errorf("failed to write temporary file: %w", err)
+	}
+	ctx, cancel := context.WithTimeout(ctx, textconvTimeout)
+	defer cancel()
+	// like git, the path is appended to the command, which the shell interprets
+	cmd := exec.CommandContext(ctx, "sh", "-c", command+` "$1"`, "textconv", tmp.Name())
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return "", fmt.Errorf("timed out after %s", textconvTimeout)
+		}
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("%w: %s", err, msg)
+		}
+		return "", err
+	}
+	t.cache[key] = stdout.String()
+	return stdout.String(), nil
+}
+
+func (t *textconv) blob(h plumbing.Hash) ([]byte, error) {
+	blob, err := t.repo.BlobObject(h)
+	if err != nil {
+		return nil, err
+	}
+	r, err := blob.Reader()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+// textconvFilePatch is a file patch of the converted contents of a file, see TextconvFilter.
+// The line numbers of the chunks are those of the converted text, not of the files.
+type textconvFilePatch struct {
+	from, to diff.File
+	chunks   []diff.Chunk
+}
+
+var _ diff.FilePatch = (*textconvFilePatch)(nil)
+
+func (p *textconvFilePatch) IsBinary() bool {
+	return false
+}
+
+func (p *textconvFilePatch) Files() (from, to diff.File) {
+	return p.from, p.to
+}
+
+func (p *textconvFilePatch) Chunks() []diff.Chunk {
+	return p.chunks
+}
+
+type textconvChunk struct {
+	content string
+	op      diff.Operation
+}
+
+func (c textconvChunk) Content() string {
+	return c.content
+}
+
+func (c textconvChunk) Type() diff.Operation {
+	return c.op
+}
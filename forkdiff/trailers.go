@@ -0,0 +1,112 @@
+package forkdiff
+
+import (
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"net/mail"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Trailer is a "Key: value" line at the end of a commit message, like "Signed-off-by: A U Thor <author@example.com>".
+type Trailer struct {
+	Key   string
+	Value string
+}
+
+// trailerRegexp matches the first line of a trailer.
+var trailerRegexp = regexp.MustCompile(`^([A-Za-z0-9][A-Za-z0-9-]*): (.*)$`)
+
+// parseTrailers splits the trailers off a commit message without the subject line: the last paragraph,
+// if every line of it is a trailer, or a continuation of one, indented with whitespace like in git.
+// The message is returned as-is, without surrounding whitespace and with no trailers,
+// if the last paragraph is not all trailers.
+func parseTrailers(message string) (body string, trailers []Trailer) {
+	message = strings.TrimSpace(message)
+	start := strings.LastIndex(message, "\n\n")
+	if start < 0 {
+		// a message without body may be made of trailers only
+		start = -2
+	}
+	for _, line := range strings.Split(message[start+2:], "\n") {
+		if m := trailerRegexp.FindStringSubmatch(line); m != nil {
+			trailers = append(trailers, Trailer{Key: m[1], Value: strings.TrimSpace(m[2])})
+			continue
+		}
+		if len(trailers) > 0 && (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) {
+			last := &trailers[len(trailers)-1]
+			last.Value += " " + strings.TrimSpace(line)
+			continue
+		}
+		return message, nil
+	}
+	if start < 0 {
+		return "", trailers
+	}
+	return strings.TrimSpace(message[:start]), trailers
+}
+
+// Contributor is a person who authored or co-authored fork commits, see Options.Contributors.
+type Contributor struct {
+	Name  string
+	Email string
+	// Commits is the number of commits authored by the contributor.
+	Commits int
+	// CoAuthored is the number of commits of others that the contributor is a "Co-authored-by" trailer of.
+	CoAuthored int
+}
+
+// contributors returns the authors and co-authors of the commits, deduplicated by e-mail address, case-insensitively,
+// or by name if there is no address. The name is the first that the contributor appears with.
+// A co-author is counted once per commit, and not at all in the commits that they authored.
+// The most active contributors are first.
+func contributors(commits []*object.Commit) []Contributor {
+	byKey := make(map[string]*Contributor)
+	var order []string
+	get := func(name, email string) (string, *Contributor) {
+		key := strings.ToLower(email)
+		if key == "" {
+			key = "name:" + name
+		}
+		c, ok := byKey[key]
+		if !ok {
+			c = &Contributor{Name: name, Email: email}
+			byKey[key] = c
+			order = append(order, key)
+		}
+		return key, c
+	}
+	for _, commit := range commits {
+		authorKey, author := get(commit.Author.Name, commit.Author.Email)
+		author.Commits++
+		_, message, _ := strings.Cut(commit.Message, "\n")
+		_, trailers := parseTrailers(message)
+		seen := map[string]bool{authorKey: true}
+		for _, t := range trailers {
+			if !strings.EqualFold(t.Key, "Co-authored-by") {
+				continue
+			}
+			name, email := t.Value, ""
+			if addr, err := mail.ParseAddress(t.Value); err == nil {
+				name, email = addr.Name, addr.Address
+				if name == "" {
+					name = email
+				}
+			}
+			key, c := get(name, email)
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			c.CoAuthored++
+		}
+	}
+	out := make([]Contributor, 0, len(order))
+	for _, key := range order {
+		out = append(out, *byKey[key])
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		return out[i].Commits+out[i].CoAuthored > out[j].Commits+out[j].CoAuthored
+	})
+	return out
+}
@@ -0,0 +1,204 @@
+package forkdiff
+
+import (
+	"errors"
+	"fmt"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"io"
+	"path"
+	"sort"
+	"strings"
+)
+
+const (
+	ansiGreen = "\x1b[32m"
+	ansiRed   = "\x1b[31m"
+)
+
+// treeDirs returns the number of files under every directory of the tree, at any depth, by directory path.
+// The directories are derived from the paths of the tree entries, so a directory only exists if it has entries.
+func treeDirs(tree *object.Tree) (map[string]int, error) {
+	dirs := make(map[string]int)
+	walker := object.NewTreeWalker(tree, true, nil)
+	defer walker.Close()
+	for {
+		name, entry, err := walker.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if entry.Mode == filemode.Dir {
+			if _, ok := dirs[name]; !ok {
+				dirs[name] = 0
+			}
+			continue
+		}
+		for dir := path.Dir(name); dir != "."; dir = path.Dir(dir) {
+			dirs[dir]++
+		}
+	}
+	return dirs, nil
+}
+
+// dirRename is a directory of the base that the fork moved, with the number of renamed files that moved along.
+type dirRename struct {
+	From, To string
+	Files    int
+}
+
+// treeDiff compares the directories of the base and fork trees. Of the directories that only exist on one side,
+// a removed directory is renamed to an added one if most of the files under it are renamed to files under that one.
+// Directories within a renamed, added or removed directory that are changed in the same way are left out.
+func (r *Result) treeDiff() (renamed []dirRename, added, removed []string, baseDirs, forkDirs map[string]int, err error) {
+	baseDirs, err = treeDirs(r.BaseTree)
+	if err != nil {
+		return nil, nil, nil, nil, nil, fmt.Errorf("failed to walk base tree: %w", err)
+	}
+	forkDirs, err = treeDirs(r.ForkTree)
+	if err != nil {
+		return nil, nil, nil, nil, nil, fmt.Errorf("failed to walk fork tree: %w", err)
+	}
+	isRemoved := func(dir string) bool {
+		_, inBase := baseDirs[dir]
+		_, inFork := forkDirs[dir]
+		return inBase && !inFork
+	}
+	isAdded := func(dir string) bool {
+		_, inBase := baseDirs[dir]
+		_, inFork := forkDirs[dir]
+		return inFork && !inBase
+	}
+	// every file rename votes for its directory, and for the parents with the same names, as a directory rename
+	votes := make(map[dirRename]int)
+	for _, fp := range r.patchByName {
+		from, to := fp.Files()
+		if from == nil || to == nil || from.Path() == to.Path() {
+			continue
+		}
+		fromDir, toDir := path.Dir(from.Path()), path.Dir(to.Path())
+		for fromDir != "." && toDir != "." && isRemoved(fromDir) && isAdded(toDir) {
+			votes[dirRename{From: fromDir, To: toDir}]++
+			if path.Base(fromDir) != path.Base(toDir) {
+				break
+			}
+			fromDir, toDir = path.Dir(fromDir), path.Dir(toDir)
+		}
+	}
+	candidates := make([]dirRename, 0, len(votes))
+	for k, n := range votes {
+		candidates = append(candidates, dirRename{From: k.From, To: k.To, Files: n})
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].Files != candidates[j].Files {
+			return candidates[i].Files > candidates[j].Files
+		}
+		if candidates[i].From != candidates[j].From {
+			return candidates[i].From < candidates[j].From
+		}
+		return candidates[i].To < candidates[j].To
+	})
+	renamedFrom := make(map[string]string)
+	renamedTo := make(map[string]struct{})
+	for _, c := range candidates {
+		if _, ok := renamedFrom[c.From]; ok {
+			continue
+		}
+		if _, ok := renamedTo[c.To]; ok {
+			continue
+		}
+		if c.Files*2 < baseDirs[c.From] {
+			continue
+		}
+		renamedFrom[c.From] = c.To
+		renamedTo[c.To] = struct{}{}
+		renamed = append(renamed, c)
+	}
+	// within a renamed directory, the directories that moved along with it are implied
+	impliedRename := func(c dirRename) bool {
+		for from, to := path.Dir(c.From), path.Dir(c.To); from != "." && to != "."; from, to = path.Dir(from), path.Dir(to) {
+			if renamedFrom[from] == to {
+				return strings.TrimPrefix(c.From, from) == strings.TrimPrefix(c.To, to)
+			}
+		}
+		return false
+	}
+	kept := renamed[:0]
+	for _, c := range renamed {
+		if !impliedRename(c) {
+			kept = append(kept, c)
+		}
+	}
+	renamed = kept
+	sort.Slice(renamed, func(i, j int) bool {
+		return renamed[i].From < renamed[j].From
+	})
+	// within an added or removed directory, the directories are added or removed too
+	topmost := func(dir string, changed func(string) bool) bool {
+		for parent := path.Dir(dir); parent != "."; parent = path.Dir(parent) {
+			if changed(parent) {
+				return false
+			}
+		}
+		return true
+	}
+	for dir := range forkDirs {
+		if _, ok := renamedTo[dir]; !ok && isAdded(dir) && topmost(dir, isAdded) {
+			added = append(added, dir)
+		}
+	}
+	for dir := range baseDirs {
+		if _, ok := renamedFrom[dir]; !ok && isRemoved(dir) && topmost(dir, isRemoved) {
+			removed = append(removed, dir)
+		}
+	}
+	sort.Strings(added)
+	sort.Strings(removed)
+	return renamed, added, removed, baseDirs, forkDirs, nil
+}
+
+// renderTreeDiff writes the directory structure changes of the fork: the directories that it renamed,
+// added and removed, compared to the base, with the number of files under them. File contents are not compared.
+func (r *Result) renderTreeDiff(out *sizeLimit, p *Page) error {
+	renamed, added, removed, baseDirs, forkDirs, err := r.treeDiff()
+	if err != nil {
+		return err
+	}
+	tw := &textWriter{w: out, out: out, color: r.Options.Color}
+	tw.heading(fmt.Sprintf("Directory changes of %s compared to %s", p.Fork.Name, p.Base.Name), "=")
+	if len(renamed) == 0 && len(added) == 0 && len(removed) == 0 {
+		tw.printf("No directories were added, removed or renamed.\n")
+		return tw.err
+	}
+	line := func(color, format string, args ...any) {
+		if tw.color && color != "" {
+			tw.printf("%s%s%s\n", color, fmt.Sprintf(format, args...), ansiReset)
+		} else {
+			tw.printf(format+"\n", args...)
+		}
+	}
+	if len(renamed) > 0 {
+		tw.heading("Renamed", "-")
+		for _, c := range renamed {
+			line("", "  %s/ -> %s/ (%d of %d file%s moved along)", c.From, c.To, c.Files, baseDirs[c.From], plural(baseDirs[c.From]))
+		}
+		tw.printf("\n")
+	}
+	if len(added) > 0 {
+		tw.heading("Added", "-")
+		for _, dir := range added {
+			line(ansiGreen, "+ %s/ (%d file%s)", dir, forkDirs[dir], plural(forkDirs[dir]))
+		}
+		tw.printf("\n")
+	}
+	if len(removed) > 0 {
+		tw.heading("Removed", "-")
+		for _, dir := range removed {
+			line(ansiRed, "- %s/ (%d file%s)", dir, baseDirs[dir], plural(baseDirs[dir]))
+		}
+		tw.printf("\n")
+	}
+	return tw.err
+}
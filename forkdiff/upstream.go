@@ -0,0 +1,157 @@
+package forkdiff
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/format/diff"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"sort"
+)
+
+// UpstreamChanges are the changes between the base and a newer upstream commit, that the fork did not merge yet,
+// compared to the changes of the fork, see Options.Upstream.
+type UpstreamChanges struct {
+	Commit *object.Commit
+	// Commits is the number of upstream commits that are not in the base.
+	Commits int
+	// Sections are the files that changed upstream, grouped by the section of the page definition that claims them,
+	// in the order of the definition. The files that no section claims are in a last section without ID.
+	Sections []UpstreamSection
+	// Conflicts is the number of files that changed both upstream and in the fork, which may conflict when merging.
+	Conflicts int
+	// UpstreamOnly is the number of files that only changed upstream, and merge cleanly.
+	UpstreamOnly int
+	// ForkOnly are the files that the fork changed, but upstream did not, by path.
+	ForkOnly []string
+}
+
+// FileCount returns the number of files that changed upstream, excluding the ignored files.
+func (u *UpstreamChanges) FileCount() int {
+	return u.Conflicts + u.UpstreamOnly
+}
+
+// UpstreamSection are the upstream changes of the files that are claimed by a section.
+type UpstreamSection struct {
+	Title string
+	// ID is the anchor of the section on the page, empty for the files that no section claims.
+	ID    string
+	Files []UpstreamFile
+}
+
+// UpstreamFile is a file that changed upstream.
+type UpstreamFile struct {
+	Path         string
+	LinesAdded   int
+	LinesDeleted int
+	// Fork is true if the fork changed the file too, so merging upstream may conflict.
+	Fork bool
+}
+
+// compareUpstream computes the changes between the base tree and the tree of the upstream commit,
+// and which of them the fork changed too. Files that match the ignore globs of the page are left out.
+func (r *Result) compareUpstream(upstream string) (*UpstreamChanges, error) {
+	h, err := r.Options.Repo.ResolveRevision(plumbing.Revision(upstream))
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve %q: %w", upstream, err)
+	}
+	commit, err := r.Options.Repo.CommitObject(*h)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open commit %s: %w", h, err)
+	}
+	tree, err := commit.Tree()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open tree of commit %s: %w", h, err)
+	}
+	patches, err := ComputePatches(context.Background(), r.BaseTree, tree, r.Options.MaxFileSize, r.Options.RenameThreshold)
+	if err != nil {
+		return nil, err
+	}
+	commits, err := forkCommits(r.BaseCommit, commit)
+	if err != nil {
+		return nil, err
+	}
+	out := &UpstreamChanges{Commit: commit, Commits: len(commits)}
+
+	// the paths on both sides of a rename count as changed
+	forkChanged := make(map[string]struct{})
+	for k, fp := range r.patchByName {
+		forkChanged[k] = struct{}{}
+		if from, _ := fp.Files(); from != nil {
+			forkChanged[from.Path()] = struct{}{}
+		}
+	}
+	upstreamChanged := make(map[string]struct{})
+	var paths []string
+	for _, k := range sortedPatchNames(patches.ByName) {
+		fp := patches.ByName[k]
+		upstreamChanged[k] = struct{}{}
+		if from, _ := fp.Files(); from != nil {
+			upstreamChanged[from.Path()] = struct{}{}
+		}
+		ignored, err := r.Page.isIgnored(k)
+		if err != nil {
+			return nil, err
+		}
+		if !ignored {
+			paths = append(paths, k)
+		}
+	}
+
+	// the sections claim the upstream files like the fork files; a file of multiple sections is listed in the first
+	claims := make(map[string][]*ForkDefinition)
+	if err := r.Page.Def.claimFiles(paths, claims, true, r.Page.GlobCaseInsensitive); err != nil {
+		return nil, fmt.Errorf("failed to assign upstream files to sections: %w", err)
+	}
+	bySection := make(map[*ForkDefinition][]UpstreamFile)
+	var unclaimed []UpstreamFile
+	for _, k := range paths {
+		fp := patches.ByName[k]
+		f := UpstreamFile{
+			Path:         k,
+			LinesAdded:   countOperations(fp.Chunks(), diff.Add),
+			LinesDeleted: countOperations(fp.Chunks(), diff.Delete),
+		}
+		_, f.Fork = forkChanged[k]
+		if from, _ := fp.Files(); from != nil && !f.Fork {
+			_, f.Fork = forkChanged[from.Path()]
+		}
+		if f.Fork {
+			out.Conflicts++
+		} else {
+			out.UpstreamOnly++
+		}
+		if owners := claims[k]; len(owners) > 0 {
+			bySection[owners[0]] = append(bySection[owners[0]], f)
+		} else {
+			unclaimed = append(unclaimed, f)
+		}
+	}
+	var walk func(fd *ForkDefinition)
+	walk = func(fd *ForkDefinition) {
+		if files := bySection[fd]; len(files) > 0 {
+			out.Sections = append(out.Sections, UpstreamSection{Title: fd.Title, ID: fd.ID, Files: files})
+		}
+		for _, sub := range fd.Sub {
+			walk(sub)
+		}
+	}
+	walk(r.Page.Def)
+	if len(unclaimed) > 0 {
+		out.Sections = append(out.Sections, UpstreamSection{Title: "Not in any section", Files: unclaimed})
+	}
+
+	for k := range r.patchByName {
+		if _, ok := upstreamChanged[k]; ok {
+			continue
+		}
+		if from, _ := r.patchByName[k].Files(); from != nil {
+			if _, ok := upstreamChanged[from.Path()]; ok {
+				continue
+			}
+		}
+		out.ForkOnly = append(out.ForkOnly, k)
+	}
+	sort.Strings(out.ForkOnly)
+	return out, nil
+}
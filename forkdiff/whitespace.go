@@ -0,0 +1,108 @@
+package forkdiff
+
+import (
+	"fmt"
+	"html"
+	"strings"
+	"unicode"
+)
+
+// markWhitespace makes the whitespace of the added and removed lines of a rendered diff visible, see Options.ShowWhitespace.
+// The content of such a line, after the diff marker, is rendered again from the encoded line, within the tags that
+// color the whole line, since the rendered text does not keep the whitespace exactly: carriage returns are dropped,
+// and runs of spaces are turned into no-break spaces. The trailing whitespace of the lines is marked as well,
+// except for the lines that truncateLines truncated, by line index in rests, since their end is not the end of the line.
+// If the rendered lines do not correspond to the lines of the encoded diff, the rendered diff is returned as-is.
+func markWhitespace(encoded string, rendered []byte, inHunk bool, rests map[int]string) []byte {
+	lines := strings.Split(strings.TrimSuffix(encoded, "\n"), "\n")
+	trimmed := strings.TrimSuffix(string(rendered), "\n")
+	renderedLines := strings.Split(trimmed, "\n")
+	if len(lines) != len(renderedLines) {
+		return rendered
+	}
+	for i, line := range lines {
+		plain := ansiEscapeRegexp.ReplaceAllString(line, "")
+		if class := diffLineClass(plain, &inHunk); class != "diff-add" && class != "diff-delete" {
+			continue
+		}
+		// the line is the text of the line, only within the tags that color it
+		r := renderedLines[i]
+		start := 0
+		for strings.HasPrefix(r[start:], "<") {
+			end := strings.IndexByte(r[start:], '>')
+			if end < 0 {
+				break
+			}
+			start += end + 1
+		}
+		end := len(r)
+		for strings.HasSuffix(r[:end], ">") {
+			open := strings.LastIndexByte(r[:end], '<')
+			if open < start {
+				break
+			}
+			end = open
+		}
+		if strings.ContainsAny(r[start:end], "<>") || !strings.HasPrefix(r[start:end], plain[:1]) {
+			continue
+		}
+		_, truncated := rests[i]
+		renderedLines[i] = r[:start] + html.EscapeString(plain[:1]) + whitespaceHTML(plain[1:], !truncated) + r[end:]
+	}
+	out := strings.Join(renderedLines, "\n")
+	if len(trimmed) < len(rendered) {
+		out += "\n"
+	}
+	return []byte(out)
+}
+
+// whitespaceHTML escapes the content of a diff line, with the whitespace in spans that show it:
+// "ws-space" for runs of spaces, "ws-tab" for tabs, and "ws-other" for other whitespace, like no-break spaces.
+// Carriage returns are shown as a symbol, since they take no space. With trailing, the whitespace at the end
+// of the content is wrapped in a "ws-trailing" span too, except for the carriage return of a CRLF line ending.
+func whitespaceHTML(content string, trailing bool) string {
+	body, rest, cr := content, "", ""
+	if trailing {
+		if strings.HasSuffix(body, "\r") {
+			body, cr = body[:len(body)-1], "\r"
+		}
+		trimmed := strings.TrimRightFunc(body, unicode.IsSpace)
+		body, rest = trimmed, body[len(trimmed):]
+	}
+	var out strings.Builder
+	write := func(s string) {
+		spaces := 0
+		flush := func() {
+			if spaces > 0 {
+				out.WriteString(`<span class="ws-space">` + strings.Repeat(" ", spaces) + "</span>")
+				spaces = 0
+			}
+		}
+		for _, c := range s {
+			if c == ' ' {
+				spaces++
+				continue
+			}
+			flush()
+			switch {
+			case c == '\t':
+				out.WriteString(`<span class="ws-tab">` + "\t" + "</span>")
+			case c == '\r':
+				out.WriteString(`<span class="ws-other" title="carriage return">␍</span>`)
+			case unicode.IsSpace(c):
+				out.WriteString(fmt.Sprintf(`<span class="ws-other" title="U+%04X">%c</span>`, c, c))
+			default:
+				out.WriteString(html.EscapeString(string(c)))
+			}
+		}
+		flush()
+	}
+	write(body)
+	if rest != "" {
+		out.WriteString(`<span class="ws-trailing" title="trailing whitespace">`)
+		write(rest)
+		out.WriteString("</span>")
+	}
+	write(cr)
+	return out.String()
+}
@@ -6,6 +6,8 @@ require (
 	github.com/buildkite/terminal-to-html/v3 v3.7.0
 	github.com/go-git/go-git/v5 v5.5.1
 	github.com/gomarkdown/markdown v0.0.0-20221013030248-663e2500819c
+	github.com/sergi/go-diff v1.1.0
+	golang.org/x/net v0.2.0
 	gopkg.in/yaml.v3 v3.0.0
 )
 
@@ -21,11 +23,9 @@ require (
 	github.com/jbenet/go-context v0.0.0-20150711004518-d14ea06fba99 // indirect
 	github.com/kevinburke/ssh_config v1.2.0 // indirect
 	github.com/pjbgf/sha1cd v0.2.3 // indirect
-	github.com/sergi/go-diff v1.1.0 // indirect
 	github.com/skeema/knownhosts v1.1.0 // indirect
 	github.com/xanzy/ssh-agent v0.3.3 // indirect
 	golang.org/x/crypto v0.3.0 // indirect
-	golang.org/x/net v0.2.0 // indirect
 	golang.org/x/sys v0.2.0 // indirect
 	gopkg.in/warnings.v0 v0.1.2 // indirect
 )
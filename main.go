@@ -2,325 +2,597 @@ package main
 
 import (
 	"bytes"
-	"context"
-	"crypto/rand"
-	"embed"
-	"encoding/hex"
 	"errors"
 	"flag"
 	"fmt"
-	t2html "github.com/buildkite/terminal-to-html/v3"
 	"github.com/go-git/go-git/v5"
-	"github.com/go-git/go-git/v5/plumbing"
-	"github.com/go-git/go-git/v5/plumbing/format/diff"
-	"github.com/go-git/go-git/v5/plumbing/object"
-	"github.com/gomarkdown/markdown"
-	"github.com/gomarkdown/markdown/html"
-	"github.com/gomarkdown/markdown/parser"
-	"gopkg.in/yaml.v3"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/plumbing/transport/http"
+	"github.com/protolambda/forkdiff/forkdiff"
+	"io"
 	"os"
 	"path/filepath"
-	"sort"
 	"strings"
-	"text/template"
 )
 
-//go:embed page.gohtml
-var page embed.FS
+// stringsFlag is a flag that can be repeated, collecting all values.
+type stringsFlag []string
+
+func (s *stringsFlag) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringsFlag) Set(v string) error {
+	*s = append(*s, v)
+	return nil
+}
+
+// Exit codes of the CLI, so scripts can tell the reasons of a failure apart.
+const (
+	exitError      = 1 // any other error
+	exitConfig     = 2 // invalid flags or fork page definition, see forkdiff.ConfigError
+	exitEmpty      = 3 // no changes between the base and fork, with -fail-on-empty
+	exitIncomplete = 4 // diffs were left out of the page, with -require-complete
+	exitMismatch   = 5 // the page does not match the golden file of -check-against
+)
 
 func main() {
 	repoPathStr := flag.String("repo", ".", "path to local git repository")
-	forkPagePathStr := flag.String("fork", "fork.yaml", "fork page definition")
+	forkPagePathStr := flag.String("fork", "fork.yaml", "fork page definition, a file or an http(s) URL")
+	forkAuthEnvStr := flag.String("fork-auth-env", "FORKDIFF_AUTH", "environment variable with the Authorization header to fetch a -fork or -baseline URL with, like \"Bearer <token>\", if set")
 	outStr := flag.String("out", "index.html", "output")
+	maxFileSizeInt := flag.Int64("max-file-size", 0, "files with a base or fork blob larger than this many bytes are not diffed (0 to disable)")
+	renameThreshold := flag.Int("rename-threshold", forkdiff.DefaultRenameThreshold, "similarity in percent that a deleted and an added file need to be diffed as a rename, like git -M. 100 only pairs identical files")
+	failOnEmpty := flag.Bool("fail-on-empty", false, "exit with code 3 if there are no changes between the base and fork")
+	requireComplete := flag.Bool("require-complete", false, "exit with code 4 if diffs were left out of the page, because of -max-file-size or -max-total-size. The page is still written")
+	coverageStr := flag.String("coverage", "", "print which files of the whole fork tree, changed or not, each section claims, as \"text\" or \"json\", without generating a page")
+	dryRun := flag.Bool("dry-run", false, "print the sections with matched files, and the unclaimed files, without generating a page")
+	strict := flag.Bool("strict", false, "fail if there are changed files that are not claimed by any section, or section globs, dirs or comments that match nothing")
+	sortStr := flag.String("sort", "path", "order of the files within a section: \"path\", \"last-modified\" (most recently changed in the fork history first), or \"first-added\" (first changed by a fork commit first)")
+	lastChanged := flag.Bool("last-changed", false, "show the latest commit of the fork history that changed each file in its header, linked if the fork has a url")
+	naturalSort := flag.Bool("natural-sort", false, "order file paths naturally, comparing numbers by value, so \"file2\" comes before \"file10\"")
+	modeStr := flag.String("mode", "full", "page mode: \"full\" renders all diffs, \"summary\" only lists the changed files with their stats")
+	groupBy := flag.String("group-by", "file", "group the changes by \"file\", in the sections of the fork page definition, or by \"commit\", to show the changes of each fork commit like a patch series")
+	merges := flag.String("merges", "skip", "with -group-by commit: \"skip\" merge commits, or diff them against their \"first-parent\"")
+	outPatternStr := flag.String("out-pattern", "", "split mode: write each top-level section to its own page, at this path relative to the -out directory. {slug} and {index} are replaced with the section title slug and 1-based position")
+	baseRefStr := flag.String("base", "", "override the base ref of the fork page definition. This may be a glob pattern like \"refs/tags/v*\", to select the highest matching ref, or \"empty\" to diff against an empty tree, so every fork file is an addition")
+	rangeStr := flag.String("range", "", "git revision range of the base and fork, instead of the refs of the fork page definition: \"A..B\" diffs B against A, \"A...B\" diffs B against the merge base of A and B")
+	fetchStr := flag.String("fetch", "", "name of a remote to fetch the base ref from before diffing. The base ref must be a remote-tracking branch of that remote, or a tag")
+	fetchTokenEnvStr := flag.String("fetch-token-env", "", "environment variable with the token to authenticate -fetch with, like GITHUB_TOKEN. The token is only sent over https")
+	noRemaining := flag.Bool("no-remaining", false, "do not render the changes that are not claimed by any section")
+	autoSection := flag.Bool("auto-section", false, "group the changes that are not claimed by any section into auto-generated sections by directory, instead of a single section")
+	autoSectionDepth := flag.Int("auto-section-depth", 1, "number of leading path directories that the auto-generated sections of -auto-section group the files by")
+	baselineStr := flag.String("baseline", "", "previous fork page definition, to report the files that moved between sections, and the added and removed sections")
+	markdownUnsafe := flag.Bool("markdown-unsafe", false, "pass raw HTML in markdown descriptions through as-is, instead of escaping it. Only use this with trusted fork page definitions")
+	noEmoji := flag.Bool("no-emoji", false, "render emoji shortcodes like :rocket: in the markdown descriptions as they are, instead of as their emoji")
+	markdownWorkers := flag.Int("markdown-workers", 0, "number of markdown descriptions and comments to render in parallel before building the page (0 for the number of CPUs, 1 to render them one by one)")
+	blame := flag.Bool("blame", false, "annotate each diff hunk with the fork commits that introduced its added lines (expensive)")
+	showNotes := flag.Bool("show-notes", false, "with -blame or -group-by commit, show the git notes (refs/notes/commits) of the commits the hunks are annotated with, or of the listed commits")
+	formatStr := flag.String("format", "html", "output format: \"html\", \"text\" for a plain-text report, \"github-suggestions\" for the changed lines as GitHub review suggestions, \"tree-diff\" for only the added, removed and renamed directories, or \"json\" for the sections, files and line counts as JSON. A comma-separated list writes every format next to -out, with the extension of the format")
+	color := flag.Bool("color", true, "in the text format, color the diffs with ANSI escape codes")
+	sinceStr := flag.String("since", "", "a previous fork commit (hash or ref): mark the files and hunks that changed since that commit")
+	upstreamStr := flag.String("upstream", "", "a newer upstream commit (hash or ref): list what changed upstream since the base by section, marking the files the fork changed too, which may conflict when merging")
+	divergence := flag.Bool("divergence", false, "show how many commits the fork is ahead of and behind the base, from their merge base")
+	contributorsFlag := flag.Bool("contributors", false, "list the authors of the fork commits near the top of the page, with the co-authors of their Co-authored-by trailers")
+	showTrailers := flag.Bool("show-trailers", false, "with -group-by commit: show the trailers of the commit messages, like Signed-off-by, as a list under each commit")
+	previews := flag.Bool("previews", false, "embed a preview of the first hunk of every file in the tree of changed files, shown when hovering over the file")
+	heatmap := flag.Bool("heatmap", false, "tint the files in the tree of changed files by the share of their lines that changed")
+	showGlobs := flag.Bool("show-globs", false, "show the globs and dirs of each section under its heading, and the ignore globs under the ignored changes, to see why a file is in a section")
+	embedDefinition := flag.Bool("embed-definition", false, "show the YAML of the fork page definition in a collapsed block at the bottom of the page, to document how it was configured")
+	dataAttrs := flag.Bool("data-attrs", false, "add data attributes with the path, line counts and status to every file, for client scripts")
+	maxLineLength := flag.Int("max-line-length", 0, "truncate the diff lines longer than N characters on the page, with a marker to show the rest of the line (0 to disable)")
+	maxHunks := flag.Int("max-hunks", 0, "render only the first N hunks of each file, and collapse the rest behind a \"show more\" control (0 to disable)")
+	top := flag.Int("top", 0, "render the diffs of only the N files with the most changed lines, and only list the other files (0 to render all)")
+	contextLines := flag.Int("context", forkdiff.DefaultContext, "number of unchanged lines around the changes in the diffs, like git -U. Sections of the fork page definition may override it with \"context\" (0 for the default)")
+	collapseContext := flag.Int("collapse-context", 0, "collapse runs of more than N unchanged lines within a hunk behind a control to show them (0 to disable)")
+	prefixStr := flag.String("prefix", "name", "prefix of the paths in the diff headers: \"name\" of the base and fork, \"a/b\" like git, or \"none\"")
+	tabWidth := flag.Int("tab-width", 8, "width of a tab in the diffs, in spaces")
+	expandTabs := flag.Bool("expand-tabs", false, "replace the tabs in the diffs with spaces up to the next tab stop, for a precise alignment of mixed indentation")
+	showWhitespace := flag.Bool("show-whitespace", false, "show the spaces, tabs and other whitespace of the changed lines in the diffs, and mark trailing whitespace")
+	foldIndent := flag.Bool("fold-indent", false, "experimental: add controls to the lines of the diffs to fold the deeper indented lines after them, like the body of a function")
+	noColor := flag.Bool("no-color", false, "render the diffs without colors: as plain markup with CSS classes in the HTML page, and without ANSI colors in the text format")
+	diffColorsStr := flag.String("diff-colors", "", "pin the colors of the diff lines on the HTML page to match its theme, as comma-separated role=color pairs of the roles \"add\", \"delete\", \"hunk\" and \"meta\", like \"add=#7ee787,delete=#ffa198\"")
+	maxTotalSizeInt := flag.Int64("max-total-size", 256<<20, "maximum size of a generated page in bytes. Once a diff would not fit anymore, it and all later diffs are omitted (0 to disable)")
+	summaryOutStr := flag.String("summary-out", "", "also write a diffstat of the files on the page to this path, in the format of \"git diff --stat\"")
+	outlineOutStr := flag.String("outline-out", "", "also write the outline of the sections, with their file and line counts, to this path as a nested markdown list")
+	feedOutStr := flag.String("feed-out", "", "also write an Atom feed of the most recent fork commits to this path, with links to the page")
+	fragmentsDirStr := flag.String("fragments-dir", "", "also write the HTML of every top-level section to its own fragment file in this directory, named by the section slug, with a manifest.json that lists them")
+	checkAgainstStr := flag.String("check-against", "", "compare the page with this golden file instead of writing it to -out, and exit with code 5 and the differing lines if they do not match")
+	openPage := flag.Bool("open", false, "open the page in the default browser after writing it. Skipped when not on an interactive terminal, or with -quiet")
+	watchMode := flag.Bool("watch", false, "keep running, and generate the output again every time the fork page definition, the baseline, the inputs or the refs of the repository change")
+	quiet := flag.Bool("quiet", false, "do not log informational messages and warnings to stderr. Errors are still printed")
+	fragment := flag.Bool("fragment", false, "render only the page content, without the HTML document, styling and scripts, to include it in another page")
+	minify := flag.Bool("minify", false, "minify the HTML output: drop comments and collapse whitespace, except in the diffs and other preformatted content")
+	faviconStr := flag.String("favicon", "", "icon of the page: an image file, embedded as a data URI, a data URI or an http(s) URL. Overrides the favicon of the page definition")
+	metaDescriptionStr := flag.String("meta-description", "", "description of the page for search engines and link previews. Overrides the meta_description of the page definition, defaults to a summary of the changes")
+	filePathStr := flag.String("file", "", "single-file mode: print the diff of this file to stdout, without a fork page definition. Requires -base")
+	forkRefStr := flag.String("fork-ref", "HEAD", "fork ref in -file mode")
+	plain := flag.Bool("plain", false, "in -file mode, print a plain unified diff instead of HTML")
+	maxDepth := flag.Int("max-depth", forkdiff.DefaultMaxDepth, "maximum nesting depth of the sections in the fork page definition")
+	multiSection := flag.Bool("multi-section", false, "allow a file to be claimed by multiple sections, instead of failing. The file is listed in every section that claims it, but counted once in the totals")
+	globCaseInsensitive := flag.Bool("glob-case-insensitive", false, "match the globs of the fork page definition regardless of case. Paths are still displayed as they are")
+	changeKindsStr := flag.String("change-kinds", "", "only diff the files with these kinds of change, a comma-separated set of \"add\", \"modify\" and \"delete\". Renames are modifications")
+	authorStr := flag.String("author", "", "only diff the files that were last changed by the fork commits of the author with this e-mail address. With -group-by commit, only the commits of the author are listed")
+	skipGenerated := flag.Bool("skip-generated", false, "move the files that are generated in the fork, with a -generated-marker line at the start, out of the sections to the ignored changes")
+	generatedMarkerStr := flag.String("generated-marker", forkdiff.DefaultGeneratedMarker, "regular expression of the line that marks a generated file, with -skip-generated")
+	textconvFlag := flag.Bool("textconv", false, "apply the textconv filters of the fork page definition, which run its commands to convert files to text before diffing them. Only use this with trusted fork page definitions")
+	baseDirStr := flag.String("base-dir", "", "diff directories instead of git commits: the base directory. Requires -fork-dir, -repo is not used")
+	forkDirStr := flag.String("fork-dir", "", "the fork directory, with -base-dir")
+	baseTarStr := flag.String("base-tar", "", "diff tar archives instead of git commits: the base archive, optionally gzip-compressed. Requires -target-tar, -repo is not used")
+	targetTarStr := flag.String("target-tar", "", "the fork archive, with -base-tar")
+	var targets stringsFlag
+	flag.Var(&targets, "target", "fork ref to diff against the base, instead of the fork of the definition. May be repeated, to render a page that combines multiple fork branches, with a tab per target")
+	var extensions stringsFlag
+	flag.Var(&extensions, "ext", "only diff the files with this extension, e.g. \"go\". May be repeated")
 	flag.Parse()
 
+	exit := func(code int, err error, msg string, args ...any) {
+		_, _ = fmt.Fprintf(os.Stderr, msg, args...)
+		_, _ = fmt.Fprintf(os.Stderr, "\nerror: %v", err)
+		os.Exit(code)
+	}
 	must := func(err error, msg string, args ...any) {
-		if err != nil {
-			_, _ = fmt.Fprintf(os.Stderr, msg, args...)
-			_, _ = fmt.Fprintf(os.Stderr, "\nerror: %v", err)
-			os.Exit(1)
+		if err == nil {
+			return
+		}
+		var configErr *forkdiff.ConfigError
+		if errors.As(err, &configErr) {
+			exit(exitConfig, err, msg, args...)
 		}
+		exit(exitError, err, msg, args...)
 	}
-	pageDefinition, err := readPageYaml(*forkPagePathStr)
-	must(err, "failed to read page definition %q", *forkPagePathStr)
-	if pageDefinition.Def == nil {
-		must(errors.New("no fork definition defined"), "need to root fork definition")
+	checkEmpty := func(res *forkdiff.Result, msg string, args ...any) {
+		if *failOnEmpty && res.IsEmpty() {
+			exit(exitEmpty, errors.New("no changes between the base and fork"), msg, args...)
+		}
 	}
-
-	repo, err := git.PlainOpen(*repoPathStr)
-	must(err, "failed to open git repository %q", *repoPathStr)
-
-	findCommit := func(rr *RefRepo) *object.Commit {
-		if rr.Ref != "" && rr.Hash != "" {
-			must(errors.New("hash and ref"), "cannot use both hash and reference")
+	checkComplete := func(res *forkdiff.Result, msg string, args ...any) {
+		if *requireComplete && res.Incomplete() {
+			exit(exitIncomplete, errors.New("diffs were left out of the page"), msg, args...)
 		}
-		if rr.Ref == "" && rr.Hash == "" {
-			must(errors.New("no hash and no ref"), "need either hash or reference")
+	}
+	// checkGolden compares a page with the -check-against golden file, and prints the differences if it does not match
+	checkGolden := func(page []byte) {
+		golden, err := os.ReadFile(*checkAgainstStr)
+		must(err, "failed to read golden file %q", *checkAgainstStr)
+		if d := goldenDiff(string(golden), string(page), maxGoldenDiffLines); d != "" {
+			_, _ = os.Stderr.WriteString(d)
+			exit(exitMismatch, errors.New("the page does not match the golden file"), "check against %q", *checkAgainstStr)
 		}
-		if rr.Ref != "" {
-			ref, err := repo.Reference(plumbing.ReferenceName(rr.Ref), true)
-			must(err, "failed to find git ref %q", rr.Ref)
-
-			commit, err := repo.CommitObject(ref.Hash())
-			must(err, "failed to open commit %s", ref.Hash())
-			return commit
+	}
+	var log io.Writer = os.Stderr
+	if *quiet {
+		log = nil
+	}
+	// open opens the written page with -open, a browser that cannot be launched does not fail the run
+	open := func(path string) {
+		if !*openPage || *quiet || !isTerminal(os.Stdout) {
+			return
+		}
+		if abs, err := filepath.Abs(path); err == nil {
+			path = abs
+		}
+		if err := openBrowser(path); err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "failed to open %q in a browser: %v\n", path, err)
 		}
-		commit, err := repo.CommitObject(plumbing.NewHash(rr.Hash))
-		must(err, "failed to find commit hash %s", rr.Hash)
-		return commit
 	}
-
-	baseCommit := findCommit(&pageDefinition.Base)
-	baseTree, err := baseCommit.Tree()
-	must(err, "failed to open base git tree")
-
-	forkCommit := findCommit(&pageDefinition.Fork)
-	forkTree, err := forkCommit.Tree()
-	must(err, "failed to open fork git tree")
-
-	forkPatch, err := baseTree.PatchContext(context.Background(), forkTree)
-	must(err, "failed to compute patch between base and fork")
-
-	baseFiles := map[string]struct{}{}
-	forkFiles := map[string]struct{}{}
-	patchByName := make(map[string]diff.FilePatch, len(forkPatch.FilePatches()))
-	for _, fp := range forkPatch.FilePatches() {
-		from, to := fp.Files()
-		if to != nil {
-			patchByName[to.Path()] = fp
-		} else {
-			patchByName[from.Path()] = fp
+	if *watchMode {
+		if *checkAgainstStr != "" {
+			must(&forkdiff.ConfigError{Err: errors.New("conflicting flags")}, "-watch cannot be used with -check-against")
 		}
-		if to != nil {
-			forkFiles[to.Path()] = struct{}{}
+		var files, dirs []string
+		if *filePathStr == "" {
+			files = append(files, *forkPagePathStr)
 		}
-		if from != nil {
-			baseFiles[from.Path()] = struct{}{}
+		if *baselineStr != "" {
+			files = append(files, *baselineStr)
 		}
+		switch {
+		case *baseDirStr != "" && *forkDirStr != "":
+			dirs = append(dirs, *baseDirStr, *forkDirStr)
+		case *baseTarStr != "" && *targetTarStr != "":
+			files = append(files, *baseTarStr, *targetTarStr)
+		default:
+			gitFiles, gitDirs := gitWatchPaths(*repoPathStr)
+			files, dirs = append(files, gitFiles...), append(dirs, gitDirs...)
+		}
+		must(runWatch(files, dirs, log), "failed to watch")
+		return
 	}
-	// remove the patches that are ignored
-	ignored := make(map[string]diff.FilePatch)
-	for k := range patchByName {
-		for _, globPattern := range pageDefinition.Ignore {
-			ok, err := filepath.Match(globPattern, k)
-			must(err, "failed to check %q against ignore glob pattern %q", k, globPattern)
-			if ok {
-				ignored[k] = patchByName[k]
-				delete(patchByName, k)
-			}
+	if *filePathStr != "" {
+		if *rangeStr != "" {
+			must(&forkdiff.ConfigError{Err: errors.New("conflicting flags")}, "-range cannot be used with -file")
+		}
+		if *baseRefStr == "" {
+			must(&forkdiff.ConfigError{Err: errors.New("no -base ref")}, "-file mode requires a -base ref")
 		}
+		repo, err := openRepo(*repoPathStr)
+		must(err, "failed to open git repository %q", *repoPathStr)
+		out, err := forkdiff.FileDiff(&forkdiff.Options{
+			Repo:            repo,
+			MaxFileSize:     *maxFileSizeInt,
+			RenameThreshold: *renameThreshold,
+			Context:         *contextLines,
+			Blame:           *blame,
+			Prefix:          *prefixStr,
+			TabWidth:        *tabWidth,
+			ExpandTabs:      *expandTabs,
+			ShowWhitespace:  *showWhitespace,
+			Log:             log,
+		}, forkdiff.RefRepo{Ref: *baseRefStr}, forkdiff.RefRepo{Ref: *forkRefStr}, *filePathStr, *plain)
+		must(err, "failed to render diff of %q", *filePathStr)
+		_, _ = os.Stdout.WriteString(out)
+		return
+	}
+
+	// definitions from a URL are fetched once, even if they are read again for every -target
+	pages := &forkdiff.PageReader{}
+	if auth := os.Getenv(*forkAuthEnvStr); auth != "" {
+		pages.Header = map[string][]string{"Authorization": {auth}}
+	}
+	pageDefinition, err := pages.ReadPage(*forkPagePathStr)
+	must(err, "failed to read page definition %q", *forkPagePathStr)
+
+	var baselineDefinition *forkdiff.Page
+	if *baselineStr != "" {
+		baselineDefinition, err = pages.ReadPage(*baselineStr)
+		must(err, "failed to read baseline page definition %q", *baselineStr)
 	}
-	remaining := make(map[string]struct{})
-	for k := range patchByName {
-		remaining[k] = struct{}{}
+
+	var repo *git.Repository
+	if (*baseDirStr != "" || *forkDirStr != "") && (*baseTarStr != "" || *targetTarStr != "") {
+		must(&forkdiff.ConfigError{Err: errors.New("conflicting flags")}, "-base-dir cannot be used with -base-tar")
 	}
-	must(pageDefinition.Def.hydrate(patchByName, remaining, 1), "failed to hydrate patch stats")
-	if len(remaining) > 0 {
-		remainingDef := &ForkDefinition{
-			Title: "Other changes",
-			Level: 2,
+	if *baseDirStr != "" || *forkDirStr != "" {
+		if *baseDirStr == "" || *forkDirStr == "" {
+			must(&forkdiff.ConfigError{Err: errors.New("missing directory")}, "-base-dir and -fork-dir must be used together")
 		}
-		remainingPaths := make([]string, 0, len(remaining))
-		for k := range remaining {
-			remainingPaths = append(remainingPaths, k)
+		if *baseRefStr != "" || *fetchStr != "" {
+			must(&forkdiff.ConfigError{Err: errors.New("conflicting flags")}, "-base and -fetch cannot be used with -base-dir")
 		}
-		sort.Strings(remainingPaths)
-		for _, k := range remainingPaths {
-			remainingDef.hydratePatch(k, patchByName[k])
+		repo, err = forkdiff.DirRepo(*baseDirStr, *forkDirStr)
+		must(err, "failed to read directories %q and %q", *baseDirStr, *forkDirStr)
+		pageDefinition.Base.Ref, pageDefinition.Base.Hash = forkdiff.DirBaseRef, ""
+		pageDefinition.Fork.Ref, pageDefinition.Fork.Hash = forkdiff.DirForkRef, ""
+	} else if *baseTarStr != "" || *targetTarStr != "" {
+		if *baseTarStr == "" || *targetTarStr == "" {
+			must(&forkdiff.ConfigError{Err: errors.New("missing archive")}, "-base-tar and -target-tar must be used together")
 		}
-		pageDefinition.Def.Sub = append(pageDefinition.Def.Sub, remainingDef)
-		pageDefinition.Def.LinesAdded += remainingDef.LinesAdded
-		pageDefinition.Def.LinesDeleted += remainingDef.LinesDeleted
-	}
-	if len(ignored) > 0 {
-		ignoredPaths := make([]string, 0, len(ignored))
-		for k := range ignored {
-			ignoredPaths = append(ignoredPaths, k)
+		if *baseRefStr != "" || *fetchStr != "" {
+			must(&forkdiff.ConfigError{Err: errors.New("conflicting flags")}, "-base and -fetch cannot be used with -base-tar")
 		}
-		sort.Strings(ignoredPaths)
-		ignoredDef := &ForkDefinition{
-			Title: "Ignored changes",
-			Level: 4,
+		repo, err = forkdiff.TarRepo(*baseTarStr, *targetTarStr)
+		must(err, "failed to read archives %q and %q", *baseTarStr, *targetTarStr)
+		pageDefinition.Base.Ref, pageDefinition.Base.Hash = forkdiff.DirBaseRef, ""
+		pageDefinition.Fork.Ref, pageDefinition.Fork.Hash = forkdiff.DirForkRef, ""
+	} else {
+		repo, err = openRepo(*repoPathStr)
+		must(err, "failed to open git repository %q", *repoPathStr)
+	}
+
+	switch *coverageStr {
+	case "", "text", "json":
+	default:
+		must(&forkdiff.ConfigError{Err: fmt.Errorf("unknown coverage format %q", *coverageStr)}, "invalid -coverage")
+	}
+	if *rangeStr != "" && (*baseRefStr != "" || len(targets) > 0 || *baseDirStr != "" || *baseTarStr != "") {
+		must(&forkdiff.ConfigError{Err: errors.New("conflicting flags")}, "-range cannot be used with -base, -target, -base-dir or -base-tar")
+	}
+	if *coverageStr != "" && len(targets) > 0 {
+		must(&forkdiff.ConfigError{Err: errors.New("conflicting flags")}, "-coverage cannot be used with -target")
+	}
+	if *autoSection && *noRemaining {
+		must(&forkdiff.ConfigError{Err: errors.New("conflicting flags")}, "-auto-section cannot be used with -no-remaining")
+	}
+	if *autoSectionDepth < 1 {
+		must(&forkdiff.ConfigError{Err: fmt.Errorf("invalid depth %d", *autoSectionDepth)}, "invalid -auto-section-depth")
+	}
+	autoSectionLevels := 0
+	if *autoSection {
+		autoSectionLevels = *autoSectionDepth
+	}
+	if *checkAgainstStr != "" && *outPatternStr != "" {
+		must(&forkdiff.ConfigError{Err: errors.New("conflicting flags")}, "-check-against cannot be used with -out-pattern")
+	}
+	formats := strings.Split(*formatStr, ",")
+	seenFormats := make(map[string]bool, len(formats))
+	for i, format := range formats {
+		format = strings.TrimSpace(format)
+		if !forkdiff.IsFormat(format) {
+			must(&forkdiff.ConfigError{Err: fmt.Errorf("unknown format %q", format)}, "invalid -format")
 		}
-		for _, k := range ignoredPaths {
-			ignoredDef.hydratePatch(k, ignored[k])
+		if seenFormats[format] {
+			must(&forkdiff.ConfigError{Err: fmt.Errorf("format %q is listed twice", format)}, "invalid -format")
 		}
-		pageDefinition.Ignored = ignoredDef
+		seenFormats[format] = true
+		formats[i] = format
+	}
+	if len(formats) > 1 && (*outPatternStr != "" || *checkAgainstStr != "" || len(targets) > 0) {
+		must(&forkdiff.ConfigError{Err: errors.New("conflicting flags")}, "multiple -format cannot be used with -out-pattern, -check-against or -target")
+	}
+	// with multiple formats, every format is written next to -out, with the extension of the format
+	pagePath := *outStr
+	if len(formats) > 1 {
+		pagePath = formatOutPath(*outStr, "html")
 	}
 
-	templ := template.New("main")
-	templ.Funcs(template.FuncMap{
-		"renderMarkdown": func(md string) string {
-			markdownRenderer := html.NewRenderer(html.RendererOptions{
-				Flags:     html.Smartypants | html.SmartypantsFractions | html.SmartypantsDashes | html.SmartypantsLatexDashes,
-				Generator: "forkdiff",
-			})
-			markdownParser := parser.NewWithExtensions(parser.CommonExtensions | parser.OrderedListStart)
-			return string(markdown.ToHTML([]byte(md), markdownParser, markdownRenderer))
-		},
-		"page": func() *Page {
-			return pageDefinition
-		},
-		"existsInBase": func(path string) bool {
-			_, ok := baseFiles[path]
-			return ok
-		},
-		"existsInFork": func(path string) bool {
-			_, ok := forkFiles[path]
-			return ok
-		},
-		"baseFileURL": func(path string) string {
-			return fmt.Sprintf("%s/blob/%s/%s", pageDefinition.Base.URL, baseCommit.Hash, path)
-		},
-		"forkFileURL": func(path string) string {
-			return fmt.Sprintf("%s/blob/%s/%s", pageDefinition.Fork.URL, forkCommit.Hash, path)
-		},
-		"baseCommitHash": func() string {
-			return baseCommit.Hash.String()
-		},
-		"forkCommitHash": func() string {
-			return forkCommit.Hash.String()
-		},
-		"renderPatch": func(fps *FilePatchStats) (string, error) {
-			var out bytes.Buffer
-			enc := diff.NewUnifiedEncoder(&out, 3)
-			enc.SetSrcPrefix(pageDefinition.Base.Name + "/")
-			enc.SetDstPrefix(pageDefinition.Fork.Name + "/")
-			enc.SetColor(diff.NewColorConfig())
+	var favicon string
+	if *faviconStr != "" {
+		favicon, err = forkdiff.LoadFavicon(*faviconStr)
+		must(err, "invalid -favicon")
+	}
 
-			err := enc.Encode(FilePatch{filePatch: fps.Patch})
-			if err != nil {
-				return "", fmt.Errorf("")
-			}
-			return string(t2html.Render(out.Bytes())), nil
-		},
-		"randomID": func() (string, error) {
-			var out [12]byte
-			if _, err := rand.Read(out[:]); err != nil {
-				return "", err
+	var changeKinds []string
+	if *changeKindsStr != "" {
+		changeKinds = strings.Split(*changeKindsStr, ",")
+	}
+
+	var diffColors map[string]string
+	if *diffColorsStr != "" {
+		diffColors = make(map[string]string)
+		for _, pair := range strings.Split(*diffColorsStr, ",") {
+			role, c, ok := strings.Cut(pair, "=")
+			if !ok {
+				must(&forkdiff.ConfigError{Err: fmt.Errorf("%q is not a role=color pair", pair)}, "invalid -diff-colors")
 			}
-			return "id-" + hex.EncodeToString(out[:]), nil
-		},
-	})
-	templ, err = templ.ParseFS(page, "*.gohtml")
-	must(err, "failed to parse page template")
+			diffColors[strings.TrimSpace(role)] = strings.TrimSpace(c)
+		}
+	}
 
-	f, err := os.OpenFile(*outStr, os.O_WRONLY|os.O_TRUNC|os.O_CREATE, 0o755)
-	must(err, "failed to open output file")
-	defer f.Close()
-	must(templ.ExecuteTemplate(f, "main", pageDefinition), "failed to build page")
-}
+	var fetchAuth transport.AuthMethod
+	if token := os.Getenv(*fetchTokenEnvStr); *fetchStr != "" && *fetchTokenEnvStr != "" && token != "" {
+		// the username is ignored by token based authentication, but must not be empty
+		fetchAuth = &http.BasicAuth{Username: "forkdiff", Password: token}
+	}
 
-func readPageYaml(path string) (*Page, error) {
-	f, err := os.OpenFile(path, os.O_RDONLY, 0)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read page YAML file: %w", err)
-	}
-	defer f.Close()
-	dec := yaml.NewDecoder(f)
-	dec.KnownFields(true)
-	var page Page
-	if err := dec.Decode(&page); err != nil {
-		return nil, fmt.Errorf("failed to decode page YAML file: %w", err)
-	}
-	return &page, nil
-}
+	opts := forkdiff.Options{
+		Repo:                repo,
+		Page:                pageDefinition,
+		BaseRef:             *baseRefStr,
+		Range:               *rangeStr,
+		FetchRemote:         *fetchStr,
+		FetchAuth:           fetchAuth,
+		Baseline:            baselineDefinition,
+		MaxFileSize:         *maxFileSizeInt,
+		RenameThreshold:     *renameThreshold,
+		Extensions:          extensions,
+		ChangeKinds:         changeKinds,
+		Author:              *authorStr,
+		SkipGenerated:       *skipGenerated,
+		GeneratedMarker:     *generatedMarkerStr,
+		Textconv:            *textconvFlag,
+		MaxDepth:            *maxDepth,
+		MultipleSections:    *multiSection,
+		GlobCaseInsensitive: *globCaseInsensitive,
+		Sort:                *sortStr,
+		NaturalSort:         *naturalSort,
+		Mode:                *modeStr,
+		GroupBy:             *groupBy,
+		Merges:              *merges,
+		NoRemaining:         *noRemaining,
+		AutoSection:         autoSectionLevels,
+		MarkdownUnsafe:      *markdownUnsafe,
+		NoEmoji:             *noEmoji,
+		MarkdownWorkers:     *markdownWorkers,
+		Blame:               *blame,
+		ShowNotes:           *showNotes,
+		Format:              formats[0],
+		Color:               *color && !*noColor,
+		NoColor:             *noColor,
+		DiffColors:          diffColors,
+		Divergence:          *divergence,
+		Contributors:        *contributorsFlag,
+		ShowTrailers:        *showTrailers,
+		MaxLineLength:       *maxLineLength,
+		MaxHunks:            *maxHunks,
+		Top:                 *top,
+		Context:             *contextLines,
+		CollapseContext:     *collapseContext,
+		DataAttrs:           *dataAttrs,
+		Previews:            *previews,
+		Heatmap:             *heatmap,
+		EmbedDefinition:     *embedDefinition,
+		ShowGlobs:           *showGlobs,
+		Prefix:              *prefixStr,
+		TabWidth:            *tabWidth,
+		ExpandTabs:          *expandTabs,
+		ShowWhitespace:      *showWhitespace,
+		FoldIndent:          *foldIndent,
+		Since:               *sinceStr,
+		Upstream:            *upstreamStr,
+		MaxTotalSize:        *maxTotalSizeInt,
+		Fragment:            *fragment,
+		Minify:              *minify,
+		Favicon:             favicon,
+		MetaDescription:     *metaDescriptionStr,
+		LastChanged:         *lastChanged,
+		Strict:              *strict,
+		Log:                 log,
+	}
 
-func countOperations(chunks []diff.Chunk, op diff.Operation) (out int) {
-	for _, ch := range chunks {
-		if ch.Type() == op {
-			out += strings.Count(ch.Content(), "\n")
+	if len(targets) > 0 {
+		if *outPatternStr != "" || *baseDirStr != "" || *baseTarStr != "" || *summaryOutStr != "" || *outlineOutStr != "" || *feedOutStr != "" || *fragmentsDirStr != "" {
+			must(&forkdiff.ConfigError{Err: errors.New("conflicting flags")}, "-target cannot be used with -out-pattern, -base-dir, -base-tar, -summary-out, -outline-out, -feed-out or -fragments-dir")
+		}
+		var results []*forkdiff.Result
+		for i, target := range targets {
+			// every target is analyzed with its own copy of the definition, since analysis hydrates it
+			targetPage, err := pages.ReadPage(*forkPagePathStr)
+			must(err, "failed to read page definition %q", *forkPagePathStr)
+			targetPage.Fork.Ref, targetPage.Fork.Hash = target, ""
+			targetPage.Fork.Name = forkdiff.ShortRefName(target)
+			targetOpts := opts
+			targetOpts.Page = targetPage
+			targetOpts.AnchorPrefix = fmt.Sprintf("t%d-", i+1)
+			res, err := forkdiff.Analyze(&targetOpts)
+			must(err, "failed to analyze fork diff of target %q", target)
+			if *dryRun {
+				_, _ = fmt.Fprintf(os.Stdout, "target %s:\n", target)
+				res.PrintDryRun(os.Stdout)
+			}
+			if *strict {
+				must(res.CheckStrict(), "strict mode, target %q", target)
+			}
+			checkEmpty(res, "fail on empty, target %q", target)
+			results = append(results, res)
+		}
+		if *dryRun {
+			return
+		}
+		if *checkAgainstStr != "" {
+			var buf bytes.Buffer
+			must(forkdiff.RenderTargets(&buf, results), "failed to build page")
+			checkGolden(buf.Bytes())
+			for i, res := range results {
+				checkComplete(res, "require complete, target %q", targets[i])
+			}
+			return
+		}
+		f, err := os.OpenFile(*outStr, os.O_WRONLY|os.O_TRUNC|os.O_CREATE, 0o755)
+		must(err, "failed to open output file %q", *outStr)
+		must(forkdiff.RenderTargets(f, results), "failed to build page %q", *outStr)
+		must(f.Close(), "failed to close output file %q", *outStr)
+		open(*outStr)
+		for i, res := range results {
+			checkComplete(res, "require complete, target %q", targets[i])
 		}
+		return
 	}
-	return
-}
-
-type FilePatch struct {
-	filePatch diff.FilePatch
-}
-
-var _ diff.Patch = FilePatch{}
 
-func (p FilePatch) FilePatches() []diff.FilePatch {
-	return []diff.FilePatch{p.filePatch}
-}
+	res, err := forkdiff.Analyze(&opts)
+	must(err, "failed to analyze fork diff")
 
-func (p FilePatch) Message() string {
-	return ""
-}
+	if *coverageStr != "" {
+		coverage, err := res.Coverage()
+		must(err, "failed to compute coverage")
+		if *coverageStr == "json" {
+			must(coverage.WriteJSON(os.Stdout), "failed to write coverage")
+		} else {
+			must(coverage.WriteText(os.Stdout), "failed to write coverage")
+		}
+		return
+	}
 
-type RefRepo struct {
-	Name string `yaml:"name"`
-	Ref  string `yaml:"ref,omitempty"`
-	Hash string `yaml:"hash,omitempty"`
-	URL  string `yaml:"url"`
-}
+	if *dryRun {
+		res.PrintDryRun(os.Stdout)
+	}
+	if *strict {
+		must(res.CheckStrict(), "strict mode")
+	}
+	checkEmpty(res, "fail on empty")
+	if *dryRun {
+		return
+	}
 
-type Page struct {
-	Title  string          `yaml:"title"`
-	Footer string          `yaml:"footer"`
-	Base   RefRepo         `yaml:"base"`
-	Fork   RefRepo         `yaml:"fork"`
-	Def    *ForkDefinition `yaml:"def"`
-	Ignore []string        `yaml:"ignore"`
+	if *summaryOutStr != "" {
+		f, err := os.OpenFile(*summaryOutStr, os.O_WRONLY|os.O_TRUNC|os.O_CREATE, 0o755)
+		must(err, "failed to open summary output file %q", *summaryOutStr)
+		must(res.WriteDiffStat(f), "failed to write summary %q", *summaryOutStr)
+		must(f.Close(), "failed to close summary output file %q", *summaryOutStr)
+	}
+	if *outlineOutStr != "" {
+		// the sections are linked on the page, which is written alongside the outline, unless in split mode
+		var pageLink string
+		if *outPatternStr == "" && seenFormats["html"] {
+			link, err := filepath.Rel(filepath.Dir(*outlineOutStr), pagePath)
+			must(err, "failed to link outline %q to page %q", *outlineOutStr, *outStr)
+			pageLink = filepath.ToSlash(link)
+		}
+		f, err := os.OpenFile(*outlineOutStr, os.O_WRONLY|os.O_TRUNC|os.O_CREATE, 0o755)
+		must(err, "failed to open outline output file %q", *outlineOutStr)
+		must(res.WriteOutline(f, pageLink), "failed to write outline %q", *outlineOutStr)
+		must(f.Close(), "failed to close outline output file %q", *outlineOutStr)
+	}
+	if *feedOutStr != "" {
+		// the entries link to the page relative to the feed, which is written alongside it
+		pageLink, err := filepath.Rel(filepath.Dir(*feedOutStr), pagePath)
+		must(err, "failed to link feed %q to page %q", *feedOutStr, *outStr)
+		f, err := os.OpenFile(*feedOutStr, os.O_WRONLY|os.O_TRUNC|os.O_CREATE, 0o755)
+		must(err, "failed to open feed output file %q", *feedOutStr)
+		must(res.WriteFeed(f, filepath.ToSlash(pageLink)), "failed to write feed %q", *feedOutStr)
+		must(f.Close(), "failed to close feed output file %q", *feedOutStr)
+	}
+	if *fragmentsDirStr != "" {
+		manifest, fragmentPages, err := res.SectionFragments()
+		must(err, "failed to render section fragments")
+		must(os.MkdirAll(*fragmentsDirStr, 0o755), "failed to create fragments directory %q", *fragmentsDirStr)
+		for i, fragmentPage := range fragmentPages {
+			fragmentPath := filepath.Join(*fragmentsDirStr, manifest.Sections[i].File)
+			f, err := os.OpenFile(fragmentPath, os.O_WRONLY|os.O_TRUNC|os.O_CREATE, 0o755)
+			must(err, "failed to open fragment file %q", fragmentPath)
+			must(res.Render(f, fragmentPage), "failed to build fragment %q", fragmentPath)
+			must(f.Close(), "failed to close fragment file %q", fragmentPath)
+		}
+		manifestPath := filepath.Join(*fragmentsDirStr, "manifest.json")
+		f, err := os.OpenFile(manifestPath, os.O_WRONLY|os.O_TRUNC|os.O_CREATE, 0o755)
+		must(err, "failed to open fragment manifest %q", manifestPath)
+		must(manifest.WriteJSON(f), "failed to write fragment manifest %q", manifestPath)
+		must(f.Close(), "failed to close fragment manifest %q", manifestPath)
+	}
 
-	Ignored *ForkDefinition `yaml:"-"`
-}
+	writePage := func(path string, p *forkdiff.Page) {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_TRUNC|os.O_CREATE, 0o755)
+		must(err, "failed to open output file %q", path)
+		defer f.Close()
+		must(res.Render(f, p), "failed to build page %q", path)
+	}
+	if *checkAgainstStr != "" {
+		var buf bytes.Buffer
+		must(res.Render(&buf, res.Page), "failed to build page")
+		checkGolden(buf.Bytes())
+		checkComplete(res, "require complete")
+		return
+	}
+	if len(formats) > 1 {
+		for _, format := range formats {
+			path := formatOutPath(*outStr, format)
+			f, err := os.OpenFile(path, os.O_WRONLY|os.O_TRUNC|os.O_CREATE, 0o755)
+			must(err, "failed to open output file %q", path)
+			must(res.RenderFormat(f, res.Page, format), "failed to build %s output %q", format, path)
+			must(f.Close(), "failed to close output file %q", path)
+		}
+		if seenFormats["html"] {
+			open(pagePath)
+		}
+		checkComplete(res, "require complete")
+		return
+	}
+	if *outPatternStr == "" {
+		writePage(*outStr, res.Page)
+		open(*outStr)
+		checkComplete(res, "require complete")
+		return
+	}
 
-type FilePatchStats struct {
-	Path         string
-	LinesAdded   int
-	LinesDeleted int
-	Binary       bool
-	Patch        diff.FilePatch
+	outDir := filepath.Dir(*outStr)
+	indexPage, sectionPages, err := res.SplitPages(*outPatternStr, filepath.Base(*outStr))
+	must(err, "failed to split page")
+	for i, sectionPage := range sectionPages {
+		sectionPath := filepath.Join(outDir, filepath.FromSlash(indexPage.Split[i].Link))
+		must(os.MkdirAll(filepath.Dir(sectionPath), 0o755), "failed to create output directory for %q", sectionPath)
+		writePage(sectionPath, sectionPage)
+	}
+	writePage(*outStr, indexPage)
+	open(*outStr)
+	checkComplete(res, "require complete")
 }
 
-type ForkDefinition struct {
-	Title       string            `yaml:"title,omitempty"`
-	Description string            `yaml:"description,omitempty"`
-	Globs       []string          `yaml:"globs,omitempty"`
-	Sub         []*ForkDefinition `yaml:"sub,omitempty"`
-
-	Files        []FilePatchStats `yaml:"-"`
-	LinesAdded   int              `yaml:"-"`
-	LinesDeleted int              `yaml:"-"`
-	Level        int              `yaml:"-"`
+// formatExtensions are the extensions of the output files of the formats, when writing multiple formats.
+var formatExtensions = map[string]string{
+	"html":               ".html",
+	"text":               ".txt",
+	"github-suggestions": ".suggestions.md",
+	"tree-diff":          ".tree.txt",
+	"json":               ".json",
 }
 
-func (fd *ForkDefinition) hydrate(patchByName map[string]diff.FilePatch, remaining map[string]struct{}, level int) error {
-	fd.Level = level
-	for i, sub := range fd.Sub {
-		if err := sub.hydrate(patchByName, remaining, level+1); err != nil {
-			return fmt.Errorf("sub definition %d failed to hydrate: %w", i, err)
-		}
-		fd.LinesAdded += sub.LinesAdded
-		fd.LinesDeleted += sub.LinesDeleted
-	}
-	for i, globPattern := range fd.Globs {
-		for name, p := range patchByName {
-			if ok, err := filepath.Match(globPattern, name); err != nil {
-				return fmt.Errorf("failed to glob match entry %q against pattern %q", name, globPattern)
-			} else if ok {
-				if _, ok := remaining[name]; !ok {
-					return fmt.Errorf("file %q was matched by glob %d (%q) but is not remaining", name, i, globPattern)
-				}
-				delete(remaining, name)
-				fd.hydratePatch(name, p)
-			}
-		}
-	}
-	return nil
+// formatOutPath returns the path of the output of a format, when writing multiple formats:
+// the -out path with the extension of the format instead of its own, like "index.txt" for "index.html".
+func formatOutPath(out, format string) string {
+	return strings.TrimSuffix(out, filepath.Ext(out)) + formatExtensions[format]
 }
 
-func (fd *ForkDefinition) hydratePatch(name string, p diff.FilePatch) {
-	stat := FilePatchStats{
-		Path:         name,
-		LinesAdded:   countOperations(p.Chunks(), diff.Add),
-		LinesDeleted: countOperations(p.Chunks(), diff.Delete),
-		Binary:       p.IsBinary(),
-		Patch:        p,
-	}
-	fd.Files = append(fd.Files, stat)
-	fd.LinesAdded += stat.LinesAdded
-	fd.LinesDeleted += stat.LinesDeleted
+// openRepo opens the git repository at the path, which may be a linked worktree, with the refs in the common git directory.
+func openRepo(path string) (*git.Repository, error) {
+	return git.PlainOpenWithOptions(path, &git.PlainOpenOptions{EnableDotGitCommonDir: true})
 }
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// watchInterval is how often -watch checks the watched files for changes.
+const watchInterval = 500 * time.Millisecond
+
+// watchDebounce is how long the watched files must be unchanged after a change before -watch regenerates,
+// so an editor save or a git operation that writes multiple files triggers a single run.
+const watchDebounce = 300 * time.Millisecond
+
+// fileStamp is the modification time and size of a watched file.
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// stampFiles returns the stamps of the files, and of all files in the dirs, by path. Missing files are left out,
+// so a file that is created or removed is a change too. The ".git" directories within the dirs are skipped.
+func stampFiles(files, dirs []string) map[string]fileStamp {
+	stamps := make(map[string]fileStamp)
+	for _, p := range files {
+		if info, err := os.Stat(p); err == nil {
+			stamps[p] = fileStamp{modTime: info.ModTime(), size: info.Size()}
+		}
+	}
+	for _, root := range dirs {
+		_ = filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				// a file that is removed while walking is picked up by the next check
+				return nil
+			}
+			if d.IsDir() {
+				if d.Name() == ".git" && p != root {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if info, err := d.Info(); err == nil {
+				stamps[p] = fileStamp{modTime: info.ModTime(), size: info.Size()}
+			}
+			return nil
+		})
+	}
+	return stamps
+}
+
+func sameStamps(a, b map[string]fileStamp) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for p, s := range a {
+		if o, ok := b[p]; !ok || !o.modTime.Equal(s.modTime) || o.size != s.size {
+			return false
+		}
+	}
+	return true
+}
+
+// watch calls run every time the files, or the files in the dirs, change, once they settled for watchDebounce.
+// The files are polled, so this works on any filesystem, without platform specific notifications. It does not return.
+func watch(files, dirs []string, run func()) {
+	last := stampFiles(files, dirs)
+	for {
+		time.Sleep(watchInterval)
+		current := stampFiles(files, dirs)
+		if sameStamps(last, current) {
+			continue
+		}
+		for {
+			time.Sleep(watchDebounce)
+			next := stampFiles(files, dirs)
+			if sameStamps(current, next) {
+				break
+			}
+			current = next
+		}
+		run()
+		// the run may write to the watched files itself, like a page in -fork-dir, or refs with -fetch
+		last = stampFiles(files, dirs)
+	}
+}
+
+// gitWatchPaths returns the HEAD and packed-refs files, and the refs directory, of the git repository at the path,
+// which may be bare or a linked worktree, so that commits, checkouts and fetches are changes.
+func gitWatchPaths(repoPath string) (files, dirs []string) {
+	gitDir := filepath.Join(repoPath, ".git")
+	if info, err := os.Stat(gitDir); err != nil {
+		// a bare repository
+		gitDir = repoPath
+	} else if !info.IsDir() {
+		// a linked worktree, with a file that points to its git directory
+		if content, err := os.ReadFile(gitDir); err == nil {
+			line := strings.TrimSpace(string(content))
+			if strings.HasPrefix(line, "gitdir: ") {
+				gitDir = strings.TrimPrefix(line, "gitdir: ")
+				if !filepath.IsAbs(gitDir) {
+					gitDir = filepath.Join(repoPath, gitDir)
+				}
+			}
+		}
+	}
+	commonDir := gitDir
+	if content, err := os.ReadFile(filepath.Join(gitDir, "commondir")); err == nil {
+		commonDir = strings.TrimSpace(string(content))
+		if !filepath.IsAbs(commonDir) {
+			commonDir = filepath.Join(gitDir, commonDir)
+		}
+	}
+	files = []string{filepath.Join(gitDir, "HEAD"), filepath.Join(commonDir, "packed-refs")}
+	dirs = []string{filepath.Join(commonDir, "refs")}
+	return files, dirs
+}
+
+// watchArgs returns the flags that were set on the command line, without -watch, to run forkdiff again with.
+// -open is only kept for the first run, so the browser is not opened again on every change.
+func watchArgs(first bool) []string {
+	var args []string
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "watch":
+			return
+		case "open":
+			if !first {
+				return
+			}
+		}
+		if values, ok := f.Value.(*stringsFlag); ok {
+			for _, v := range *values {
+				args = append(args, fmt.Sprintf("-%s=%s", f.Name, v))
+			}
+			return
+		}
+		args = append(args, fmt.Sprintf("-%s=%s", f.Name, f.Value.String()))
+	})
+	return args
+}
+
+// runWatch generates the output with the same flags, and generates it again every time the watched files change.
+// Every run is a separate process, so a run that fails, like on an invalid fork page definition while editing it,
+// is reported and the watching continues. It only returns if forkdiff cannot be run again.
+func runWatch(files, dirs []string, log io.Writer) error {
+	self, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to find forkdiff executable: %w", err)
+	}
+	generate := func(first bool) {
+		cmd := exec.Command(self, watchArgs(first)...)
+		cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+		if err := cmd.Run(); err != nil {
+			// the error of the run itself is already printed
+			_, _ = fmt.Fprintf(os.Stderr, "\nfailed to generate: %v\n", err)
+		} else if log != nil {
+			_, _ = fmt.Fprintf(log, "generated at %s\n", time.Now().Format("15:04:05"))
+		}
+	}
+	generate(true)
+	if log != nil {
+		_, _ = fmt.Fprintf(log, "watching %s for changes\n", strings.Join(append(files, dirs...), ", "))
+	}
+	watch(files, dirs, func() {
+		generate(false)
+	})
+	return nil
+}